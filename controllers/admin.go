@@ -105,7 +105,7 @@ func (repository *AdminRepo) AdminLogin(c *gin.Context) {
 	}
 
 	// Create JWT Token for Authorization
-	tokenString, err := auth.GenerateToken(int(a.ID), a.AdminEmail, a.AdminUsername)
+	tokenString, err := auth.GenerateToken(int(a.ID), a.AdminEmail, a.AdminUsername, auth.RoleAdmin)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		c.Abort()
@@ -218,11 +218,15 @@ func (repository *AdminRepo) UpdateAdmin(c *gin.Context) {
 
 func (repository *AdminRepo) GetAdminsData(c *gin.Context) {
 
-	page, pageSize, sortField, sortOrder := pagination.Paginate(c)
+	page, pageSize, orderBy, err := pagination.Paginate(c, models.AdminSorts)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	var a models.Admin
 
-	admins, totalPages, err := a.GetAdminsPaginate(repository.Db, page, pageSize, sortField, sortOrder)
+	admins, totalPages, err := a.GetAdminsPaginate(repository.Db, page, pageSize, orderBy)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Admin not found!"})
 		c.Abort()
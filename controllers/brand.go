@@ -3,8 +3,11 @@ package controllers
 import (
 	"be-dbo-golang/database"
 	"be-dbo-golang/models"
+	"be-dbo-golang/utils/filter"
 	"be-dbo-golang/utils/pagination"
+	"be-dbo-golang/utils/search"
 	"errors"
+	"log"
 	"net/http"
 	"strconv"
 
@@ -14,6 +17,8 @@ import (
 
 type BrandRepo struct {
 	Db *gorm.DB
+	// product search index, the products hold the name of their brand
+	Search search.Index
 }
 
 func NewBrand() *BrandRepo {
@@ -22,6 +27,16 @@ func NewBrand() *BrandRepo {
 	return &BrandRepo{Db: db}
 }
 
+// keep the products of the brand in step in the search index, a failure only leaves the index stale
+func (repository *BrandRepo) reindexBrandProducts(id int) {
+	if repository.Search == nil {
+		return
+	}
+	if err := models.IndexBrandProducts(repository.Db, repository.Search, id); err != nil {
+		log.Printf("index products of brand %d: %v", id, err)
+	}
+}
+
 type BrandResponse struct {
 	ID   uint   `json:"id"`
 	Name string `json:"name"`
@@ -121,6 +136,10 @@ func (repository *BrandRepo) UpdateBrand(c *gin.Context) {
 		return
 	}
 
+	if input.Name != "" {
+		repository.reindexBrandProducts(id)
+	}
+
 	var response BrandResponse
 	response.ID = b.ID
 	response.Name = b.BrandName
@@ -131,11 +150,21 @@ func (repository *BrandRepo) UpdateBrand(c *gin.Context) {
 
 func (repository *BrandRepo) GetBrandsData(c *gin.Context) {
 
-	page, pageSize, sortField, sortOrder := pagination.Paginate(c)
+	page, pageSize, orderBy, err := pagination.Paginate(c, models.BrandSorts)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	f, err := filter.Parse(c.Request.URL.Query(), models.BrandFilters)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	var b models.Brand
 
-	Brands, totalPages, err := b.GetBrandsPaginate(repository.Db, page, pageSize, sortField, sortOrder)
+	Brands, totalPages, err := b.GetBrandsPaginate(f.Apply(repository.Db), page, pageSize, orderBy)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Product not found!"})
 		c.Abort()
@@ -175,5 +204,7 @@ func (repository *BrandRepo) DeleteBrand(c *gin.Context) {
 		return
 	}
 
+	repository.reindexBrandProducts(id)
+
 	c.JSON(http.StatusCreated, gin.H{"message": "data deleted"})
 }
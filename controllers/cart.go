@@ -0,0 +1,314 @@
+package controllers
+
+import (
+	"be-dbo-golang/database"
+	"be-dbo-golang/models"
+	"be-dbo-golang/utils/auth"
+	"be-dbo-golang/utils/money"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type CartRepo struct {
+	Db *gorm.DB
+}
+
+func NewCart() *CartRepo {
+	db := database.InitDb()
+	db.AutoMigrate(&models.Cart{}, &models.CartItem{}, &models.Checkout{})
+	// items are unique by variant now
+	if db.Migrator().HasIndex(&models.CartItem{}, "idx_cart_item_product") {
+		db.Migrator().DropIndex(&models.CartItem{}, "idx_cart_item_product")
+	}
+	return &CartRepo{Db: db}
+}
+
+// load the cart of the logged in customer
+func (repository *CartRepo) customerCart(c *gin.Context, cart *models.Cart) bool {
+	customerId, _, err := auth.ExtractTokenID(c)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+
+	if err := models.GetCustomerCart(repository.Db, cart, customerId); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return false
+	}
+
+	return true
+}
+
+// reply with the cart priced at the current product prices
+func (repository *CartRepo) cartResponse(c *gin.Context, status int, customerId int) {
+	cart := models.Cart{}
+
+	if err := models.GetCustomerCart(repository.Db, &cart, customerId); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	if err := models.PriceCart(repository.Db, &cart); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(status, gin.H{"message": "success", "data": cart})
+}
+
+// check the product, or its variant, exists and has the quantity in stock
+func (repository *CartRepo) checkStock(c *gin.Context, productId, variantId, qty int) bool {
+	err := models.CheckProductStock(repository.Db, productId, variantId, qty)
+	if err == nil {
+		return true
+	}
+
+	if errors.Is(err, models.ErrVariantRequired) || errors.Is(err, models.ErrVariantNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "product_id": productId, "variant_id": variantId})
+		return false
+	}
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Product not found!", "product_id": productId})
+		return false
+	}
+
+	if errors.Is(err, models.ErrInsufficientStock) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "product_id": productId})
+		return false
+	}
+
+	c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+	return false
+}
+
+func (repository *CartRepo) GetCartData(c *gin.Context) {
+
+	customerId, _, err := auth.ExtractTokenID(c)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	repository.cartResponse(c, http.StatusOK, customerId)
+}
+
+type CartItemRecordInput struct {
+	ProductId int `json:"product_id" binding:"required"`
+	VariantId int `json:"variant_id"`
+	Qty       int `json:"quantity" binding:"required,gt=0"`
+}
+
+func (repository *CartRepo) SaveCartItemData(c *gin.Context) {
+
+	var input CartItemRecordInput
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cart := models.Cart{}
+
+	if !repository.customerCart(c, &cart) {
+		return
+	}
+
+	// the stock has to cover what is already in the cart too
+	qty := input.Qty
+	for _, item := range cart.CartItems {
+		if item.CartItemProductId == input.ProductId && item.CartItemVariantId == input.VariantId {
+			qty += item.CartItemQty
+		}
+	}
+
+	if !repository.checkStock(c, input.ProductId, input.VariantId, qty) {
+		return
+	}
+
+	item := models.CartItem{}
+
+	item.CartItemCartId = int(cart.ID)
+	item.CartItemProductId = input.ProductId
+	item.CartItemVariantId = input.VariantId
+	item.CartItemQty = input.Qty
+
+	if err := models.AddCartItem(repository.Db, &item); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	repository.cartResponse(c, http.StatusCreated, cart.CartCustomerId)
+}
+
+type CartItemUpdateInput struct {
+	Qty int `json:"quantity" binding:"required,gt=0"`
+}
+
+func (repository *CartRepo) UpdateCartItem(c *gin.Context) {
+	var input CartItemUpdateInput
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cart := models.Cart{}
+
+	if !repository.customerCart(c, &cart) {
+		return
+	}
+
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	item := models.CartItem{}
+
+	err := models.GetCartItemById(repository.Db, &item, id, int(cart.ID))
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	if !repository.checkStock(c, item.CartItemProductId, item.CartItemVariantId, input.Qty) {
+		return
+	}
+
+	item.CartItemQty = input.Qty
+
+	if err := models.UpdateCartItem(repository.Db, &item, id); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	repository.cartResponse(c, http.StatusOK, cart.CartCustomerId)
+}
+
+func (repository *CartRepo) DeleteCartItem(c *gin.Context) {
+
+	cart := models.Cart{}
+
+	if !repository.customerCart(c, &cart) {
+		return
+	}
+
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	item := models.CartItem{}
+
+	if err := models.DeleteCartItem(repository.Db, &item, id, int(cart.ID)); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	repository.cartResponse(c, http.StatusOK, cart.CartCustomerId)
+}
+
+type CartCheckoutInput struct {
+	CouponCode        string        `json:"coupon_code"`
+	ShippingAddressId int           `json:"shipping_address_id"`
+	ShippingAddress   *AddressInput `json:"shipping_address"`
+}
+
+// place the cart as a checkout split in one order per supplier
+func (repository *CartRepo) CheckoutCart(c *gin.Context) {
+	var input CartCheckoutInput
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cart := models.Cart{}
+
+	if !repository.customerCart(c, &cart) {
+		return
+	}
+
+	address, ok := orderShippingAddress(c, repository.Db, input.ShippingAddressId, input.ShippingAddress, cart.CartCustomerId)
+	if !ok {
+		return
+	}
+
+	checkout, err := models.CheckoutCart(repository.Db, &cart, address, input.CouponCode)
+
+	if err != nil {
+		if errors.Is(err, models.ErrCartEmpty) || errors.Is(err, models.ErrInsufficientStock) || errors.Is(err, models.ErrCartProductUnavailable) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if errors.Is(err, money.ErrCurrencyMismatch) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "all products of a supplier must be priced in the same currency"})
+			return
+		}
+
+		if errors.Is(err, models.ErrCouponNotFound) || errors.Is(err, models.ErrCouponNotActive) || errors.Is(err, models.ErrCouponExhausted) || errors.Is(err, models.ErrCouponMinSpend) || errors.Is(err, models.ErrCouponNotApplicable) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "coupon_code": input.CouponCode})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Checkout success", "data": checkout})
+}
+
+func (repository *CartRepo) GetCheckoutsData(c *gin.Context) {
+
+	customerId, _, err := auth.ExtractTokenID(c)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var checkouts []models.Checkout
+
+	if err := models.GetCheckoutsByCustomer(repository.Db, &checkouts, customerId); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": checkouts})
+}
+
+// checkout with its supplier orders and their aggregated status
+func (repository *CartRepo) GetCheckoutById(c *gin.Context) {
+
+	customerId, _, err := auth.ExtractTokenID(c)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	checkout := models.Checkout{}
+
+	if err := models.GetCheckoutById(repository.Db, &checkout, id, customerId); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success", "data": checkout})
+}
@@ -0,0 +1,242 @@
+package controllers
+
+import (
+	"be-dbo-golang/database"
+	"be-dbo-golang/models"
+	"be-dbo-golang/utils/pagination"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type CategoryRepo struct {
+	Db *gorm.DB
+}
+
+func NewCategory() *CategoryRepo {
+	db := database.InitDb()
+	db.AutoMigrate(&models.Category{})
+	database.AddForeignKey(db, "categories", "category_parent_id", "categories")
+	return &CategoryRepo{Db: db}
+}
+
+var slugSeparators = regexp.MustCompile(`[^a-z0-9]+`)
+
+// lowercase name with dashes between the words
+func slugify(name string) string {
+	return strings.Trim(slugSeparators.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+type CategoryRecordInput struct {
+	Name      string `json:"name" binding:"required"`
+	Slug      string `json:"slug"`
+	ParentId  *int   `json:"parent_id"`
+	SortOrder int    `json:"sort_order"`
+}
+
+func (repository *CategoryRepo) SaveCategoryData(c *gin.Context) {
+
+	var input CategoryRecordInput
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.ParentId != nil {
+		errs := fieldErrors{}
+
+		if err := errs.checkExists(repository.Db, "parent_id", &models.Category{}, *input.ParentId, "category not found"); err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+			return
+		}
+
+		if errs.abort(c) {
+			return
+		}
+	}
+
+	category := models.Category{}
+
+	category.CategoryName = input.Name
+	category.CategorySlug = input.Slug
+	if category.CategorySlug == "" {
+		category.CategorySlug = slugify(input.Name)
+	}
+	category.CategoryParentId = input.ParentId
+	category.CategorySortOrder = input.SortOrder
+
+	if err := models.CreateCategory(repository.Db, &category); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Category save successfully", "data": category})
+}
+
+// the whole category tree
+func (repository *CategoryRepo) GetCategoriesData(c *gin.Context) {
+
+	var categories []models.Category
+
+	if err := models.GetCategories(repository.Db, &categories); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": models.CategoryTree(categories)})
+}
+
+func (repository *CategoryRepo) GetCategoryById(c *gin.Context) {
+
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	category := models.Category{}
+
+	if err := models.GetCategoryById(repository.Db, &category, id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Category not found!"})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success", "data": category})
+}
+
+type CategoryUpdateInput struct {
+	Name      string `json:"name"`
+	Slug      string `json:"slug"`
+	ParentId  *int   `json:"parent_id"`
+	IsRoot    bool   `json:"is_root"`
+	SortOrder *int   `json:"sort_order"`
+}
+
+func (repository *CategoryRepo) UpdateCategory(c *gin.Context) {
+	var input CategoryUpdateInput
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	category := models.Category{}
+
+	err := models.GetCategoryById(repository.Db, &category, id)
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	// the parent stays unless another one is given or the category becomes a root
+	parentId := category.CategoryParentId
+	if input.IsRoot {
+		parentId = nil
+	} else if input.ParentId != nil {
+		errs := fieldErrors{}
+
+		if err := errs.checkExists(repository.Db, "parent_id", &models.Category{}, *input.ParentId, "category not found"); err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+			return
+		}
+
+		if errs.abort(c) {
+			return
+		}
+		parentId = input.ParentId
+	}
+
+	if input.Name != "" {
+		category.CategoryName = input.Name
+	}
+
+	if input.Slug != "" {
+		category.CategorySlug = input.Slug
+	}
+
+	if input.SortOrder != nil {
+		category.CategorySortOrder = *input.SortOrder
+	}
+
+	if err := models.UpdateCategory(repository.Db, &category, parentId); err != nil {
+		if errors.Is(err, models.ErrCategoryCycle) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success", "data": category})
+}
+
+func (repository *CategoryRepo) DeleteCategory(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	category := models.Category{}
+
+	err := models.DeleteCategory(repository.Db, &category, id)
+
+	if err != nil {
+		if errors.Is(err, models.ErrCategoryHasChildren) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "data deleted"})
+}
+
+// products of the category and of every category below it
+func (repository *CategoryRepo) GetCategoryProductsData(c *gin.Context) {
+
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	category := models.Category{}
+
+	if err := models.GetCategoryById(repository.Db, &category, id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Category not found!"})
+		c.Abort()
+		return
+	}
+
+	page, pageSize, orderBy, err := pagination.Paginate(c, models.ProductSorts)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var p models.Product
+
+	Products, totalPages, err := p.GetCategoryProductsPaginate(repository.Db, category, page, pageSize, orderBy)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Product not found!"})
+		c.Abort()
+		return
+	}
+
+	var responses []ProductResponse
+	for _, Product := range Products {
+		responses = append(responses, productResponse(Product))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":       responses,
+		"totalPages": totalPages,
+	})
+}
@@ -0,0 +1,319 @@
+package controllers
+
+import (
+	"be-dbo-golang/database"
+	"be-dbo-golang/models"
+	"be-dbo-golang/utils/money"
+	"be-dbo-golang/utils/pagination"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type CouponRepo struct {
+	Db *gorm.DB
+}
+
+func NewCoupon() *CouponRepo {
+	db := database.InitDb()
+	db.AutoMigrate(&models.Coupon{}, &models.CouponRedemption{})
+
+	// the old discount value held a percent or an amount depending on the discount type
+	if db.Migrator().HasColumn("coupons", "coupon_discount_value") {
+		db.Exec("UPDATE coupons SET coupon_discount_percent = coupon_discount_value WHERE coupon_discount_type = ?", models.CouponDiscountPercentage)
+	}
+	database.MigrateMoneyColumnWhere(db, "coupons", "coupon_discount_value", "coupon_discount_amount_", "coupon_discount_type = 'fixed'")
+	database.MigrateMoneyColumn(db, "coupons", "coupon_min_spend", "coupon_min_spend_")
+	database.MigrateMoneyColumn(db, "coupon_redemptions", "coupon_redemption_amount", "coupon_redemption_amount_")
+	return &CouponRepo{Db: db}
+}
+
+type CouponResponse struct {
+	ID               uint        `json:"id"`
+	Code             string      `json:"code"`
+	Name             string      `json:"name"`
+	DiscountType     string      `json:"discount_type"`
+	DiscountPercent  float64     `json:"discount_percent"`
+	DiscountAmount   money.Money `json:"discount_amount"`
+	MinSpend         money.Money `json:"min_spend"`
+	UsageLimit       int         `json:"usage_limit"`
+	PerCustomerLimit int         `json:"per_customer_limit"`
+	UsedCount        int         `json:"used_count"`
+	StartsAt         *time.Time  `json:"starts_at"`
+	EndsAt           *time.Time  `json:"ends_at"`
+	BrandId          int         `json:"brand_id"`
+	SupplierId       int         `json:"supplier_id"`
+	ProductId        int         `json:"product_id"`
+	IsAutomatic      bool        `json:"is_automatic"`
+	IsActive         bool        `json:"is_active"`
+}
+
+func couponResponse(cp models.Coupon) CouponResponse {
+	return CouponResponse{
+		ID:               cp.ID,
+		Code:             cp.CouponCode,
+		Name:             cp.CouponName,
+		DiscountType:     cp.CouponDiscountType,
+		DiscountPercent:  cp.CouponDiscountPercent,
+		DiscountAmount:   cp.CouponDiscountAmount,
+		MinSpend:         cp.CouponMinSpend,
+		UsageLimit:       cp.CouponUsageLimit,
+		PerCustomerLimit: cp.CouponPerCustomerLimit,
+		UsedCount:        cp.CouponUsedCount,
+		StartsAt:         cp.CouponStartsAt,
+		EndsAt:           cp.CouponEndsAt,
+		BrandId:          cp.CouponBrandId,
+		SupplierId:       cp.CouponSupplierId,
+		ProductId:        cp.CouponProductId,
+		IsAutomatic:      cp.CouponIsAutomatic,
+		IsActive:         cp.CouponIsActive,
+	}
+}
+
+type CouponRecordInput struct {
+	Code             string       `json:"code" binding:"required"`
+	Name             string       `json:"name" binding:"required"`
+	DiscountType     string       `json:"discount_type" binding:"required,oneof=percentage fixed"`
+	DiscountPercent  float64      `json:"discount_percent" binding:"gte=0,lte=100"`
+	DiscountAmount   *money.Money `json:"discount_amount"`
+	MinSpend         *money.Money `json:"min_spend"`
+	UsageLimit       int          `json:"usage_limit" binding:"gte=0"`
+	PerCustomerLimit int          `json:"per_customer_limit" binding:"gte=0"`
+	StartsAt         *time.Time   `json:"starts_at"`
+	EndsAt           *time.Time   `json:"ends_at"`
+	BrandId          int          `json:"brand_id"`
+	SupplierId       int          `json:"supplier_id"`
+	ProductId        int          `json:"product_id"`
+	IsAutomatic      bool         `json:"is_automatic"`
+	IsActive         *bool        `json:"is_active"`
+}
+
+func (repository *CouponRepo) SaveCouponData(c *gin.Context) {
+
+	var input CouponRecordInput
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.DiscountType == models.CouponDiscountPercentage && input.DiscountPercent <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "discount_percent is required for percentage coupons"})
+		return
+	}
+
+	if input.DiscountType == models.CouponDiscountFixed && (input.DiscountAmount == nil || input.DiscountAmount.Minor <= 0) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "discount_amount is required for fixed coupons"})
+		return
+	}
+
+	if input.MinSpend != nil && input.MinSpend.IsNegative() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "min_spend can't be negative"})
+		return
+	}
+
+	if input.StartsAt != nil && input.EndsAt != nil && input.EndsAt.Before(*input.StartsAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ends_at must be after starts_at"})
+		return
+	}
+
+	cp := models.Coupon{}
+
+	cp.CouponCode = input.Code
+	cp.CouponName = input.Name
+	cp.CouponDiscountType = input.DiscountType
+	cp.CouponDiscountPercent = input.DiscountPercent
+	if input.DiscountAmount != nil {
+		cp.CouponDiscountAmount = *input.DiscountAmount
+	}
+	if input.MinSpend != nil {
+		cp.CouponMinSpend = *input.MinSpend
+	}
+	cp.CouponUsageLimit = input.UsageLimit
+	cp.CouponPerCustomerLimit = input.PerCustomerLimit
+	cp.CouponStartsAt = input.StartsAt
+	cp.CouponEndsAt = input.EndsAt
+	cp.CouponBrandId = input.BrandId
+	cp.CouponSupplierId = input.SupplierId
+	cp.CouponProductId = input.ProductId
+	cp.CouponIsAutomatic = input.IsAutomatic
+	cp.CouponIsActive = input.IsActive == nil || *input.IsActive
+
+	err := models.CreateCoupon(repository.Db, &cp)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		c.Abort()
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"message": "Coupon save successfully", "id": cp.ID, "code": cp.CouponCode})
+
+}
+
+func (repository *CouponRepo) GetCouponById(c *gin.Context) {
+
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	cp := models.Coupon{}
+
+	if err := models.GetCouponById(repository.Db, &cp, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Coupon not found!"})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success", "data": couponResponse(cp)})
+}
+
+type CouponUpdateInput struct {
+	Name             string       `json:"name"`
+	DiscountType     string       `json:"discount_type" binding:"omitempty,oneof=percentage fixed"`
+	DiscountPercent  float64      `json:"discount_percent" binding:"gte=0,lte=100"`
+	DiscountAmount   *money.Money `json:"discount_amount"`
+	MinSpend         *money.Money `json:"min_spend"`
+	UsageLimit       *int         `json:"usage_limit"`
+	PerCustomerLimit *int         `json:"per_customer_limit"`
+	StartsAt         *time.Time   `json:"starts_at"`
+	EndsAt           *time.Time   `json:"ends_at"`
+	IsAutomatic      *bool        `json:"is_automatic"`
+	IsActive         *bool        `json:"is_active"`
+}
+
+func (repository *CouponRepo) UpdateCoupon(c *gin.Context) {
+	var input CouponUpdateInput
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	cp := models.Coupon{}
+
+	err := models.GetCouponById(repository.Db, &cp, id)
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	if input.Name != "" {
+		cp.CouponName = input.Name
+	}
+
+	if input.DiscountType != "" {
+		cp.CouponDiscountType = input.DiscountType
+	}
+
+	if input.DiscountPercent > 0 {
+		cp.CouponDiscountPercent = input.DiscountPercent
+	}
+
+	if input.DiscountAmount != nil && input.DiscountAmount.Minor > 0 {
+		cp.CouponDiscountAmount = *input.DiscountAmount
+	}
+
+	if input.MinSpend != nil && !input.MinSpend.IsNegative() {
+		cp.CouponMinSpend = *input.MinSpend
+	}
+
+	if input.UsageLimit != nil && *input.UsageLimit >= 0 {
+		cp.CouponUsageLimit = *input.UsageLimit
+	}
+
+	if input.PerCustomerLimit != nil && *input.PerCustomerLimit >= 0 {
+		cp.CouponPerCustomerLimit = *input.PerCustomerLimit
+	}
+
+	if input.StartsAt != nil {
+		cp.CouponStartsAt = input.StartsAt
+	}
+
+	if input.EndsAt != nil {
+		cp.CouponEndsAt = input.EndsAt
+	}
+
+	if cp.CouponDiscountType == models.CouponDiscountPercentage && cp.CouponDiscountPercent <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "discount_percent is required for percentage coupons"})
+		return
+	}
+
+	if cp.CouponDiscountType == models.CouponDiscountFixed && cp.CouponDiscountAmount.Minor <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "discount_amount is required for fixed coupons"})
+		return
+	}
+
+	if input.IsAutomatic != nil {
+		cp.CouponIsAutomatic = *input.IsAutomatic
+	}
+
+	if input.IsActive != nil {
+		cp.CouponIsActive = *input.IsActive
+	}
+
+	err = models.UpdateCoupon(repository.Db, &cp, id)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusOK, couponResponse(cp))
+}
+
+func (repository *CouponRepo) GetCouponsData(c *gin.Context) {
+
+	page, pageSize, orderBy, err := pagination.Paginate(c, models.CouponSorts)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var cp models.Coupon
+
+	Coupons, totalPages, err := cp.GetCouponsPaginate(repository.Db, page, pageSize, orderBy)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Coupon not found!"})
+		c.Abort()
+		return
+	}
+
+	var responses []CouponResponse
+	for _, Coupon := range Coupons {
+		responses = append(responses, couponResponse(Coupon))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":       responses,
+		"totalPages": totalPages,
+	})
+}
+
+func (repository *CouponRepo) DeleteCoupon(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	cp := models.Coupon{}
+
+	err := models.DeleteCoupon(repository.Db, &cp, id)
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "data deleted"})
+}
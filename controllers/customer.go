@@ -4,10 +4,13 @@ import (
 	"be-dbo-golang/database"
 	"be-dbo-golang/models"
 	"be-dbo-golang/utils/auth"
+	"be-dbo-golang/utils/export"
+	"be-dbo-golang/utils/filter"
 	"be-dbo-golang/utils/pagination"
 	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -108,7 +111,7 @@ func (repository *CustomerRepo) CustomerLogin(c *gin.Context) {
 	}
 
 	// Create JWT Token for Authorization
-	tokenString, err := auth.GenerateToken(int(u.ID), u.CustomerEmail, u.CustomerUsername)
+	tokenString, err := auth.GenerateToken(int(u.ID), u.CustomerEmail, u.CustomerUsername, auth.RoleCustomer)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		c.Abort()
@@ -229,11 +232,38 @@ func (repository *CustomerRepo) UpdateCustomer(c *gin.Context) {
 
 func (repository *CustomerRepo) GetCustomersData(c *gin.Context) {
 
-	page, pageSize, sortField, sortOrder := pagination.Paginate(c)
+	page, pageSize, orderBy, err := pagination.Paginate(c, models.CustomerSorts)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	f, err := filter.Parse(c.Request.URL.Query(), models.CustomerFilters)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// the export holds the contact details of every customer, only admins get it
+	if format := export.RequestedFormat(c); format != "" {
+		claims, err := auth.ExtractTokenClaims(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		if claims.Role != auth.RoleAdmin {
+			c.JSON(http.StatusForbidden, gin.H{"error": "only admins can export customers"})
+			return
+		}
+
+		repository.exportCustomers(c, f.Apply(repository.Db), format, orderBy)
+		return
+	}
 
 	var u models.Customer
 
-	Customers, totalPages, err := u.GetCustomersPaginate(repository.Db, page, pageSize, sortField, sortOrder)
+	Customers, totalPages, err := u.GetCustomersPaginate(f.Apply(repository.Db), page, pageSize, orderBy)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Customer not found!"})
 		c.Abort()
@@ -258,6 +288,32 @@ func (repository *CustomerRepo) GetCustomersData(c *gin.Context) {
 	})
 }
 
+// stream every customer as a csv or xlsx file
+func (repository *CustomerRepo) exportCustomers(c *gin.Context, db *gorm.DB, format, orderBy string) {
+	header := []string{"id", "name", "username", "email", "phone", "address", "created_at"}
+
+	var u models.Customer
+
+	err := export.Stream(c, format, "customers", header, func(write func([]string) error) error {
+		return u.EachCustomer(db, orderBy, func(Customer models.Customer) error {
+			return write([]string{
+				strconv.Itoa(int(Customer.ID)),
+				Customer.CustomerName,
+				Customer.CustomerUsername,
+				Customer.CustomerEmail,
+				Customer.CustomerPhone,
+				Customer.CustomerAddress,
+				Customer.CreatedAt.Format(time.RFC3339),
+			})
+		})
+	})
+
+	if err != nil {
+		c.Error(err)
+		c.Abort()
+	}
+}
+
 func (repository *CustomerRepo) DeleteCustomer(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
 
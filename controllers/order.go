@@ -3,10 +3,17 @@ package controllers
 import (
 	"be-dbo-golang/database"
 	"be-dbo-golang/models"
+	"be-dbo-golang/utils/auth"
+	"be-dbo-golang/utils/export"
+	"be-dbo-golang/utils/filter"
+	"be-dbo-golang/utils/money"
 	"be-dbo-golang/utils/pagination"
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -18,16 +25,72 @@ type OrderRepo struct {
 
 func NewOrder() *OrderRepo {
 	db := database.InitDb()
-	db.AutoMigrate(&models.Order{})
+	db.AutoMigrate(&models.Order{}, &models.OrderLine{}, &models.OrderComment{}, &models.OrderCommentRevision{})
+	for _, column := range []string{"order_subtotal_amount", "order_discount_amount", "order_net_amount", "order_tax_amount", "order_gross_amount", "order_total_amount"} {
+		database.MigrateMoneyColumn(db, "orders", column, column+"_")
+	}
+	for _, column := range []string{"order_line_unit_price", "order_line_total_amount", "order_line_discount_amount", "order_line_net_amount", "order_line_tax_amount", "order_line_gross_amount"} {
+		database.MigrateMoneyColumn(db, "order_lines", column, column+"_")
+	}
+	database.AddForeignKey(db, "orders", "order_customer_id", "customers")
+	database.AddForeignKey(db, "orders", "order_supplier_id", "suppliers")
+	database.AddForeignKey(db, "orders", "order_product_id", "products")
+	database.AddForeignKey(db, "order_lines", "order_line_product_id", "products")
+	database.AddForeignKey(db, "order_comments", "order_comment_order_id", "orders")
+	// lines recorded before the product name was kept
+	db.Exec("UPDATE order_lines JOIN products ON products.id = order_lines.order_line_product_id SET order_lines.order_line_product_name = products.product_name WHERE order_lines.order_line_product_name = ''")
 	return &OrderRepo{Db: db}
 }
 
+// admins see every order, customers and suppliers only their own
+func orderAccessible(claims *auth.JWTClaim, o *models.Order) bool {
+	switch claims.Role {
+	case auth.RoleAdmin:
+		return true
+	case auth.RoleCustomer:
+		return o.OrderCustomerId == claims.ID
+	case auth.RoleSupplier:
+		return o.OrderSupplierId == claims.ID
+	}
+	return false
+}
+
+// snapshot the address so later edits of the address book don't change the order
+func orderShippingAddress(c *gin.Context, db *gorm.DB, addressId int, input *AddressInput, customerId int) (models.Address, bool) {
+	if addressId > 0 {
+		a := models.ShippingAddress{}
+
+		if err := models.GetShippingAddressById(db, &a, addressId, customerId); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Shipping address not found!"})
+			return models.Address{}, false
+		}
+		return a.ShippingAddress, true
+	}
+
+	if input != nil {
+		return addressFromInput(*input), true
+	}
+
+	c.JSON(http.StatusBadRequest, gin.H{"error": "shipping_address_id or shipping_address is required"})
+	return models.Address{}, false
+}
+
+type OrderLineInput struct {
+	ProductId int `json:"product_id" binding:"required"`
+	VariantId int `json:"variant_id"`
+	Qty       int `json:"quantity" binding:"required,gt=0"`
+}
+
 type OrderRecordInput struct {
-	SupplierId int     `json:"supplier_id" binding:"required"`
-	CustomerId int     `json:"customer_id" binding:"required"`
-	ProductId  int     `json:"product_id" binding:"required"`
-	Qty        int     `json:"quantity" binding:"required"`
-	Amount     float64 `json:"total_amount" binding:"required"`
+	SupplierId        int              `json:"supplier_id" binding:"required"`
+	CustomerId        int              `json:"customer_id"`
+	ProductId         int              `json:"product_id"`
+	VariantId         int              `json:"variant_id"`
+	Qty               int              `json:"quantity"`
+	CouponCode        string           `json:"coupon_code"`
+	Lines             []OrderLineInput `json:"lines" binding:"omitempty,dive"`
+	ShippingAddressId int              `json:"shipping_address_id"`
+	ShippingAddress   *AddressInput    `json:"shipping_address"`
 }
 
 func (repository *OrderRepo) SaveOrderData(c *gin.Context) {
@@ -39,22 +102,124 @@ func (repository *OrderRepo) SaveOrderData(c *gin.Context) {
 		return
 	}
 
+	// single product orders are kept for older clients
+	lines := input.Lines
+	if len(lines) == 0 {
+		if input.ProductId == 0 || input.Qty <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "order requires product_id and quantity or at least one line"})
+			return
+		}
+		lines = []OrderLineInput{{ProductId: input.ProductId, VariantId: input.VariantId, Qty: input.Qty}}
+	}
+
+	claims, err := auth.ExtractTokenClaims(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	// customers order for themselves, only admins order on behalf of a customer
+	if claims.Role == auth.RoleCustomer {
+		if input.CustomerId != 0 && input.CustomerId != claims.ID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "customers can only order for themselves"})
+			return
+		}
+		input.CustomerId = claims.ID
+	} else if input.CustomerId == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "customer_id is required"})
+		return
+	}
+
+	errs := fieldErrors{}
+
+	if err := errs.checkExists(repository.Db, "customer_id", &models.Customer{}, input.CustomerId, "customer not found"); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	if err := errs.checkExists(repository.Db, "supplier_id", &models.Supplier{}, input.SupplierId, "supplier not found"); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
 	o := models.Order{}
 
 	o.OrderSupplierId = input.SupplierId
 	o.OrderCustomerId = input.CustomerId
-	o.OrderProductId = input.ProductId
-	o.OrderQty = input.Qty
-	o.OrderTotalAmount = input.Amount
+	o.OrderProductId = lines[0].ProductId
+	o.OrderStatus = models.OrderStatusPending
+
+	for i, line := range lines {
+		field := fmt.Sprintf("lines[%d].product_id", i)
+		variantField := fmt.Sprintf("lines[%d].variant_id", i)
+		if len(input.Lines) == 0 {
+			field = "product_id"
+			variantField = "variant_id"
+		}
+
+		p := models.Product{}
+
+		if err := models.GetProductById(repository.Db, &p, line.ProductId); err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+				return
+			}
+			errs[field] = "product not found"
+			continue
+		}
+
+		if p.ProductSupplierId != input.SupplierId {
+			errs[field] = "product is not supplied by supplier_id"
+			continue
+		}
+
+		variant, err := models.ResolveProductVariant(repository.Db, p, line.VariantId)
+		if err != nil {
+			if !errors.Is(err, models.ErrVariantRequired) && !errors.Is(err, models.ErrVariantNotFound) {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+				return
+			}
+			errs[variantField] = err.Error()
+			continue
+		}
+
+		o.OrderQty += line.Qty
+		o.OrderLines = append(o.OrderLines, models.NewVariantOrderLine(p, variant, line.Qty))
+	}
+
+	if errs.abort(c) {
+		return
+	}
+
+	address, ok := orderShippingAddress(c, repository.Db, input.ShippingAddressId, input.ShippingAddress, input.CustomerId)
+	if !ok {
+		return
+	}
+	o.OrderShippingAddress = address
 
-	err := models.CreateOrder(repository.Db, &o)
+	err = models.PlaceOrder(repository.Db, &o, input.CouponCode)
 
 	if err != nil {
+		if errors.Is(err, models.ErrInsufficientStock) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if errors.Is(err, money.ErrCurrencyMismatch) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "all products of an order must be priced in the same currency"})
+			return
+		}
+
+		if errors.Is(err, models.ErrCouponNotFound) || errors.Is(err, models.ErrCouponNotActive) || errors.Is(err, models.ErrCouponExhausted) || errors.Is(err, models.ErrCouponMinSpend) || errors.Is(err, models.ErrCouponNotApplicable) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "coupon_code": input.CouponCode})
+			return
+		}
+
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		c.Abort()
 		return
 	}
-	c.JSON(http.StatusCreated, gin.H{"message": "Order save successfully", "id": o.ID, "total_amount": o.OrderTotalAmount})
+	c.JSON(http.StatusCreated, gin.H{"message": "Order save successfully", "id": o.ID, "subtotal_amount": o.OrderSubtotalAmount, "discount_amount": o.OrderDiscountAmount, "net_amount": o.OrderNetAmount, "tax_amount": o.OrderTaxAmount, "total_amount": o.OrderTotalAmount, "status": o.OrderStatus})
 
 }
 
@@ -64,7 +229,13 @@ func (repository *OrderRepo) GetOrderById(c *gin.Context) {
 
 	o := models.Order{}
 
-	if err := models.GetOrderById(repository.Db, &o, id); err != nil {
+	claims, err := auth.ExtractTokenClaims(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := models.GetOrderById(repository.Db, &o, id); err != nil || !orderAccessible(claims, &o) {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Order not found!"})
 		c.Abort()
 		return
@@ -73,12 +244,12 @@ func (repository *OrderRepo) GetOrderById(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "success", "data": o})
 }
 
+// totals aren't taken from the client, they are recalculated from the lines
 type OrderUpdateInput struct {
-	SupplierId int     `json:"supplier_id"`
-	CustomerId int     `json:"customer_id"`
-	ProductId  int     `json:"product_id"`
-	Qty        int     `json:"quantity"`
-	Amount     float64 `json:"total_amount"`
+	SupplierId int `json:"supplier_id"`
+	CustomerId int `json:"customer_id"`
+	ProductId  int `json:"product_id"`
+	Qty        int `json:"quantity"`
 }
 
 func (repository *OrderRepo) UpdateOrder(c *gin.Context) {
@@ -105,14 +276,29 @@ func (repository *OrderRepo) UpdateOrder(c *gin.Context) {
 		return
 	}
 
+	errs := fieldErrors{}
+
 	if input.SupplierId > 0 {
+		if err := errs.checkExists(repository.Db, "supplier_id", &models.Supplier{}, input.SupplierId, "supplier not found"); err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+			return
+		}
 		o.OrderSupplierId = input.SupplierId
 	}
 
 	if input.CustomerId > 0 {
+		if err := errs.checkExists(repository.Db, "customer_id", &models.Customer{}, input.CustomerId, "customer not found"); err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+			return
+		}
 		o.OrderCustomerId = input.CustomerId
 	}
 
+	if (input.ProductId > 0 || input.Qty > 0) && len(o.OrderLines) > 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "product and quantity can only be changed on single product orders"})
+		return
+	}
+
 	if input.ProductId > 0 {
 		o.OrderProductId = input.ProductId
 	}
@@ -121,8 +307,79 @@ func (repository *OrderRepo) UpdateOrder(c *gin.Context) {
 		o.OrderQty = input.Qty
 	}
 
-	if input.Amount > 0 {
-		o.OrderTotalAmount = input.Amount
+	if (input.ProductId > 0 || input.Qty > 0) && len(o.OrderLines) == 1 {
+		line := o.OrderLines[0]
+
+		if line.OrderLineProductId != o.OrderProductId {
+			p := models.Product{}
+
+			if err := models.GetProductById(repository.Db, &p, o.OrderProductId); err != nil {
+				if !errors.Is(err, gorm.ErrRecordNotFound) {
+					c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+					return
+				}
+				errs["product_id"] = "product not found"
+			} else if _, err := models.ResolveProductVariant(repository.Db, p, 0); err != nil {
+				if !errors.Is(err, models.ErrVariantRequired) {
+					c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+					return
+				}
+				errs["product_id"] = err.Error()
+			} else {
+				line.OrderLineProductId = o.OrderProductId
+				line.OrderLineProductName = p.ProductName
+				line.OrderLineVariantId = 0
+				line.OrderLineSku = ""
+				line.OrderLineUnitPrice = p.ProductPrice
+			}
+		}
+
+		line.OrderLineQty = o.OrderQty
+		line.OrderLineTotalAmount = line.OrderLineUnitPrice.Mul(int64(line.OrderLineQty))
+		o.OrderLines[0] = line
+	}
+
+	// every product of the order has to come from the order supplier
+	for _, line := range o.OrderLines {
+		if len(errs) > 0 || (input.SupplierId == 0 && input.ProductId == 0) {
+			break
+		}
+
+		p := models.Product{}
+
+		if err := models.GetProductById(repository.Db, &p, line.OrderLineProductId); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+			return
+		}
+
+		if p.ID != 0 && p.ProductSupplierId != o.OrderSupplierId {
+			if input.ProductId > 0 {
+				errs["product_id"] = "product is not supplied by supplier_id"
+			} else {
+				errs["supplier_id"] = "supplier does not supply the products of the order"
+			}
+		}
+	}
+
+	if errs.abort(c) {
+		return
+	}
+
+	if (input.ProductId > 0 || input.Qty > 0) && len(o.OrderLines) == 1 {
+		if err := models.RecalculateOrder(repository.Db, &o); err != nil {
+			if errors.Is(err, models.ErrInsufficientStock) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			if errors.Is(err, money.ErrCurrencyMismatch) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "all products of an order must be priced in the same currency"})
+				return
+			}
+
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+			return
+		}
 	}
 
 	err = models.UpdateOrder(repository.Db, &o, id)
@@ -136,11 +393,26 @@ func (repository *OrderRepo) UpdateOrder(c *gin.Context) {
 
 func (repository *OrderRepo) GetOrdersData(c *gin.Context) {
 
-	page, pageSize, sortField, sortOrder := pagination.Paginate(c)
+	page, pageSize, orderBy, err := pagination.Paginate(c, models.OrderSorts)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	f, err := filter.Parse(c.Request.URL.Query(), models.OrderFilters)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if format := export.RequestedFormat(c); format != "" {
+		repository.exportOrders(c, f.Apply(repository.Db), format, orderBy)
+		return
+	}
 
 	var s models.Order
 
-	Orders, totalPages, err := s.GetOrdersPaginate(repository.Db, page, pageSize, sortField, sortOrder)
+	Orders, totalPages, err := s.GetOrdersPaginate(f.Apply(repository.Db), page, pageSize, orderBy)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Order not found!"})
 		c.Abort()
@@ -153,6 +425,39 @@ func (repository *OrderRepo) GetOrdersData(c *gin.Context) {
 	})
 }
 
+// stream every order as a csv or xlsx file
+func (repository *OrderRepo) exportOrders(c *gin.Context, db *gorm.DB, format, orderBy string) {
+	header := []string{"id", "customer_id", "supplier_id", "status", "qty", "currency", "subtotal_amount", "discount_amount", "net_amount", "tax_amount", "total_amount", "coupon_code", "is_paid", "created_at"}
+
+	var s models.Order
+
+	err := export.Stream(c, format, "orders", header, func(write func([]string) error) error {
+		return s.EachOrder(db, orderBy, func(o models.Order) error {
+			return write([]string{
+				strconv.Itoa(int(o.ID)),
+				strconv.Itoa(o.OrderCustomerId),
+				strconv.Itoa(o.OrderSupplierId),
+				o.OrderStatus,
+				strconv.Itoa(o.OrderQty),
+				o.OrderTotalAmount.Currency,
+				o.OrderSubtotalAmount.Amount(),
+				o.OrderDiscountAmount.Amount(),
+				o.OrderNetAmount.Amount(),
+				o.OrderTaxAmount.Amount(),
+				o.OrderTotalAmount.Amount(),
+				o.OrderCouponCode,
+				strconv.Itoa(int(o.OrderIsPaid)),
+				o.CreatedAt.Format(time.RFC3339),
+			})
+		})
+	})
+
+	if err != nil {
+		c.Error(err)
+		c.Abort()
+	}
+}
+
 func (repository *OrderRepo) DeleteOrder(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
 
@@ -172,3 +477,103 @@ func (repository *OrderRepo) DeleteOrder(c *gin.Context) {
 
 	c.JSON(http.StatusCreated, gin.H{"message": "data deleted"})
 }
+
+// accepts 2006-01-02 or RFC 3339, a bare date as upper bound includes the whole day
+func parseDateParam(value string, upper bool) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return nil, err
+	}
+
+	if upper {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
+
+// read status, from and to query parameters shared by the scoped order listings
+func orderFilterFromQuery(c *gin.Context) (models.OrderFilter, error) {
+	var filter models.OrderFilter
+	var err error
+
+	if status := c.Query("status"); status != "" {
+		filter.Statuses = strings.Split(status, ",")
+	}
+
+	if filter.CreatedFrom, err = parseDateParam(c.Query("from"), false); err != nil {
+		return filter, errors.New("from must be a date (2006-01-02) or an RFC 3339 timestamp")
+	}
+
+	if filter.CreatedTo, err = parseDateParam(c.Query("to"), true); err != nil {
+		return filter, errors.New("to must be a date (2006-01-02) or an RFC 3339 timestamp")
+	}
+
+	return filter, nil
+}
+
+func (repository *OrderRepo) GetCustomerOrdersData(c *gin.Context) {
+
+	customerId, _, err := auth.ExtractTokenID(c)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filter, err := orderFilterFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filter.CustomerId = customerId
+
+	page, pageSize, orderBy, err := pagination.Paginate(c, models.OrderSorts)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var o models.Order
+
+	Orders, totalPages, err := o.GetOrdersFilteredPaginate(repository.Db, filter, page, pageSize, orderBy)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Order not found!"})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":       Orders,
+		"totalPages": totalPages,
+	})
+}
+
+func (repository *OrderRepo) GetCustomerOrderById(c *gin.Context) {
+
+	customerId, _, err := auth.ExtractTokenID(c)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	o := models.Order{}
+
+	if err := models.GetOrderById(repository.Db, &o, id); err != nil || o.OrderCustomerId != customerId {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Order not found!"})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success", "data": o})
+}
@@ -0,0 +1,188 @@
+package controllers
+
+import (
+	"be-dbo-golang/models"
+	"be-dbo-golang/utils/auth"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// load the order for the thread, only when the logged in user can see it
+func (repository *OrderRepo) commentOrder(c *gin.Context, claims *auth.JWTClaim, o *models.Order, id int) bool {
+	if err := models.GetOrderById(repository.Db, o, id); err != nil || !orderAccessible(claims, o) {
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+			return false
+		}
+
+		c.JSON(http.StatusNotFound, gin.H{"message": "Order not found!"})
+		c.Abort()
+		return false
+	}
+
+	return true
+}
+
+// load a comment the logged in user can see
+func (repository *OrderRepo) accessibleComment(c *gin.Context, claims *auth.JWTClaim, comment *models.OrderComment) bool {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	err := models.GetOrderCommentById(repository.Db, comment, id)
+	if err == nil && comment.OrderCommentVisibility == models.OrderCommentInternal && claims.Role != auth.RoleAdmin {
+		err = gorm.ErrRecordNotFound
+	}
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.AbortWithStatus(http.StatusNotFound)
+			return false
+		}
+
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return false
+	}
+
+	o := models.Order{}
+
+	return repository.commentOrder(c, claims, &o, comment.OrderCommentOrderId)
+}
+
+func (repository *OrderRepo) GetOrderCommentsData(c *gin.Context) {
+
+	claims, err := auth.ExtractTokenClaims(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	o := models.Order{}
+
+	if !repository.commentOrder(c, claims, &o, id) {
+		return
+	}
+
+	var comments []models.OrderComment
+
+	if err := models.GetOrderComments(repository.Db, &comments, id, claims.Role == auth.RoleAdmin); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": comments})
+}
+
+type OrderCommentRecordInput struct {
+	Body       string `json:"body" binding:"required"`
+	Visibility string `json:"visibility" binding:"omitempty,oneof=internal shared"`
+}
+
+func (repository *OrderRepo) SaveOrderCommentData(c *gin.Context) {
+
+	var input OrderCommentRecordInput
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims, err := auth.ExtractTokenClaims(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.Visibility == "" {
+		input.Visibility = models.OrderCommentShared
+	}
+
+	if input.Visibility == models.OrderCommentInternal && claims.Role != auth.RoleAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only admins can post internal comments"})
+		return
+	}
+
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	o := models.Order{}
+
+	if !repository.commentOrder(c, claims, &o, id) {
+		return
+	}
+
+	comment := models.OrderComment{}
+
+	comment.OrderCommentOrderId = int(o.ID)
+	comment.OrderCommentAuthorId = claims.ID
+	comment.OrderCommentAuthorRole = claims.Role
+	comment.OrderCommentVisibility = input.Visibility
+	comment.OrderCommentBody = input.Body
+
+	if err := models.CreateOrderComment(repository.Db, &comment); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Comment save successfully", "data": comment})
+}
+
+// comment with the bodies it had before each edit
+func (repository *OrderRepo) GetOrderCommentById(c *gin.Context) {
+
+	claims, err := auth.ExtractTokenClaims(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	comment := models.OrderComment{}
+
+	if !repository.accessibleComment(c, claims, &comment) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success", "data": comment})
+}
+
+type OrderCommentUpdateInput struct {
+	Body string `json:"body" binding:"required"`
+}
+
+// only the author edits a comment
+func (repository *OrderRepo) UpdateOrderComment(c *gin.Context) {
+	var input OrderCommentUpdateInput
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims, err := auth.ExtractTokenClaims(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	comment := models.OrderComment{}
+
+	if !repository.accessibleComment(c, claims, &comment) {
+		return
+	}
+
+	if comment.OrderCommentAuthorId != claims.ID || comment.OrderCommentAuthorRole != claims.Role {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only the author can edit the comment"})
+		return
+	}
+
+	if err := models.EditOrderComment(repository.Db, &comment, input.Body, claims.ID, time.Now()); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success", "data": comment})
+}
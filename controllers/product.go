@@ -3,40 +3,181 @@ package controllers
 import (
 	"be-dbo-golang/database"
 	"be-dbo-golang/models"
+	"be-dbo-golang/utils/export"
+	"be-dbo-golang/utils/filter"
+	"be-dbo-golang/utils/money"
 	"be-dbo-golang/utils/pagination"
+	"be-dbo-golang/utils/search"
 	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
 type ProductRepo struct {
-	Db *gorm.DB
+	Db     *gorm.DB
+	Search search.Index
 }
 
 func NewProduct() *ProductRepo {
 	db := database.InitDb()
-	db.AutoMigrate(&models.Product{})
-	return &ProductRepo{Db: db}
+	db.AutoMigrate(&models.Product{}, &models.ProductVariant{}, &models.ProductVariantOption{}, &models.ProductImage{}, &models.ProductImageThumbnail{}, &models.ProductPriceChange{}, &models.StockMovement{}, &models.Warehouse{}, &models.WarehouseStock{}, &models.WarehouseTransfer{}, &models.StockAlert{})
+	database.MigrateMoneyColumn(db, "products", "product_price", "product_price_")
+	database.AddForeignKey(db, "products", "product_supplier_id", "suppliers")
+	database.AddForeignKey(db, "products", "product_brand_id", "brands")
+	database.AddForeignKey(db, "product_price_changes", "product_price_change_product_id", "products")
+	if err := models.BackfillPriceHistory(db); err != nil {
+		log.Printf("backfill price history: %v", err)
+	}
+	database.AddForeignKey(db, "stock_movements", "stock_movement_product_id", "products")
+	if err := models.BackfillStockMovements(db); err != nil {
+		log.Printf("backfill stock movements: %v", err)
+	}
+	database.AddForeignKey(db, "warehouse_stocks", "warehouse_stock_warehouse_id", "warehouses")
+	database.AddForeignKey(db, "warehouse_stocks", "warehouse_stock_product_id", "products")
+	database.AddForeignKey(db, "warehouse_transfers", "warehouse_transfer_from_id", "warehouses")
+	database.AddForeignKey(db, "warehouse_transfers", "warehouse_transfer_to_id", "warehouses")
+	database.AddForeignKey(db, "warehouse_transfers", "warehouse_transfer_product_id", "products")
+	if err := models.BackfillWarehouseStock(db); err != nil {
+		log.Printf("backfill warehouse stock: %v", err)
+	}
+	models.WarehouseAllocationStrategy = warehouseAllocationStrategy()
+	database.AddForeignKey(db, "stock_alerts", "stock_alert_product_id", "products")
+
+	index := search.NewMemory(models.ProductSearchWeights)
+	if err := models.IndexProducts(db, index); err != nil {
+		log.Printf("index products: %v", err)
+	}
+	return &ProductRepo{Db: db, Search: index}
+}
+
+// keep the search index in step with the product, a failure only leaves the index stale
+func (repository *ProductRepo) reindexProduct(p models.Product) {
+	doc, err := models.ProductSearchDocument(repository.Db, p)
+	if err == nil {
+		err = repository.Search.Upsert(doc)
+	}
+	if err != nil {
+		log.Printf("index product %d: %v", p.ID, err)
+	}
 }
 
 type ProductResponse struct {
-	ID         uint    `json:"id"`
-	Name       string  `json:"name"`
-	BrandId    int     `json:"brand_id"`
-	Price      float64 `json:"price"`
-	Stock      int     `json:"stock"`
-	SupplierId int     `json:"supplier_id"`
+	ID             uint                     `json:"id"`
+	Name           string                   `json:"name"`
+	Description    string                   `json:"description"`
+	BrandId        int                      `json:"brand_id"`
+	Price          money.Money              `json:"price"`
+	Stock          int                      `json:"stock"`
+	SupplierId     int                      `json:"supplier_id"`
+	TaxCategory    string                   `json:"tax_category"`
+	Backorderable  bool                     `json:"backorderable"`
+	Preorderable   bool                     `json:"preorderable"`
+	BackorderLimit int                      `json:"backorder_limit"`
+	AvailableAt    *time.Time               `json:"available_at"`
+	ReorderPoint   int                      `json:"reorder_point"`
+	ReorderQty     int                      `json:"reorder_qty"`
+	CategoryIds    []int                    `json:"category_ids"`
+	Variants       []ProductVariantResponse `json:"variants"`
+	Images         []ProductImageResponse   `json:"images"`
+	Warehouses     []WarehouseStockResponse `json:"warehouses"`
+}
+
+type ProductVariantResponse struct {
+	ID            uint                     `json:"id"`
+	Sku           string                   `json:"sku"`
+	Options       map[string]string        `json:"options"`
+	Price         money.Money              `json:"price"`
+	PriceOverride bool                     `json:"price_override"`
+	Stock         int                      `json:"stock"`
+	Warehouses    []WarehouseStockResponse `json:"warehouses"`
+}
+
+func productVariantResponse(p models.Product, v models.ProductVariant) ProductVariantResponse {
+	options := map[string]string{}
+	for _, option := range v.ProductVariantOptions {
+		options[option.ProductVariantOptionName] = option.ProductVariantOptionValue
+	}
+
+	return ProductVariantResponse{
+		ID:            v.ID,
+		Sku:           v.ProductVariantSku,
+		Options:       options,
+		Price:         v.UnitPrice(p),
+		PriceOverride: v.HasPrice(),
+		Stock:         v.ProductVariantStock,
+		Warehouses:    warehouseStockResponses(p.ProductWarehouseStocks, int(v.ID)),
+	}
+}
+
+func productResponse(p models.Product) ProductResponse {
+	categoryIds := []int{}
+	for _, category := range p.ProductCategories {
+		categoryIds = append(categoryIds, int(category.ID))
+	}
+
+	variants := []ProductVariantResponse{}
+	for _, variant := range p.ProductVariants {
+		variants = append(variants, productVariantResponse(p, variant))
+	}
+
+	images := []ProductImageResponse{}
+	for _, image := range p.ProductImages {
+		images = append(images, productImageResponse(image))
+	}
+
+	return ProductResponse{
+		ID:             p.ID,
+		Name:           p.ProductName,
+		Description:    p.ProductDescription,
+		BrandId:        p.ProductBrandId,
+		Stock:          p.ProductStock,
+		Price:          p.ProductPrice,
+		SupplierId:     p.ProductSupplierId,
+		TaxCategory:    p.ProductTaxCategory,
+		Backorderable:  p.ProductBackorderable,
+		Preorderable:   p.ProductPreorderable,
+		BackorderLimit: p.ProductBackorderLimit,
+		AvailableAt:    p.ProductAvailableAt,
+		ReorderPoint:   p.ProductReorderPoint,
+		ReorderQty:     p.ProductReorderQty,
+		CategoryIds:    categoryIds,
+		Variants:       variants,
+		Images:         images,
+		Warehouses:     warehouseStockResponses(p.ProductWarehouseStocks, 0),
+	}
+}
+
+// add an error for every category that doesn't exist
+func checkCategories(db *gorm.DB, errs fieldErrors, categoryIds []int) error {
+	for i, categoryId := range categoryIds {
+		if err := errs.checkExists(db, fmt.Sprintf("category_ids[%d]", i), &models.Category{}, categoryId, "category not found"); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 type ProductRecordInput struct {
-	Name       string  `json:"name" binding:"required"`
-	BrandId    int     `json:"brand_id" binding:"required"`
-	Price      float64 `json:"price" binding:"required"`
-	Stock      int     `json:"stock" binding:"required"`
-	SupplierId int     `json:"supplier_id" binding:"required"`
+	Name           string       `json:"name" binding:"required"`
+	Description    string       `json:"description"`
+	BrandId        int          `json:"brand_id" binding:"required"`
+	Price          *money.Money `json:"price" binding:"required"`
+	Stock          int          `json:"stock" binding:"required"`
+	SupplierId     int          `json:"supplier_id" binding:"required"`
+	TaxCategory    string       `json:"tax_category"`
+	Backorderable  bool         `json:"backorderable"`
+	Preorderable   bool         `json:"preorderable"`
+	BackorderLimit int          `json:"backorder_limit" binding:"gte=0"`
+	AvailableAt    *time.Time   `json:"available_at"`
+	ReorderPoint   int          `json:"reorder_point" binding:"gte=0"`
+	ReorderQty     int          `json:"reorder_qty" binding:"gte=0"`
+	CategoryIds    []int        `json:"category_ids"`
 }
 
 func (repository *ProductRepo) SaveProductData(c *gin.Context) {
@@ -48,13 +189,57 @@ func (repository *ProductRepo) SaveProductData(c *gin.Context) {
 		return
 	}
 
+	if input.Price.IsNegative() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "price can't be negative"})
+		return
+	}
+
+	errs := fieldErrors{}
+
+	if err := errs.checkExists(repository.Db, "brand_id", &models.Brand{}, input.BrandId, "brand not found"); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	if err := errs.checkExists(repository.Db, "supplier_id", &models.Supplier{}, input.SupplierId, "supplier not found"); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	if err := checkCategories(repository.Db, errs, input.CategoryIds); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	if errs.abort(c) {
+		return
+	}
+
 	p := models.Product{}
 
 	p.ProductName = input.Name
+	p.ProductDescription = input.Description
 	p.ProductBrandId = input.BrandId
 	p.ProductStock = input.Stock
-	p.ProductPrice = input.Price
+	p.ProductPrice = *input.Price
 	p.ProductSupplierId = input.SupplierId
+	p.ProductTaxCategory = input.TaxCategory
+	p.ProductBackorderable = input.Backorderable
+	p.ProductPreorderable = input.Preorderable
+	p.ProductBackorderLimit = input.BackorderLimit
+	p.ProductAvailableAt = input.AvailableAt
+	p.ProductReorderPoint = input.ReorderPoint
+	p.ProductReorderQty = input.ReorderQty
+
+	if p.ProductTaxCategory == "" {
+		p.ProductTaxCategory = models.DefaultTaxCategory
+	}
+
+	// the first price starts the price history
+	change, ok := priceChange(c, 0, p.ProductPrice, "initial price")
+	if !ok {
+		return
+	}
 
 	err := models.CreateProduct(repository.Db, &p)
 
@@ -63,6 +248,20 @@ func (repository *ProductRepo) SaveProductData(c *gin.Context) {
 		c.Abort()
 		return
 	}
+
+	if err := models.SetProductCategories(repository.Db, &p, input.CategoryIds); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	change.ProductPriceChangeProductId = int(p.ID)
+	if err := models.ChangeProductPrice(repository.Db, &change, p.CreatedAt); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	repository.reindexProduct(p)
+
 	c.JSON(http.StatusCreated, gin.H{"message": "Product registration success", "id": p.ID, "name": p.ProductName})
 
 }
@@ -73,29 +272,30 @@ func (repository *ProductRepo) GetProductById(c *gin.Context) {
 
 	p := models.Product{}
 
-	if err := models.GetProductById(repository.Db, &p, id); err != nil {
+	if err := models.GetProductById(models.PreloadProductDetails(repository.Db), &p, id); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Product not found!"})
 		c.Abort()
 		return
 	}
 
-	var response ProductResponse
-	response.ID = p.ID
-	response.Name = p.ProductName
-	response.BrandId = p.ProductBrandId
-	response.Stock = p.ProductStock
-	response.Price = p.ProductPrice
-	response.SupplierId = p.ProductStock
-
-	c.JSON(http.StatusOK, gin.H{"message": "success", "data": response})
+	c.JSON(http.StatusOK, gin.H{"message": "success", "data": productResponse(p)})
 }
 
 type ProductUpdateInput struct {
-	Name       string  `json:"name"`
-	BrandId    int     `json:"brand_id"`
-	Price      float64 `json:"price"`
-	Stock      int     `json:"stock"`
-	SupplierId int     `json:"supplier_id"`
+	Name           string       `json:"name"`
+	Description    *string      `json:"description"`
+	BrandId        int          `json:"brand_id"`
+	Price          *money.Money `json:"price"`
+	PriceReason    string       `json:"price_reason" binding:"max=255"`
+	SupplierId     int          `json:"supplier_id"`
+	TaxCategory    string       `json:"tax_category"`
+	Backorderable  *bool        `json:"backorderable"`
+	Preorderable   *bool        `json:"preorderable"`
+	BackorderLimit *int         `json:"backorder_limit" binding:"omitempty,gte=0"`
+	AvailableAt    *time.Time   `json:"available_at"`
+	ReorderPoint   *int         `json:"reorder_point" binding:"omitempty,gte=0"`
+	ReorderQty     *int         `json:"reorder_qty" binding:"omitempty,gte=0"`
+	CategoryIds    *[]int       `json:"category_ids"`
 }
 
 func (repository *ProductRepo) UpdateProduct(c *gin.Context) {
@@ -126,46 +326,154 @@ func (repository *ProductRepo) UpdateProduct(c *gin.Context) {
 		p.ProductName = input.Name
 	}
 
-	if input.Price >= 0 {
-		p.ProductPrice = input.Price
+	if input.Description != nil {
+		p.ProductDescription = *input.Description
 	}
 
-	if input.Stock >= 0 {
-		p.ProductStock = input.Stock
+	// a new price is recorded in the price history
+	var change *models.ProductPriceChange
+	if input.Price != nil {
+		if input.Price.IsNegative() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "price can't be negative"})
+			return
+		}
+
+		if *input.Price != p.ProductPrice {
+			priced, ok := priceChange(c, id, *input.Price, input.PriceReason)
+			if !ok {
+				return
+			}
+			change = &priced
+		}
+		p.ProductPrice = *input.Price
 	}
 
+	errs := fieldErrors{}
+
 	if input.BrandId > 0 {
+		if err := errs.checkExists(repository.Db, "brand_id", &models.Brand{}, input.BrandId, "brand not found"); err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+			return
+		}
 		p.ProductBrandId = input.BrandId
 	}
 
 	if input.SupplierId > 0 {
+		if err := errs.checkExists(repository.Db, "supplier_id", &models.Supplier{}, input.SupplierId, "supplier not found"); err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+			return
+		}
 		p.ProductSupplierId = input.SupplierId
 	}
 
-	err = models.UpdateProduct(repository.Db, &p, id)
+	if input.CategoryIds != nil {
+		if err := checkCategories(repository.Db, errs, *input.CategoryIds); err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+			return
+		}
+	}
+
+	if errs.abort(c) {
+		return
+	}
+
+	if input.TaxCategory != "" {
+		p.ProductTaxCategory = input.TaxCategory
+	}
+
+	if input.Backorderable != nil {
+		p.ProductBackorderable = *input.Backorderable
+	}
+
+	if input.Preorderable != nil {
+		p.ProductPreorderable = *input.Preorderable
+	}
+
+	if input.BackorderLimit != nil {
+		p.ProductBackorderLimit = *input.BackorderLimit
+	}
+
+	if input.AvailableAt != nil {
+		p.ProductAvailableAt = input.AvailableAt
+	}
+
+	if input.ReorderPoint != nil {
+		p.ProductReorderPoint = *input.ReorderPoint
+	}
+
+	if input.ReorderQty != nil {
+		p.ProductReorderQty = *input.ReorderQty
+	}
+
+	// every change is written in one transaction, so a failing step doesn't leave the price or the stock half done
+	err = repository.Db.Transaction(func(tx *gorm.DB) error {
+		if change != nil {
+			if err := models.ChangeProductPrice(tx, change, time.Now()); err != nil {
+				return err
+			}
+		}
+
+		if err := models.UpdateProduct(tx, &p, id); err != nil {
+			return err
+		}
+
+		if err := models.UpdateProductBackorder(tx, &p, id); err != nil {
+			return err
+		}
+
+		if input.ReorderPoint != nil || input.ReorderQty != nil {
+			if err := models.UpdateProductReorder(tx, &p, id); err != nil {
+				return err
+			}
+		}
+
+		if input.CategoryIds != nil {
+			if err := models.SetProductCategories(tx, &p, *input.CategoryIds); err != nil {
+				return err
+			}
+		}
+
+		// waiting backorders are allocated again against the updated product
+		return models.AllocateBackorders(tx, id)
+	})
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
 		return
 	}
 
-	var response ProductResponse
-	response.ID = p.ID
-	response.Name = p.ProductName
-	response.BrandId = p.ProductBrandId
-	response.Stock = p.ProductStock
-	response.Price = p.ProductPrice
-	response.SupplierId = p.ProductStock
+	p = models.Product{}
+	if err := models.GetProductById(models.PreloadProductDetails(repository.Db), &p, id); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	repository.reindexProduct(p)
 
-	c.JSON(http.StatusOK, response)
+	c.JSON(http.StatusOK, productResponse(p))
 }
 
 func (repository *ProductRepo) GetProductsData(c *gin.Context) {
 
-	page, pageSize, sortField, sortOrder := pagination.Paginate(c)
+	page, pageSize, orderBy, err := pagination.Paginate(c, models.ProductSorts)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	f, err := filter.Parse(c.Request.URL.Query(), models.ProductFilters)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if format := export.RequestedFormat(c); format != "" {
+		repository.exportProducts(c, f.Apply(repository.Db), format, orderBy)
+		return
+	}
 
 	var s models.Product
 
-	Products, totalPages, err := s.GetProductsPaginate(repository.Db, page, pageSize, sortField, sortOrder)
+	Products, totalPages, err := s.GetProductsPaginate(f.Apply(models.PreloadProductDetails(repository.Db)), page, pageSize, orderBy)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Product not found!"})
 		c.Abort()
@@ -174,15 +482,7 @@ func (repository *ProductRepo) GetProductsData(c *gin.Context) {
 
 	var responses []ProductResponse
 	for _, Product := range Products {
-		response := ProductResponse{
-			ID:         Product.ID,
-			Name:       Product.ProductName,
-			BrandId:    Product.ProductBrandId,
-			Stock:      Product.ProductStock,
-			Price:      Product.ProductPrice,
-			SupplierId: Product.ProductStock,
-		}
-		responses = append(responses, response)
+		responses = append(responses, productResponse(Product))
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -191,6 +491,37 @@ func (repository *ProductRepo) GetProductsData(c *gin.Context) {
 	})
 }
 
+// stream every product as a csv or xlsx file
+func (repository *ProductRepo) exportProducts(c *gin.Context, db *gorm.DB, format, orderBy string) {
+	header := []string{"id", "name", "brand_id", "supplier_id", "stock", "currency", "price", "tax_category", "backorderable", "preorderable", "backorder_limit", "created_at"}
+
+	var s models.Product
+
+	err := export.Stream(c, format, "products", header, func(write func([]string) error) error {
+		return s.EachProduct(db, orderBy, func(p models.Product) error {
+			return write([]string{
+				strconv.Itoa(int(p.ID)),
+				p.ProductName,
+				strconv.Itoa(p.ProductBrandId),
+				strconv.Itoa(p.ProductSupplierId),
+				strconv.Itoa(p.ProductStock),
+				p.ProductPrice.Currency,
+				p.ProductPrice.Amount(),
+				p.ProductTaxCategory,
+				strconv.FormatBool(p.ProductBackorderable),
+				strconv.FormatBool(p.ProductPreorderable),
+				strconv.Itoa(p.ProductBackorderLimit),
+				p.CreatedAt.Format(time.RFC3339),
+			})
+		})
+	})
+
+	if err != nil {
+		c.Error(err)
+		c.Abort()
+	}
+}
+
 func (repository *ProductRepo) DeleteProduct(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
 
@@ -208,5 +539,62 @@ func (repository *ProductRepo) DeleteProduct(c *gin.Context) {
 		return
 	}
 
+	if err := repository.Search.Delete(id); err != nil {
+		log.Printf("unindex product %d: %v", id, err)
+	}
+
 	c.JSON(http.StatusCreated, gin.H{"message": "data deleted"})
 }
+
+type ProductSearchResponse struct {
+	ProductResponse
+	Score      float64           `json:"score"`
+	Highlights map[string]string `json:"highlights"`
+}
+
+// products matching the words of q in the name, brand or description, best matches first
+func (repository *ProductRepo) SearchProducts(c *gin.Context) {
+	query := c.Query("q")
+	if query == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q is required"})
+		return
+	}
+
+	page, pageSize := pagination.Page(c)
+
+	hits, count, err := repository.Search.Search(query, pageSize, (page-1)*pageSize)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	ids := []int{}
+	for _, hit := range hits {
+		ids = append(ids, hit.ID)
+	}
+
+	products, err := models.GetProductsByIds(models.PreloadProductDetails(repository.Db), ids)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	byId := map[int]models.Product{}
+	for _, p := range products {
+		byId[int(p.ID)] = p
+	}
+
+	responses := []ProductSearchResponse{}
+	for _, hit := range hits {
+		p, ok := byId[hit.ID]
+		if !ok {
+			continue
+		}
+		responses = append(responses, ProductSearchResponse{ProductResponse: productResponse(p), Score: hit.Score, Highlights: hit.Highlights})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":       responses,
+		"totalPages": (count + pageSize - 1) / pageSize,
+	})
+}
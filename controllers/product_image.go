@@ -0,0 +1,328 @@
+package controllers
+
+import (
+	"be-dbo-golang/models"
+	"be-dbo-golang/utils/imaging"
+	"be-dbo-golang/utils/storage"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var errImageUnreadable = errors.New("image can't be read")
+
+// largest image upload accepted, in megabytes
+func productImageMaxSize() int64 {
+	size, err := strconv.Atoi(os.Getenv("PRODUCT_IMAGE_MAX_MB"))
+	if err != nil || size <= 0 {
+		size = 5 // Default 5 MB
+	}
+	return int64(size) << 20
+}
+
+type ProductImageThumbnailResponse struct {
+	Size   int    `json:"size"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	URL    string `json:"url"`
+}
+
+type ProductImageResponse struct {
+	ID          uint                            `json:"id"`
+	URL         string                          `json:"url"`
+	ContentType string                          `json:"content_type"`
+	Width       int                             `json:"width"`
+	Height      int                             `json:"height"`
+	SortOrder   int                             `json:"sort_order"`
+	Primary     bool                            `json:"primary"`
+	Thumbnails  []ProductImageThumbnailResponse `json:"thumbnails"`
+}
+
+func productImageResponse(i models.ProductImage) ProductImageResponse {
+	store := storage.Default()
+
+	thumbnails := []ProductImageThumbnailResponse{}
+	for _, thumbnail := range i.ProductImageThumbnails {
+		thumbnails = append(thumbnails, ProductImageThumbnailResponse{
+			Size:   thumbnail.ProductImageThumbnailSize,
+			Width:  thumbnail.ProductImageThumbnailWidth,
+			Height: thumbnail.ProductImageThumbnailHeight,
+			URL:    store.URL(thumbnail.ProductImageThumbnailKey),
+		})
+	}
+
+	return ProductImageResponse{
+		ID:          i.ID,
+		URL:         store.URL(i.ProductImageKey),
+		ContentType: i.ProductImageContentType,
+		Width:       i.ProductImageWidth,
+		Height:      i.ProductImageHeight,
+		SortOrder:   i.ProductImageSortOrder,
+		Primary:     i.ProductImageIsPrimary,
+		Thumbnails:  thumbnails,
+	}
+}
+
+// remove stored files, a failure only leaves an orphan file behind
+func deleteStoredFiles(keys []string) {
+	for _, key := range keys {
+		if err := storage.Default().Delete(key); err != nil {
+			log.Printf("delete %s: %v", key, err)
+		}
+	}
+}
+
+// store the image and a thumbnail for every configured size
+func storeProductImage(productId int, data []byte, contentType string) (models.ProductImage, error) {
+	store := storage.Default()
+	img := models.ProductImage{}
+
+	// the size is checked before decoding so a small file can't expand into a huge bitmap
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return img, fmt.Errorf("%w: %v", errImageUnreadable, err)
+	}
+	if config.Width*config.Height > 50_000_000 {
+		return img, fmt.Errorf("%w: more than 50 megapixels", errImageUnreadable)
+	}
+
+	decoded, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return img, fmt.Errorf("%w: %v", errImageUnreadable, err)
+	}
+
+	name := make([]byte, 16)
+	if _, err := rand.Read(name); err != nil {
+		return img, err
+	}
+	base := fmt.Sprintf("products/%d/%s", productId, hex.EncodeToString(name))
+
+	img.ProductImageProductId = productId
+	img.ProductImageKey = base + "." + imaging.ContentTypes[contentType]
+	img.ProductImageContentType = contentType
+	img.ProductImageSize = int64(len(data))
+	img.ProductImageWidth = decoded.Bounds().Dx()
+	img.ProductImageHeight = decoded.Bounds().Dy()
+
+	if err := store.Put(img.ProductImageKey, bytes.NewReader(data)); err != nil {
+		return img, err
+	}
+
+	for _, size := range imaging.ThumbnailSizes() {
+		thumbnail := imaging.Fit(decoded, size)
+
+		var buf bytes.Buffer
+		if err := imaging.Encode(&buf, thumbnail, format); err != nil {
+			deleteStoredFiles(img.Keys())
+			return img, err
+		}
+
+		key := fmt.Sprintf("%s_%d.%s", base, size, imaging.OutputFormat(format))
+		if err := store.Put(key, &buf); err != nil {
+			deleteStoredFiles(img.Keys())
+			return img, err
+		}
+
+		img.ProductImageThumbnails = append(img.ProductImageThumbnails, models.ProductImageThumbnail{
+			ProductImageThumbnailSize:   size,
+			ProductImageThumbnailKey:    key,
+			ProductImageThumbnailWidth:  thumbnail.Bounds().Dx(),
+			ProductImageThumbnailHeight: thumbnail.Bounds().Dy(),
+		})
+	}
+
+	return img, nil
+}
+
+// load an image of the product in the url
+func (repository *ProductRepo) productImage(c *gin.Context, img *models.ProductImage) bool {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	if err := models.GetProductImageById(repository.Db, img, id); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.AbortWithStatus(http.StatusNotFound)
+			return false
+		}
+
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return false
+	}
+
+	return true
+}
+
+// upload a jpeg, png or gif image of the product as multipart form field "image"
+func (repository *ProductRepo) UploadProductImage(c *gin.Context) {
+	maxSize := productImageMaxSize()
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize+1<<20)
+
+	file, err := c.FormFile("image")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "image file is required"})
+		return
+	}
+
+	if file.Size > maxSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("image can't be larger than %d MB", maxSize>>20)})
+		return
+	}
+
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	p := models.Product{}
+
+	if err := models.GetProductById(repository.Db, &p, id); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, maxSize+1))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	// the type comes from the content, not from what the client claims
+	contentType := http.DetectContentType(data)
+	if _, ok := imaging.ContentTypes[contentType]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "image must be a jpeg, png or gif", "content_type": contentType})
+		return
+	}
+
+	img, err := storeProductImage(id, data, contentType)
+	if err != nil {
+		if errors.Is(err, errImageUnreadable) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	img.ProductImageIsPrimary = c.PostForm("primary") == "true"
+
+	if err := models.CreateProductImage(repository.Db, &img); err != nil {
+		deleteStoredFiles(img.Keys())
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Image upload success", "data": productImageResponse(img)})
+}
+
+type ProductImageUpdateInput struct {
+	SortOrder *int  `json:"sort_order"`
+	Primary   *bool `json:"primary"`
+}
+
+func (repository *ProductRepo) UpdateProductImage(c *gin.Context) {
+	var input ProductImageUpdateInput
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	img := models.ProductImage{}
+
+	if !repository.productImage(c, &img) {
+		return
+	}
+
+	if input.SortOrder != nil {
+		img.ProductImageSortOrder = *input.SortOrder
+	}
+
+	// another image has to be made primary instead of unsetting it
+	if input.Primary != nil && *input.Primary {
+		img.ProductImageIsPrimary = true
+	}
+
+	if err := models.UpdateProductImage(repository.Db, &img); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success", "data": productImageResponse(img)})
+}
+
+type ProductImageReorderInput struct {
+	ImageIds []int `json:"image_ids" binding:"required,min=1"`
+}
+
+// set the order of the product images
+func (repository *ProductRepo) ReorderProductImages(c *gin.Context) {
+	var input ProductImageReorderInput
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	if err := models.ReorderProductImages(repository.Db, id, input.ImageIds); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+
+		if errors.Is(err, models.ErrProductImageNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	p := models.Product{}
+
+	if err := models.GetProductById(models.PreloadProductDetails(repository.Db), &p, id); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success", "data": productResponse(p)})
+}
+
+func (repository *ProductRepo) DeleteProductImage(c *gin.Context) {
+	img := models.ProductImage{}
+
+	if !repository.productImage(c, &img) {
+		return
+	}
+
+	if err := models.DeleteProductImage(repository.Db, &img); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	deleteStoredFiles(img.Keys())
+
+	c.JSON(http.StatusCreated, gin.H{"message": "data deleted"})
+}
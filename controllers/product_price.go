@@ -0,0 +1,196 @@
+package controllers
+
+import (
+	"be-dbo-golang/models"
+	"be-dbo-golang/utils/auth"
+	"be-dbo-golang/utils/money"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// minutes between two checks for due price changes
+func priceSchedulerInterval() time.Duration {
+	interval, err := strconv.Atoi(os.Getenv("PRICE_SCHEDULER_MINUTE_INTERVAL"))
+	if err != nil || interval <= 0 {
+		interval = 1 // Default 1 minute
+	}
+	return time.Minute * time.Duration(interval)
+}
+
+// apply scheduled price changes in the background
+func (repository *ProductRepo) StartPriceScheduler() {
+	run := func(now time.Time) {
+		if err := models.ApplyDuePriceChanges(repository.Db, now); err != nil {
+			log.Printf("price scheduler: %v", err)
+		}
+	}
+
+	go func() {
+		run(time.Now())
+
+		ticker := time.NewTicker(priceSchedulerInterval())
+		defer ticker.Stop()
+
+		for now := range ticker.C {
+			run(now)
+		}
+	}()
+}
+
+// price change made by the logged in user
+func priceChange(c *gin.Context, productId int, price money.Money, reason string) (models.ProductPriceChange, bool) {
+	change := models.ProductPriceChange{}
+
+	claims, err := auth.ExtractTokenClaims(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return change, false
+	}
+
+	change.ProductPriceChangeProductId = productId
+	change.ProductPriceChangePrice = price
+	change.ProductPriceChangeActorId = claims.ID
+	change.ProductPriceChangeActorRole = claims.Role
+	change.ProductPriceChangeReason = reason
+
+	return change, true
+}
+
+// every price the product had and has planned, the latest first
+func (repository *ProductRepo) GetProductPriceHistory(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	if exists, err := models.RecordExists(repository.Db, &models.Product{}, id); err != nil || !exists {
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+			return
+		}
+
+		c.JSON(http.StatusNotFound, gin.H{"message": "Product not found!"})
+		c.Abort()
+		return
+	}
+
+	var changes []models.ProductPriceChange
+
+	if err := models.GetProductPriceChanges(repository.Db, &changes, id); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": changes})
+}
+
+// price of the product at the RFC 3339 time in "at", now when it isn't given
+func (repository *ProductRepo) GetProductPriceAt(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	at := time.Now()
+	if value := c.Query("at"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "at must be an RFC 3339 timestamp"})
+			return
+		}
+		at = parsed
+	}
+
+	change := models.ProductPriceChange{}
+
+	if err := models.GetProductPriceAt(repository.Db, &change, id, at); err != nil {
+		if errors.Is(err, models.ErrNoPriceAt) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		}
+
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success", "data": gin.H{
+		"product_id":     id,
+		"at":             at,
+		"price":          change.ProductPriceChangePrice,
+		"effective_from": change.ProductPriceChangeEffectiveFrom,
+		"effective_to":   change.ProductPriceChangeEffectiveTo,
+		"change_id":      change.ID,
+	}})
+}
+
+type ProductPriceScheduleInput struct {
+	Price         *money.Money `json:"price" binding:"required"`
+	EffectiveFrom *time.Time   `json:"effective_from" binding:"required"`
+	Reason        string       `json:"reason" binding:"max=255"`
+}
+
+// plan a price for the product from a future time
+func (repository *ProductRepo) ScheduleProductPrice(c *gin.Context) {
+	var input ProductPriceScheduleInput
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.Price.IsNegative() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "price can't be negative"})
+		return
+	}
+
+	if !input.EffectiveFrom.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "effective_from must be in the future"})
+		return
+	}
+
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	change, ok := priceChange(c, id, *input.Price, input.Reason)
+	if !ok {
+		return
+	}
+	change.ProductPriceChangeScheduledAt = input.EffectiveFrom
+
+	if err := models.ScheduleProductPrice(repository.Db, &change); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Price change scheduled", "data": change})
+}
+
+// cancel a scheduled price change
+func (repository *ProductRepo) CancelProductPriceChange(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	change := models.ProductPriceChange{}
+
+	if err := models.CancelProductPriceChange(repository.Db, &change, id); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+
+		if errors.Is(err, models.ErrPriceChangeNotScheduled) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success", "data": change})
+}
@@ -0,0 +1,188 @@
+package controllers
+
+import (
+	"be-dbo-golang/models"
+	"be-dbo-golang/utils/money"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type ProductVariantOptionInput struct {
+	Name  string `json:"name" binding:"required"`
+	Value string `json:"value" binding:"required"`
+}
+
+func variantOptions(inputs []ProductVariantOptionInput) []models.ProductVariantOption {
+	options := []models.ProductVariantOption{}
+	for _, input := range inputs {
+		options = append(options, models.ProductVariantOption{ProductVariantOptionName: input.Name, ProductVariantOptionValue: input.Value})
+	}
+	return options
+}
+
+// reply to an error of a variant change
+func productVariantError(c *gin.Context, err error) {
+	if errors.Is(err, models.ErrVariantOptionsTaken) || errors.Is(err, models.ErrVariantSkuTaken) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+}
+
+// reply with the product and its variants after stock changes reached waiting backorders
+func (repository *ProductRepo) variantResponse(c *gin.Context, status int, productId int) {
+	if err := models.AllocateBackorders(repository.Db, productId); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	p := models.Product{}
+
+	if err := models.GetProductById(models.PreloadProductDetails(repository.Db), &p, productId); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(status, gin.H{"message": "success", "data": productResponse(p)})
+}
+
+type ProductVariantRecordInput struct {
+	Sku     string                      `json:"sku" binding:"required"`
+	Options []ProductVariantOptionInput `json:"options" binding:"required,min=1,dive"`
+	Price   *money.Money                `json:"price"`
+	Stock   int                         `json:"stock" binding:"gte=0"`
+}
+
+func (repository *ProductRepo) SaveProductVariantData(c *gin.Context) {
+
+	var input ProductVariantRecordInput
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.Price != nil && input.Price.IsNegative() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "price can't be negative"})
+		return
+	}
+
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	v := models.ProductVariant{}
+
+	v.ProductVariantProductId = id
+	v.ProductVariantSku = input.Sku
+	v.ProductVariantOptions = variantOptions(input.Options)
+	v.ProductVariantStock = input.Stock
+	if input.Price != nil {
+		v.ProductVariantPrice = *input.Price
+	}
+
+	if err := models.CreateProductVariant(repository.Db, &v); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+
+		productVariantError(c, err)
+		return
+	}
+
+	repository.variantResponse(c, http.StatusCreated, id)
+}
+
+type ProductVariantUpdateInput struct {
+	Sku        string                      `json:"sku"`
+	Options    []ProductVariantOptionInput `json:"options" binding:"omitempty,min=1,dive"`
+	Price      *money.Money                `json:"price"`
+	ClearPrice bool                        `json:"clear_price"`
+	Stock      *int                        `json:"stock" binding:"omitempty,gte=0"`
+}
+
+func (repository *ProductRepo) UpdateProductVariant(c *gin.Context) {
+	var input ProductVariantUpdateInput
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	v := models.ProductVariant{}
+
+	err := models.GetProductVariantById(repository.Db, &v, id)
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	if input.Sku != "" {
+		v.ProductVariantSku = input.Sku
+	}
+
+	// the variant goes back to the product price when its own is cleared
+	if input.ClearPrice {
+		v.ProductVariantPrice = money.Money{}
+	}
+
+	if input.Price != nil {
+		if input.Price.IsNegative() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "price can't be negative"})
+			return
+		}
+		v.ProductVariantPrice = *input.Price
+	}
+
+	var options []models.ProductVariantOption
+	if input.Options != nil {
+		options = variantOptions(input.Options)
+	}
+
+	if err := models.UpdateProductVariant(repository.Db, &v, options); err != nil {
+		productVariantError(c, err)
+		return
+	}
+
+	// a new stock is a stock take in the stock ledger
+	if input.Stock != nil {
+		count, ok := stockMovement(c, v.ProductVariantProductId, int(v.ID), "variant update")
+		if !ok {
+			return
+		}
+
+		if err := models.CountStock(repository.Db, &count, *input.Stock); err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+			return
+		}
+	}
+
+	repository.variantResponse(c, http.StatusOK, v.ProductVariantProductId)
+}
+
+func (repository *ProductRepo) DeleteProductVariant(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	v := models.ProductVariant{}
+
+	err := models.DeleteProductVariant(repository.Db, &v, id)
+
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "data deleted"})
+}
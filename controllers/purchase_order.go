@@ -0,0 +1,399 @@
+package controllers
+
+import (
+	"be-dbo-golang/database"
+	"be-dbo-golang/models"
+	"be-dbo-golang/utils/auth"
+	"be-dbo-golang/utils/money"
+	"be-dbo-golang/utils/pagination"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type PurchaseOrderRepo struct {
+	Db *gorm.DB
+}
+
+func NewPurchaseOrder() *PurchaseOrderRepo {
+	db := database.InitDb()
+	db.AutoMigrate(&models.PurchaseOrder{}, &models.PurchaseOrderLine{}, &models.GoodsReceipt{}, &models.GoodsReceiptItem{})
+	return &PurchaseOrderRepo{Db: db}
+}
+
+func isPurchaseOrderError(err error) bool {
+	return errors.Is(err, models.ErrPurchaseOrderNotDraft) || errors.Is(err, models.ErrPurchaseOrderNotOpen) || errors.Is(err, models.ErrPurchaseOrderInvalidLine) || errors.Is(err, models.ErrPurchaseOrderQtyExceeded) || errors.Is(err, models.ErrPurchaseOrderNothingToReceive) || errors.Is(err, models.ErrPurchaseOrderProductSupplier)
+}
+
+// reply to an error of a purchase order change
+func purchaseOrderError(c *gin.Context, err error) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Product not found!"})
+		return
+	}
+
+	if isPurchaseOrderError(err) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+}
+
+// load the purchase order, suppliers only see their own once they were sent
+func (repository *PurchaseOrderRepo) accessiblePurchaseOrder(c *gin.Context, po *models.PurchaseOrder) bool {
+	claims, err := auth.ExtractTokenClaims(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return false
+	}
+
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	if err := models.GetPurchaseOrderById(repository.Db, po, id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Purchase order not found!"})
+		return false
+	}
+
+	if claims.Role == auth.RoleSupplier && (po.PurchaseOrderSupplierId != claims.ID || po.PurchaseOrderStatus == models.PurchaseOrderStatusDraft) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Purchase order not found!"})
+		return false
+	}
+
+	return true
+}
+
+type PurchaseOrderLineInput struct {
+	ProductId int          `json:"product_id" binding:"required"`
+	Qty       int          `json:"quantity" binding:"required,gt=0"`
+	UnitCost  *money.Money `json:"unit_cost"`
+}
+
+func purchaseOrderLines(inputs []PurchaseOrderLineInput) []models.PurchaseOrderLine {
+	lines := []models.PurchaseOrderLine{}
+	for _, input := range inputs {
+		line := models.PurchaseOrderLine{
+			PurchaseOrderLineProductId: input.ProductId,
+			PurchaseOrderLineQty:       input.Qty,
+			PurchaseOrderLineUnitCost:  money.Zero(money.DefaultCurrency()),
+		}
+		if input.UnitCost != nil {
+			line.PurchaseOrderLineUnitCost = *input.UnitCost
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+type PurchaseOrderRecordInput struct {
+	SupplierId         int                      `json:"supplier_id" binding:"required"`
+	ExpectedDeliveryAt *time.Time               `json:"expected_delivery_at"`
+	Note               string                   `json:"note" binding:"max=255"`
+	Lines              []PurchaseOrderLineInput `json:"lines" binding:"required,min=1,dive"`
+}
+
+func (repository *PurchaseOrderRepo) SavePurchaseOrderData(c *gin.Context) {
+
+	var input PurchaseOrderRecordInput
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	adminId, _, err := auth.ExtractTokenID(c)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	po := models.PurchaseOrder{}
+
+	po.PurchaseOrderSupplierId = input.SupplierId
+	po.PurchaseOrderAdminId = adminId
+	po.PurchaseOrderStatus = models.PurchaseOrderStatusDraft
+	po.PurchaseOrderExpectedDeliveryAt = input.ExpectedDeliveryAt
+	po.PurchaseOrderNote = input.Note
+	po.PurchaseOrderLines = purchaseOrderLines(input.Lines)
+
+	if err := models.CreatePurchaseOrder(repository.Db, &po); err != nil {
+		purchaseOrderError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Purchase order save successfully", "data": po})
+}
+
+func (repository *PurchaseOrderRepo) GetPurchaseOrderById(c *gin.Context) {
+
+	po := models.PurchaseOrder{}
+
+	if !repository.accessiblePurchaseOrder(c, &po) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success", "data": po})
+}
+
+func (repository *PurchaseOrderRepo) GetPurchaseOrdersData(c *gin.Context) {
+
+	claims, err := auth.ExtractTokenClaims(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	var statuses []string
+	if status := c.Query("status"); status != "" {
+		statuses = strings.Split(status, ",")
+	}
+
+	supplierId, _ := strconv.Atoi(c.Query("supplier_id"))
+
+	// suppliers only get the purchase orders sent to them
+	if claims.Role == auth.RoleSupplier {
+		supplierId = claims.ID
+		if len(statuses) == 0 {
+			statuses = []string{models.PurchaseOrderStatusSent, models.PurchaseOrderStatusPartiallyReceived, models.PurchaseOrderStatusReceived, models.PurchaseOrderStatusClosed}
+		}
+		for _, status := range statuses {
+			if status == models.PurchaseOrderStatusDraft {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "draft purchase orders are not visible to suppliers"})
+				return
+			}
+		}
+	}
+
+	page, pageSize, orderBy, err := pagination.Paginate(c, models.PurchaseOrderSorts)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var po models.PurchaseOrder
+
+	PurchaseOrders, totalPages, err := po.GetPurchaseOrdersPaginate(repository.Db, supplierId, statuses, page, pageSize, orderBy)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Purchase order not found!"})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":       PurchaseOrders,
+		"totalPages": totalPages,
+	})
+}
+
+type PurchaseOrderUpdateInput struct {
+	ExpectedDeliveryAt *time.Time               `json:"expected_delivery_at"`
+	Note               *string                  `json:"note" binding:"omitempty,max=255"`
+	Lines              []PurchaseOrderLineInput `json:"lines" binding:"omitempty,min=1,dive"`
+}
+
+func (repository *PurchaseOrderRepo) UpdatePurchaseOrder(c *gin.Context) {
+	var input PurchaseOrderUpdateInput
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	po := models.PurchaseOrder{}
+
+	err := models.GetPurchaseOrderById(repository.Db, &po, id)
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	if input.ExpectedDeliveryAt != nil {
+		po.PurchaseOrderExpectedDeliveryAt = input.ExpectedDeliveryAt
+	}
+
+	if input.Note != nil {
+		po.PurchaseOrderNote = *input.Note
+	}
+
+	var lines []models.PurchaseOrderLine
+	if input.Lines != nil {
+		lines = purchaseOrderLines(input.Lines)
+	}
+
+	if err := models.UpdatePurchaseOrder(repository.Db, &po, lines); err != nil {
+		purchaseOrderError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, po)
+}
+
+func (repository *PurchaseOrderRepo) SendPurchaseOrder(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	po := models.PurchaseOrder{}
+
+	if err := models.GetPurchaseOrderById(repository.Db, &po, id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Purchase order not found!"})
+		return
+	}
+
+	if err := models.SendPurchaseOrder(repository.Db, &po, time.Now()); err != nil {
+		purchaseOrderError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Purchase order sent", "data": po})
+}
+
+func (repository *PurchaseOrderRepo) ClosePurchaseOrder(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	po := models.PurchaseOrder{}
+
+	if err := models.GetPurchaseOrderById(repository.Db, &po, id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Purchase order not found!"})
+		return
+	}
+
+	if err := models.ClosePurchaseOrder(repository.Db, &po, time.Now()); err != nil {
+		purchaseOrderError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Purchase order closed", "data": po})
+}
+
+func (repository *PurchaseOrderRepo) DeletePurchaseOrder(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	po := models.PurchaseOrder{}
+
+	err := models.DeletePurchaseOrder(repository.Db, &po, id)
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "data deleted"})
+}
+
+type GoodsReceiptItemInput struct {
+	LineId int `json:"purchase_order_line_id" binding:"required"`
+	Qty    int `json:"quantity" binding:"required,gt=0"`
+}
+
+type GoodsReceiptRecordInput struct {
+	ReceivedAt  *time.Time              `json:"received_at"`
+	WarehouseId int                     `json:"warehouse_id"`
+	Note        string                  `json:"note" binding:"max=255"`
+	Items       []GoodsReceiptItemInput `json:"items" binding:"omitempty,dive"`
+}
+
+// receive goods against the purchase order, every remaining line when no items are given
+func (repository *PurchaseOrderRepo) ReceivePurchaseOrder(c *gin.Context) {
+	var input GoodsReceiptRecordInput
+
+	// the body is optional, receiving everything now by default
+	if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	adminId, _, err := auth.ExtractTokenID(c)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	po := models.PurchaseOrder{}
+
+	if err := models.GetPurchaseOrderById(repository.Db, &po, id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Purchase order not found!"})
+		return
+	}
+
+	// goods go to the default warehouse when none is given
+	if input.WarehouseId != 0 {
+		errs := fieldErrors{}
+
+		if err := errs.checkExists(repository.Db, "warehouse_id", &models.Warehouse{}, input.WarehouseId, "warehouse not found"); err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+			return
+		}
+
+		if errs.abort(c) {
+			return
+		}
+	}
+
+	receipt := models.GoodsReceipt{}
+
+	receipt.GoodsReceiptPurchaseOrderId = id
+	receipt.GoodsReceiptAdminId = adminId
+	receipt.GoodsReceiptWarehouseId = input.WarehouseId
+	receipt.GoodsReceiptNote = input.Note
+	if input.ReceivedAt != nil {
+		receipt.GoodsReceiptReceivedAt = *input.ReceivedAt
+	}
+
+	for _, item := range input.Items {
+		receipt.GoodsReceiptItems = append(receipt.GoodsReceiptItems, models.GoodsReceiptItem{
+			GoodsReceiptItemLineId: item.LineId,
+			GoodsReceiptItemQty:    item.Qty,
+		})
+	}
+
+	if err := models.ReceivePurchaseOrder(repository.Db, &receipt); err != nil {
+		purchaseOrderError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Goods receipt save successfully", "data": receipt})
+}
+
+func (repository *PurchaseOrderRepo) GetGoodsReceiptsData(c *gin.Context) {
+
+	po := models.PurchaseOrder{}
+
+	if !repository.accessiblePurchaseOrder(c, &po) {
+		return
+	}
+
+	var receipts []models.GoodsReceipt
+
+	if err := models.GetGoodsReceiptsByPurchaseOrder(repository.Db, &receipts, int(po.ID)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Goods receipt not found!"})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":                  receipts,
+		"purchase_order_status": po.PurchaseOrderStatus,
+	})
+}
@@ -0,0 +1,249 @@
+package controllers
+
+import (
+	"be-dbo-golang/database"
+	"be-dbo-golang/models"
+	"be-dbo-golang/utils/auth"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type ShipmentRepo struct {
+	Db *gorm.DB
+}
+
+func NewShipment() *ShipmentRepo {
+	db := database.InitDb()
+	db.AutoMigrate(&models.Shipment{}, &models.ShipmentItem{})
+	return &ShipmentRepo{Db: db}
+}
+
+// load the order and make sure the caller is allowed to see it
+func (repository *ShipmentRepo) accessibleOrder(c *gin.Context, o *models.Order, id int) bool {
+	claims, err := auth.ExtractTokenClaims(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return false
+	}
+
+	if err := models.GetOrderById(repository.Db, o, id); err != nil || !orderAccessible(claims, o) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Order not found!"})
+		return false
+	}
+
+	return true
+}
+
+func isShipmentError(err error) bool {
+	return errors.Is(err, models.ErrShipmentNothingToShip) || errors.Is(err, models.ErrShipmentInvalidLine) || errors.Is(err, models.ErrShipmentQtyExceeded) || errors.Is(err, models.ErrOrderRejected)
+}
+
+type ShipmentItemInput struct {
+	OrderLineId int `json:"order_line_id" binding:"required"`
+	Qty         int `json:"quantity" binding:"required,gt=0"`
+}
+
+type ShipmentRecordInput struct {
+	OrderId        int                 `json:"order_id" binding:"required"`
+	Carrier        string              `json:"carrier" binding:"required"`
+	TrackingNumber string              `json:"tracking_number" binding:"required"`
+	ShippedAt      *time.Time          `json:"shipped_at"`
+	Items          []ShipmentItemInput `json:"items" binding:"omitempty,dive"`
+}
+
+func (repository *ShipmentRepo) SaveShipmentData(c *gin.Context) {
+
+	var input ShipmentRecordInput
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	o := models.Order{}
+
+	if !repository.accessibleOrder(c, &o, input.OrderId) {
+		return
+	}
+
+	s := models.Shipment{}
+
+	s.ShipmentOrderId = input.OrderId
+	s.ShipmentCarrier = input.Carrier
+	s.ShipmentTrackingNumber = input.TrackingNumber
+	s.ShipmentShippedAt = input.ShippedAt
+
+	for _, item := range input.Items {
+		s.ShipmentItems = append(s.ShipmentItems, models.ShipmentItem{
+			ShipmentItemOrderLineId: item.OrderLineId,
+			ShipmentItemQty:         item.Qty,
+		})
+	}
+
+	err := models.CreateShipment(repository.Db, &s)
+
+	if err != nil {
+		if isShipmentError(err) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		c.Abort()
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"message": "Shipment save successfully", "data": s})
+
+}
+
+func (repository *ShipmentRepo) GetShipmentById(c *gin.Context) {
+
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	s := models.Shipment{}
+
+	if err := models.GetShipmentById(repository.Db, &s, id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Shipment not found!"})
+		c.Abort()
+		return
+	}
+
+	o := models.Order{}
+
+	if !repository.accessibleOrder(c, &o, s.ShipmentOrderId) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success", "data": s})
+}
+
+func (repository *ShipmentRepo) GetOrderShipmentsData(c *gin.Context) {
+
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	o := models.Order{}
+
+	if !repository.accessibleOrder(c, &o, id) {
+		return
+	}
+
+	var shipments []models.Shipment
+
+	if err := models.GetShipmentsByOrder(repository.Db, &shipments, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Shipment not found!"})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":         shipments,
+		"order_status": o.OrderStatus,
+	})
+}
+
+type ShipmentUpdateInput struct {
+	Carrier        string `json:"carrier"`
+	TrackingNumber string `json:"tracking_number"`
+}
+
+func (repository *ShipmentRepo) UpdateShipment(c *gin.Context) {
+	var input ShipmentUpdateInput
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	s := models.Shipment{}
+
+	err := models.GetShipmentById(repository.Db, &s, id)
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	o := models.Order{}
+
+	if !repository.accessibleOrder(c, &o, s.ShipmentOrderId) {
+		return
+	}
+
+	if input.Carrier != "" {
+		s.ShipmentCarrier = input.Carrier
+	}
+
+	if input.TrackingNumber != "" {
+		s.ShipmentTrackingNumber = input.TrackingNumber
+	}
+
+	err = models.UpdateShipment(repository.Db, &s, id)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusOK, s)
+}
+
+type ShipmentDeliverInput struct {
+	DeliveredAt *time.Time `json:"delivered_at"`
+}
+
+func (repository *ShipmentRepo) DeliverShipment(c *gin.Context) {
+	var input ShipmentDeliverInput
+
+	// the body is optional, delivery defaults to now
+	if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	s := models.Shipment{}
+
+	err := models.GetShipmentById(repository.Db, &s, id)
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	o := models.Order{}
+
+	if !repository.accessibleOrder(c, &o, s.ShipmentOrderId) {
+		return
+	}
+
+	deliveredAt := time.Now()
+	if input.DeliveredAt != nil {
+		deliveredAt = *input.DeliveredAt
+	}
+
+	err = models.DeliverShipment(repository.Db, &s, deliveredAt)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusOK, s)
+}
@@ -0,0 +1,201 @@
+package controllers
+
+import (
+	"be-dbo-golang/database"
+	"be-dbo-golang/models"
+	"be-dbo-golang/utils/auth"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type ShippingAddressRepo struct {
+	Db *gorm.DB
+}
+
+func NewShippingAddress() *ShippingAddressRepo {
+	db := database.InitDb()
+	db.AutoMigrate(&models.ShippingAddress{})
+	return &ShippingAddressRepo{Db: db}
+}
+
+type AddressInput struct {
+	RecipientName string `json:"recipient_name" binding:"required"`
+	Phone         string `json:"phone"`
+	Line1         string `json:"line1" binding:"required"`
+	Line2         string `json:"line2"`
+	City          string `json:"city" binding:"required"`
+	Province      string `json:"province"`
+	PostalCode    string `json:"postal_code" binding:"required"`
+	Country       string `json:"country" binding:"required,len=2"`
+}
+
+func addressFromInput(input AddressInput) models.Address {
+	return models.Address{
+		RecipientName: input.RecipientName,
+		Phone:         input.Phone,
+		Line1:         input.Line1,
+		Line2:         input.Line2,
+		City:          input.City,
+		Province:      input.Province,
+		PostalCode:    input.PostalCode,
+		Country:       input.Country,
+	}
+}
+
+type ShippingAddressResponse struct {
+	ID      uint           `json:"id"`
+	Label   string         `json:"label"`
+	Address models.Address `json:"address"`
+}
+
+type ShippingAddressRecordInput struct {
+	Label   string       `json:"label"`
+	Address AddressInput `json:"address" binding:"required"`
+}
+
+func (repository *ShippingAddressRepo) SaveShippingAddressData(c *gin.Context) {
+
+	var input ShippingAddressRecordInput
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	customerId, _, err := auth.ExtractTokenID(c)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	a := models.ShippingAddress{}
+
+	a.ShippingAddressCustomerId = customerId
+	a.ShippingAddressLabel = input.Label
+	a.ShippingAddress = addressFromInput(input.Address)
+
+	err = models.CreateShippingAddress(repository.Db, &a)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		c.Abort()
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"message": "Shipping address save successfully", "id": a.ID})
+
+}
+
+func (repository *ShippingAddressRepo) GetShippingAddressesData(c *gin.Context) {
+
+	customerId, _, err := auth.ExtractTokenID(c)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var addresses []models.ShippingAddress
+
+	if err := models.GetShippingAddressesByCustomer(repository.Db, &addresses, customerId); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Shipping address not found!"})
+		c.Abort()
+		return
+	}
+
+	var responses []ShippingAddressResponse
+	for _, address := range addresses {
+		response := ShippingAddressResponse{
+			ID:      address.ID,
+			Label:   address.ShippingAddressLabel,
+			Address: address.ShippingAddress,
+		}
+		responses = append(responses, response)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": responses})
+}
+
+type ShippingAddressUpdateInput struct {
+	Label   string        `json:"label"`
+	Address *AddressInput `json:"address"`
+}
+
+func (repository *ShippingAddressRepo) UpdateShippingAddress(c *gin.Context) {
+	var input ShippingAddressUpdateInput
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	customerId, _, err := auth.ExtractTokenID(c)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	a := models.ShippingAddress{}
+
+	err = models.GetShippingAddressById(repository.Db, &a, id, customerId)
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	if input.Label != "" {
+		a.ShippingAddressLabel = input.Label
+	}
+
+	if input.Address != nil {
+		a.ShippingAddress = addressFromInput(*input.Address)
+	}
+
+	err = models.UpdateShippingAddress(repository.Db, &a, id)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	var response ShippingAddressResponse
+	response.ID = a.ID
+	response.Label = a.ShippingAddressLabel
+	response.Address = a.ShippingAddress
+
+	c.JSON(http.StatusOK, response)
+}
+
+func (repository *ShippingAddressRepo) DeleteShippingAddress(c *gin.Context) {
+	customerId, _, err := auth.ExtractTokenID(c)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	a := models.ShippingAddress{}
+
+	err = models.DeleteShippingAddress(repository.Db, &a, id, customerId)
+
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "data deleted"})
+}
@@ -0,0 +1,132 @@
+package controllers
+
+import (
+	"be-dbo-golang/models"
+	"be-dbo-golang/utils/auth"
+	"be-dbo-golang/utils/notify"
+	"be-dbo-golang/utils/pagination"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// minutes between two deliveries of new stock alerts
+func stockAlertInterval() time.Duration {
+	interval, err := strconv.Atoi(os.Getenv("STOCK_ALERT_MINUTE_INTERVAL"))
+	if err != nil || interval <= 0 {
+		interval = 1 // Default 1 minute
+	}
+	return time.Minute * time.Duration(interval)
+}
+
+// message telling the alert to the notifiers
+func stockAlertMessage(alert models.StockAlert, p models.Product) notify.Message {
+	item := p.ProductName
+	if alert.StockAlertVariantId > 0 {
+		item = fmt.Sprintf("%s (variant %d)", p.ProductName, alert.StockAlertVariantId)
+	}
+
+	return notify.Message{
+		Event:   "stock.low",
+		Subject: fmt.Sprintf("Low stock: %s", item),
+		Body:    fmt.Sprintf("%s is down to %d, the reorder point is %d. Reorder %d.", item, alert.StockAlertStock, alert.StockAlertReorderPoint, alert.StockAlertReorderQty),
+		Data: gin.H{
+			"alert_id":      alert.ID,
+			"product_id":    alert.StockAlertProductId,
+			"variant_id":    alert.StockAlertVariantId,
+			"supplier_id":   p.ProductSupplierId,
+			"stock":         alert.StockAlertStock,
+			"reorder_point": alert.StockAlertReorderPoint,
+			"reorder_qty":   alert.StockAlertReorderQty,
+			"raised_at":     alert.CreatedAt,
+		},
+	}
+}
+
+// deliver new stock alerts in the background, an alert is tried again later for the notifiers that failed, with a
+// growing delay between the attempts
+func (repository *ProductRepo) StartStockAlertNotifier() {
+	notifier := notify.Default()
+
+	run := func(now time.Time) {
+		var alerts []models.StockAlert
+		if err := models.GetUndeliveredStockAlerts(repository.Db, &alerts, now, 100); err != nil {
+			log.Printf("stock alerts: %v", err)
+			return
+		}
+
+		for _, alert := range alerts {
+			p := models.Product{}
+			if err := repository.Db.Unscoped().Where("id = ?", alert.StockAlertProductId).First(&p).Error; err != nil {
+				log.Printf("stock alert %d: %v", alert.ID, err)
+				continue
+			}
+
+			// notifiers that got the alert on an earlier run are skipped
+			delivered, err := notifier.NotifyPending(stockAlertMessage(alert, p), alert.DeliveredTo())
+			if len(delivered) > len(alert.DeliveredTo()) {
+				if err := models.MarkStockAlertDelivered(repository.Db, &alert, delivered); err != nil {
+					log.Printf("stock alert %d: %v", alert.ID, err)
+					continue
+				}
+			}
+			if err != nil {
+				log.Printf("stock alert %d: %v", alert.ID, err)
+				if err := models.MarkStockAlertFailed(repository.Db, &alert, now); err != nil {
+					log.Printf("stock alert %d: %v", alert.ID, err)
+				}
+				if alert.StockAlertGaveUpAt != nil {
+					log.Printf("stock alert %d: given up after %d attempts", alert.ID, alert.StockAlertAttempts)
+				}
+				continue
+			}
+
+			if err := models.MarkStockAlertNotified(repository.Db, &alert, now); err != nil {
+				log.Printf("stock alert %d: %v", alert.ID, err)
+			}
+		}
+	}
+
+	go func() {
+		run(time.Now())
+
+		ticker := time.NewTicker(stockAlertInterval())
+		defer ticker.Stop()
+
+		for now := range ticker.C {
+			run(now)
+		}
+	}()
+}
+
+// products and variants at or below their reorder point, suppliers only see their own products
+func (repository *ProductRepo) GetLowStockData(c *gin.Context) {
+	claims, err := auth.ExtractTokenClaims(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	supplierId := 0
+	if claims.Role == auth.RoleSupplier {
+		supplierId = claims.ID
+	}
+
+	page, pageSize := pagination.Page(c)
+
+	items, totalPages, err := models.GetLowStockPaginate(repository.Db, supplierId, page, pageSize)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":       items,
+		"totalPages": totalPages,
+	})
+}
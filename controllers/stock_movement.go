@@ -0,0 +1,211 @@
+package controllers
+
+import (
+	"be-dbo-golang/models"
+	"be-dbo-golang/utils/auth"
+	"be-dbo-golang/utils/pagination"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// stock movement of the product or variant made by the logged in user
+func stockMovement(c *gin.Context, productId, variantId int, note string) (models.StockMovement, bool) {
+	m := models.StockMovement{}
+
+	claims, err := auth.ExtractTokenClaims(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return m, false
+	}
+
+	m.StockMovementProductId = productId
+	m.StockMovementVariantId = variantId
+	m.StockMovementActorId = claims.ID
+	m.StockMovementActorRole = claims.Role
+	m.StockMovementNote = note
+
+	return m, true
+}
+
+// check the warehouse of a stock change exists, the default warehouse is used when none is given
+func (repository *ProductRepo) checkStockWarehouse(c *gin.Context, warehouseId int) bool {
+	if warehouseId == 0 {
+		return true
+	}
+
+	errs := fieldErrors{}
+
+	if err := errs.checkExists(repository.Db, "warehouse_id", &models.Warehouse{}, warehouseId, "warehouse not found"); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return false
+	}
+
+	return !errs.abort(c)
+}
+
+// reply to a manual stock change, stock that came in goes to waiting backorders first
+func (repository *ProductRepo) stockMovementResponse(c *gin.Context, err error, m models.StockMovement) {
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+
+		if errors.Is(err, models.ErrStockNegative) || errors.Is(err, models.ErrNoWarehouse) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	if err := models.AllocateBackorders(repository.Db, m.StockMovementProductId); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "success", "data": m})
+}
+
+type StockAdjustInput struct {
+	VariantId   int    `json:"variant_id" binding:"gte=0"`
+	WarehouseId int    `json:"warehouse_id" binding:"gte=0"`
+	Delta       int    `json:"delta" binding:"required"`
+	Reason      string `json:"reason" binding:"omitempty,oneof=adjustment return"`
+	Note        string `json:"note" binding:"max=255"`
+}
+
+// add to or take from the stock of the product or its variant in a warehouse
+func (repository *ProductRepo) AdjustProductStock(c *gin.Context) {
+	var input StockAdjustInput
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	m, ok := stockMovement(c, id, input.VariantId, input.Note)
+	if !ok {
+		return
+	}
+
+	if !repository.checkStockWarehouse(c, input.WarehouseId) {
+		return
+	}
+
+	m.StockMovementWarehouseId = input.WarehouseId
+	m.StockMovementDelta = input.Delta
+	m.StockMovementReason = input.Reason
+	if m.StockMovementReason == "" {
+		m.StockMovementReason = models.StockReasonAdjustment
+	}
+
+	err := models.AdjustStock(repository.Db, &m)
+	repository.stockMovementResponse(c, err, m)
+}
+
+type StockCountInput struct {
+	VariantId   int    `json:"variant_id" binding:"gte=0"`
+	WarehouseId int    `json:"warehouse_id" binding:"gte=0"`
+	Counted     *int   `json:"counted" binding:"required,gte=0"`
+	Note        string `json:"note" binding:"max=255"`
+}
+
+// set the stock of the product or its variant in a warehouse to what was counted
+func (repository *ProductRepo) CountProductStock(c *gin.Context) {
+	var input StockCountInput
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	m, ok := stockMovement(c, id, input.VariantId, input.Note)
+	if !ok {
+		return
+	}
+
+	if !repository.checkStockWarehouse(c, input.WarehouseId) {
+		return
+	}
+
+	m.StockMovementWarehouseId = input.WarehouseId
+
+	err := models.CountStock(repository.Db, &m, *input.Counted)
+	repository.stockMovementResponse(c, err, m)
+}
+
+// stock movements of the product, of one variant with variant_id and in one warehouse with warehouse_id, the latest first
+func (repository *ProductRepo) GetStockMovementsData(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	variantId, _ := strconv.Atoi(c.Query("variant_id"))
+	warehouseId, _ := strconv.Atoi(c.Query("warehouse_id"))
+
+	page, pageSize := pagination.Page(c)
+
+	var m models.StockMovement
+
+	movements, totalPages, err := m.GetStockMovementsPaginate(repository.Db, id, variantId, warehouseId, page, pageSize)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":       movements,
+		"totalPages": totalPages,
+	})
+}
+
+// stock of the product, or of the variant in variant_id, at the RFC 3339 time in "at". Only the stock in the
+// warehouse is given with warehouse_id
+func (repository *ProductRepo) GetStockAt(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	variantId, _ := strconv.Atoi(c.Query("variant_id"))
+	warehouseId, _ := strconv.Atoi(c.Query("warehouse_id"))
+
+	at := time.Now()
+	if value := c.Query("at"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "at must be an RFC 3339 timestamp"})
+			return
+		}
+		at = parsed
+	}
+
+	if exists, err := models.RecordExists(repository.Db, &models.Product{}, id); err != nil || !exists {
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+			return
+		}
+
+		c.JSON(http.StatusNotFound, gin.H{"message": "Product not found!"})
+		c.Abort()
+		return
+	}
+
+	stock, err := models.GetStockAt(repository.Db, id, variantId, warehouseId, at)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success", "data": gin.H{
+		"product_id":   id,
+		"variant_id":   variantId,
+		"warehouse_id": warehouseId,
+		"at":           at,
+		"stock":        stock,
+	}})
+}
@@ -0,0 +1,365 @@
+package controllers
+
+import (
+	"be-dbo-golang/database"
+	"be-dbo-golang/models"
+	"be-dbo-golang/utils/auth"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type SubscriptionRepo struct {
+	Db *gorm.DB
+}
+
+func NewSubscription() *SubscriptionRepo {
+	db := database.InitDb()
+	db.AutoMigrate(&models.Subscription{}, &models.SubscriptionItem{}, &models.SubscriptionRun{})
+	database.AddForeignKey(db, "subscriptions", "subscription_customer_id", "customers")
+	database.AddForeignKey(db, "subscriptions", "subscription_supplier_id", "suppliers")
+	return &SubscriptionRepo{Db: db}
+}
+
+// minutes between two checks for due subscriptions
+func subscriptionSchedulerInterval() time.Duration {
+	interval, err := strconv.Atoi(os.Getenv("SUBSCRIPTION_SCHEDULER_MINUTE_INTERVAL"))
+	if err != nil || interval <= 0 {
+		interval = 5 // Default 5 minutes
+	}
+	return time.Minute * time.Duration(interval)
+}
+
+// generate the orders of due subscriptions in the background
+func (repository *SubscriptionRepo) StartScheduler() {
+	run := func(now time.Time) {
+		if err := models.RunDueSubscriptions(repository.Db, now); err != nil {
+			log.Printf("subscription scheduler: %v", err)
+		}
+	}
+
+	go func() {
+		run(time.Now())
+
+		ticker := time.NewTicker(subscriptionSchedulerInterval())
+		defer ticker.Stop()
+
+		for now := range ticker.C {
+			run(now)
+		}
+	}()
+}
+
+// load a subscription of the logged in customer
+func (repository *SubscriptionRepo) customerSubscription(c *gin.Context, s *models.Subscription) bool {
+	customerId, _, err := auth.ExtractTokenID(c)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	if err := models.GetSubscriptionById(repository.Db, s, id, customerId); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.AbortWithStatus(http.StatusNotFound)
+			return false
+		}
+
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return false
+	}
+
+	return true
+}
+
+// check the products of the items are supplied by the supplier
+func (repository *SubscriptionRepo) subscriptionItems(c *gin.Context, errs fieldErrors, supplierId int, inputs []SubscriptionItemInput) ([]models.SubscriptionItem, bool) {
+	items := []models.SubscriptionItem{}
+
+	for i, input := range inputs {
+		field := fmt.Sprintf("items[%d].product_id", i)
+		variantField := fmt.Sprintf("items[%d].variant_id", i)
+
+		p := models.Product{}
+
+		if err := models.GetProductById(repository.Db, &p, input.ProductId); err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+				return nil, false
+			}
+			errs[field] = "product not found"
+			continue
+		}
+
+		if p.ProductSupplierId != supplierId {
+			errs[field] = "product is not supplied by supplier_id"
+			continue
+		}
+
+		if _, err := models.ResolveProductVariant(repository.Db, p, input.VariantId); err != nil {
+			if !errors.Is(err, models.ErrVariantRequired) && !errors.Is(err, models.ErrVariantNotFound) {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+				return nil, false
+			}
+			errs[variantField] = err.Error()
+			continue
+		}
+
+		items = append(items, models.SubscriptionItem{SubscriptionItemProductId: input.ProductId, SubscriptionItemVariantId: input.VariantId, SubscriptionItemQty: input.Qty})
+	}
+
+	return items, true
+}
+
+func subscriptionError(c *gin.Context, err error) {
+	if errors.Is(err, models.ErrSubscriptionNotActive) || errors.Is(err, models.ErrSubscriptionNotPaused) || errors.Is(err, models.ErrSubscriptionCancelled) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+}
+
+type SubscriptionItemInput struct {
+	ProductId int `json:"product_id" binding:"required"`
+	VariantId int `json:"variant_id"`
+	Qty       int `json:"quantity" binding:"required,gt=0"`
+}
+
+type SubscriptionRecordInput struct {
+	SupplierId        int                     `json:"supplier_id" binding:"required"`
+	IntervalUnit      string                  `json:"interval_unit" binding:"required,oneof=day week month"`
+	IntervalCount     int                     `json:"interval_count" binding:"omitempty,gt=0"`
+	StartAt           *time.Time              `json:"start_at"`
+	CouponCode        string                  `json:"coupon_code"`
+	Items             []SubscriptionItemInput `json:"items" binding:"required,min=1,dive"`
+	ShippingAddressId int                     `json:"shipping_address_id"`
+	ShippingAddress   *AddressInput           `json:"shipping_address"`
+}
+
+func (repository *SubscriptionRepo) SaveSubscriptionData(c *gin.Context) {
+
+	var input SubscriptionRecordInput
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	customerId, _, err := auth.ExtractTokenID(c)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	errs := fieldErrors{}
+
+	if err := errs.checkExists(repository.Db, "supplier_id", &models.Supplier{}, input.SupplierId, "supplier not found"); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	items, ok := repository.subscriptionItems(c, errs, input.SupplierId, input.Items)
+	if !ok || errs.abort(c) {
+		return
+	}
+
+	address, ok := orderShippingAddress(c, repository.Db, input.ShippingAddressId, input.ShippingAddress, customerId)
+	if !ok {
+		return
+	}
+
+	s := models.Subscription{}
+
+	s.SubscriptionCustomerId = customerId
+	s.SubscriptionSupplierId = input.SupplierId
+	s.SubscriptionStatus = models.SubscriptionStatusActive
+	s.SubscriptionIntervalUnit = input.IntervalUnit
+	s.SubscriptionIntervalCount = input.IntervalCount
+	if s.SubscriptionIntervalCount == 0 {
+		s.SubscriptionIntervalCount = 1
+	}
+	s.SubscriptionNextRunAt = time.Now()
+	if input.StartAt != nil {
+		s.SubscriptionNextRunAt = *input.StartAt
+	}
+	s.SubscriptionCouponCode = input.CouponCode
+	s.SubscriptionShippingAddress = address
+	s.SubscriptionItems = items
+
+	if err := models.CreateSubscription(repository.Db, &s); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Subscription save successfully", "data": s})
+}
+
+func (repository *SubscriptionRepo) GetSubscriptionsData(c *gin.Context) {
+
+	customerId, _, err := auth.ExtractTokenID(c)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var subscriptions []models.Subscription
+
+	if err := models.GetSubscriptionsByCustomer(repository.Db, &subscriptions, customerId); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": subscriptions})
+}
+
+func (repository *SubscriptionRepo) GetSubscriptionById(c *gin.Context) {
+
+	s := models.Subscription{}
+
+	if !repository.customerSubscription(c, &s) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success", "data": s})
+}
+
+// generated, failed and skipped runs of the subscription
+func (repository *SubscriptionRepo) GetSubscriptionRunsData(c *gin.Context) {
+
+	s := models.Subscription{}
+
+	if !repository.customerSubscription(c, &s) {
+		return
+	}
+
+	var runs []models.SubscriptionRun
+
+	if err := models.GetSubscriptionRuns(repository.Db, &runs, int(s.ID)); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": runs})
+}
+
+type SubscriptionUpdateInput struct {
+	IntervalUnit      string                  `json:"interval_unit" binding:"omitempty,oneof=day week month"`
+	IntervalCount     int                     `json:"interval_count" binding:"omitempty,gt=0"`
+	NextRunAt         *time.Time              `json:"next_run_at"`
+	CouponCode        *string                 `json:"coupon_code"`
+	Items             []SubscriptionItemInput `json:"items" binding:"omitempty,min=1,dive"`
+	ShippingAddressId int                     `json:"shipping_address_id"`
+	ShippingAddress   *AddressInput           `json:"shipping_address"`
+}
+
+func (repository *SubscriptionRepo) UpdateSubscription(c *gin.Context) {
+	var input SubscriptionUpdateInput
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	s := models.Subscription{}
+
+	if !repository.customerSubscription(c, &s) {
+		return
+	}
+
+	if s.SubscriptionStatus == models.SubscriptionStatusCancelled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": models.ErrSubscriptionCancelled.Error()})
+		return
+	}
+
+	var items []models.SubscriptionItem
+	if input.Items != nil {
+		errs := fieldErrors{}
+
+		var ok bool
+		items, ok = repository.subscriptionItems(c, errs, s.SubscriptionSupplierId, input.Items)
+		if !ok || errs.abort(c) {
+			return
+		}
+	}
+
+	// only the columns given are written, the status and runs may change meanwhile
+	var columns []string
+
+	if input.ShippingAddressId > 0 || input.ShippingAddress != nil {
+		address, ok := orderShippingAddress(c, repository.Db, input.ShippingAddressId, input.ShippingAddress, s.SubscriptionCustomerId)
+		if !ok {
+			return
+		}
+		s.SubscriptionShippingAddress = address
+		columns = append(columns, models.AddressColumns("subscription_shipping_")...)
+	}
+
+	if input.IntervalUnit != "" {
+		s.SubscriptionIntervalUnit = input.IntervalUnit
+		columns = append(columns, "subscription_interval_unit")
+	}
+	if input.IntervalCount > 0 {
+		s.SubscriptionIntervalCount = input.IntervalCount
+		columns = append(columns, "subscription_interval_count")
+	}
+	if input.NextRunAt != nil {
+		s.SubscriptionNextRunAt = *input.NextRunAt
+		columns = append(columns, "subscription_next_run_at")
+	}
+	if input.CouponCode != nil {
+		s.SubscriptionCouponCode = *input.CouponCode
+		columns = append(columns, "subscription_coupon_code")
+	}
+
+	if err := models.UpdateSubscription(repository.Db, &s, columns, items); err != nil {
+		subscriptionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success", "data": s})
+}
+
+// change the subscription with one of the status actions
+func (repository *SubscriptionRepo) changeSubscription(c *gin.Context, change func(db *gorm.DB, s *models.Subscription) error) {
+	s := models.Subscription{}
+
+	if !repository.customerSubscription(c, &s) {
+		return
+	}
+
+	if err := change(repository.Db, &s); err != nil {
+		subscriptionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success", "data": s})
+}
+
+func (repository *SubscriptionRepo) PauseSubscription(c *gin.Context) {
+	repository.changeSubscription(c, models.PauseSubscription)
+}
+
+func (repository *SubscriptionRepo) ResumeSubscription(c *gin.Context) {
+	repository.changeSubscription(c, models.ResumeSubscription)
+}
+
+// skip the next run only, the following ones are generated as usual
+func (repository *SubscriptionRepo) SkipSubscription(c *gin.Context) {
+	repository.changeSubscription(c, models.SkipSubscription)
+}
+
+func (repository *SubscriptionRepo) CancelSubscription(c *gin.Context) {
+	repository.changeSubscription(c, models.CancelSubscription)
+}
@@ -4,6 +4,7 @@ import (
 	"be-dbo-golang/database"
 	"be-dbo-golang/models"
 	"be-dbo-golang/utils/auth"
+	"be-dbo-golang/utils/filter"
 	"be-dbo-golang/utils/pagination"
 	"errors"
 	"net/http"
@@ -24,21 +25,23 @@ func NewSupplier() *SupplierRepo {
 }
 
 type SupplierResponse struct {
-	ID       uint   `json:"id"`
-	Name     string `json:"name"`
-	Username string `json:"username"`
-	Email    string `json:"email"`
-	Phone    string `json:"phone"`
-	Address  string `json:"address"`
+	ID               uint   `json:"id"`
+	Name             string `json:"name"`
+	Username         string `json:"username"`
+	Email            string `json:"email"`
+	Phone            string `json:"phone"`
+	Address          string `json:"address"`
+	PricesIncludeTax bool   `json:"prices_include_tax"`
 }
 
 type SupplierRegisterInput struct {
-	Name     string `json:"name" binding:"required"`
-	Username string `json:"username" binding:"required"`
-	Email    string `json:"email" binding:"required"`
-	Phone    string `json:"phone" binding:"required"`
-	Password string `json:"password" binding:"required"`
-	Address  string
+	Name             string `json:"name" binding:"required"`
+	Username         string `json:"username" binding:"required"`
+	Email            string `json:"email" binding:"required"`
+	Phone            string `json:"phone" binding:"required"`
+	Password         string `json:"password" binding:"required"`
+	Address          string
+	PricesIncludeTax bool `json:"prices_include_tax"`
 }
 
 func (repository *SupplierRepo) SupplierRegister(c *gin.Context) {
@@ -58,6 +61,7 @@ func (repository *SupplierRepo) SupplierRegister(c *gin.Context) {
 	s.SupplierPhone = input.Phone
 	s.SupplierPassword = input.Password
 	s.SupplierAddress = input.Address
+	s.SupplierPricesIncludeTax = input.PricesIncludeTax
 
 	if err := s.HashPassword(s.SupplierPassword); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -108,7 +112,7 @@ func (repository *SupplierRepo) SupplierLogin(c *gin.Context) {
 	}
 
 	// Create JWT Token for Authorization
-	tokenString, err := auth.GenerateToken(int(s.ID), s.SupplierEmail, s.SupplierUsername)
+	tokenString, err := auth.GenerateToken(int(s.ID), s.SupplierEmail, s.SupplierUsername, auth.RoleSupplier)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		c.Abort()
@@ -143,17 +147,19 @@ func (repository *SupplierRepo) SupplierLoggedIn(c *gin.Context) {
 	response.Email = s.SupplierEmail
 	response.Phone = s.SupplierPhone
 	response.Address = s.SupplierAddress
+	response.PricesIncludeTax = s.SupplierPricesIncludeTax
 
 	c.JSON(http.StatusOK, gin.H{"message": "success", "data": response})
 }
 
 type SupplierUpdateInput struct {
-	Name     string `json:"name"`
-	Username string `json:"username"`
-	Email    string `json:"email"`
-	Phone    string `json:"phone"`
-	Password string `json:"password"`
-	Address  string `json:"address"`
+	Name             string `json:"name"`
+	Username         string `json:"username"`
+	Email            string `json:"email"`
+	Phone            string `json:"phone"`
+	Password         string `json:"password"`
+	Address          string `json:"address"`
+	PricesIncludeTax *bool  `json:"prices_include_tax"`
 }
 
 func (repository *SupplierRepo) UpdateSupplier(c *gin.Context) {
@@ -216,6 +222,15 @@ func (repository *SupplierRepo) UpdateSupplier(c *gin.Context) {
 		return
 	}
 
+	if input.PricesIncludeTax != nil {
+		s.SupplierPricesIncludeTax = *input.PricesIncludeTax
+
+		if err := models.UpdateSupplierPricesIncludeTax(repository.Db, &s, id); err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+			return
+		}
+	}
+
 	var response SupplierResponse
 	response.ID = s.ID
 	response.Name = s.SupplierName
@@ -223,17 +238,28 @@ func (repository *SupplierRepo) UpdateSupplier(c *gin.Context) {
 	response.Email = s.SupplierEmail
 	response.Phone = s.SupplierPhone
 	response.Address = s.SupplierAddress
+	response.PricesIncludeTax = s.SupplierPricesIncludeTax
 
 	c.JSON(http.StatusOK, response)
 }
 
 func (repository *SupplierRepo) GetSuppliersData(c *gin.Context) {
 
-	page, pageSize, sortField, sortOrder := pagination.Paginate(c)
+	page, pageSize, orderBy, err := pagination.Paginate(c, models.SupplierSorts)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	f, err := filter.Parse(c.Request.URL.Query(), models.SupplierFilters)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	var s models.Supplier
 
-	Suppliers, totalPages, err := s.GetSuppliersPaginate(repository.Db, page, pageSize, sortField, sortOrder)
+	Suppliers, totalPages, err := s.GetSuppliersPaginate(f.Apply(repository.Db), page, pageSize, orderBy)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Supplier not found!"})
 		c.Abort()
@@ -243,11 +269,12 @@ func (repository *SupplierRepo) GetSuppliersData(c *gin.Context) {
 	var responses []SupplierResponse
 	for _, Supplier := range Suppliers {
 		response := SupplierResponse{
-			ID:       Supplier.ID,
-			Name:     Supplier.SupplierName,
-			Username: Supplier.SupplierUsername,
-			Email:    Supplier.SupplierEmail,
-			Phone:    Supplier.SupplierPhone,
+			ID:               Supplier.ID,
+			Name:             Supplier.SupplierName,
+			Username:         Supplier.SupplierUsername,
+			Email:            Supplier.SupplierEmail,
+			Phone:            Supplier.SupplierPhone,
+			PricesIncludeTax: Supplier.SupplierPricesIncludeTax,
 		}
 		responses = append(responses, response)
 	}
@@ -0,0 +1,226 @@
+package controllers
+
+import (
+	"be-dbo-golang/models"
+	"be-dbo-golang/utils/auth"
+	"be-dbo-golang/utils/pagination"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// hours a supplier has to ship an order before it is overdue
+func fulfillmentSla() time.Duration {
+	sla, err := strconv.Atoi(os.Getenv("ORDER_FULFILLMENT_HOUR_SLA"))
+	if err != nil || sla <= 0 {
+		sla = 48 // Default 48 hours
+	}
+	return time.Hour * time.Duration(sla)
+}
+
+// load an order of the logged in supplier
+func (repository *OrderRepo) supplierOrder(c *gin.Context, o *models.Order) bool {
+	supplierId, _, err := auth.ExtractTokenID(c)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	if err := models.GetOrderById(repository.Db, o, id); err != nil || o.OrderSupplierId != supplierId {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Order not found!"})
+		c.Abort()
+		return false
+	}
+
+	return true
+}
+
+func (repository *OrderRepo) GetSupplierOrdersData(c *gin.Context) {
+
+	supplierId, _, err := auth.ExtractTokenID(c)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filter, err := orderFilterFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filter.SupplierId = supplierId
+
+	switch c.Query("fulfillment") {
+	case "":
+	case "unfulfilled":
+		filter.Statuses = models.OrderUnfulfilledStatuses
+	case "overdue":
+		filter.Statuses = models.OrderUnfulfilledStatuses
+		deadline := time.Now().Add(-fulfillmentSla())
+		if filter.CreatedTo == nil || filter.CreatedTo.After(deadline) {
+			filter.CreatedTo = &deadline
+		}
+	case "shipped":
+		filter.Statuses = []string{models.OrderStatusShipped, models.OrderStatusDelivered}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "fulfillment must be one of unfulfilled, overdue or shipped"})
+		return
+	}
+
+	page, pageSize, orderBy, err := pagination.Paginate(c, models.OrderSorts)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var o models.Order
+
+	Orders, totalPages, err := o.GetOrdersFilteredPaginate(repository.Db, filter, page, pageSize, orderBy)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Order not found!"})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":       Orders,
+		"totalPages": totalPages,
+	})
+}
+
+func (repository *OrderRepo) GetSupplierOrderById(c *gin.Context) {
+
+	o := models.Order{}
+
+	if !repository.supplierOrder(c, &o) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success", "data": o})
+}
+
+func (repository *OrderRepo) AcceptSupplierOrder(c *gin.Context) {
+
+	o := models.Order{}
+
+	if !repository.supplierOrder(c, &o) {
+		return
+	}
+
+	err := models.AcceptOrder(repository.Db, &o, time.Now())
+	if err != nil {
+		if errors.Is(err, models.ErrOrderNotPending) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Order accepted", "data": o})
+}
+
+type SupplierOrderRejectInput struct {
+	Reason string `json:"reason" binding:"max=255"`
+}
+
+func (repository *OrderRepo) RejectSupplierOrder(c *gin.Context) {
+	var input SupplierOrderRejectInput
+
+	// the body is optional, a reason is not required
+	if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	o := models.Order{}
+
+	if !repository.supplierOrder(c, &o) {
+		return
+	}
+
+	err := models.RejectOrder(repository.Db, &o, input.Reason, time.Now())
+	if err != nil {
+		if errors.Is(err, models.ErrOrderNotPending) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Order rejected", "data": o})
+}
+
+type SupplierOrderShipInput struct {
+	Carrier        string              `json:"carrier" binding:"required"`
+	TrackingNumber string              `json:"tracking_number" binding:"required"`
+	ShippedAt      *time.Time          `json:"shipped_at"`
+	Items          []ShipmentItemInput `json:"items" binding:"omitempty,dive"`
+}
+
+// ship items of an accepted order, every remaining item when none are given
+func (repository *OrderRepo) ShipSupplierOrder(c *gin.Context) {
+	var input SupplierOrderShipInput
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	o := models.Order{}
+
+	if !repository.supplierOrder(c, &o) {
+		return
+	}
+
+	if o.OrderStatus == models.OrderStatusPending || o.OrderStatus == models.OrderStatusBackordered {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "order must be accepted before it is shipped"})
+		return
+	}
+
+	s := models.Shipment{}
+
+	s.ShipmentOrderId = int(o.ID)
+	s.ShipmentCarrier = input.Carrier
+	s.ShipmentTrackingNumber = input.TrackingNumber
+	s.ShipmentShippedAt = input.ShippedAt
+
+	for _, item := range input.Items {
+		s.ShipmentItems = append(s.ShipmentItems, models.ShipmentItem{
+			ShipmentItemOrderLineId: item.OrderLineId,
+			ShipmentItemQty:         item.Qty,
+		})
+	}
+
+	err := models.CreateShipment(repository.Db, &s)
+
+	if err != nil {
+		if isShipmentError(err) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		c.Abort()
+		return
+	}
+
+	if err := models.GetOrderById(repository.Db, &o, int(o.ID)); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Order shipped", "data": s, "order_status": o.OrderStatus})
+}
@@ -0,0 +1,218 @@
+package controllers
+
+import (
+	"be-dbo-golang/database"
+	"be-dbo-golang/models"
+	"be-dbo-golang/utils/pagination"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type TaxRateRepo struct {
+	Db *gorm.DB
+}
+
+func NewTaxRate() *TaxRateRepo {
+	db := database.InitDb()
+	db.AutoMigrate(&models.TaxRate{})
+	return &TaxRateRepo{Db: db}
+}
+
+type TaxRateResponse struct {
+	ID            uint       `json:"id"`
+	Name          string     `json:"name"`
+	Category      string     `json:"category"`
+	ProductId     int        `json:"product_id"`
+	Percent       float64    `json:"percent"`
+	EffectiveFrom time.Time  `json:"effective_from"`
+	EffectiveTo   *time.Time `json:"effective_to"`
+}
+
+func taxRateResponse(t models.TaxRate) TaxRateResponse {
+	return TaxRateResponse{
+		ID:            t.ID,
+		Name:          t.TaxRateName,
+		Category:      t.TaxRateCategory,
+		ProductId:     t.TaxRateProductId,
+		Percent:       t.TaxRatePercent,
+		EffectiveFrom: t.TaxRateEffectiveFrom,
+		EffectiveTo:   t.TaxRateEffectiveTo,
+	}
+}
+
+type TaxRateRecordInput struct {
+	Name          string     `json:"name" binding:"required"`
+	Category      string     `json:"category"`
+	ProductId     int        `json:"product_id"`
+	Percent       float64    `json:"percent" binding:"gte=0,lte=100"`
+	EffectiveFrom time.Time  `json:"effective_from" binding:"required"`
+	EffectiveTo   *time.Time `json:"effective_to"`
+}
+
+func (repository *TaxRateRepo) SaveTaxRateData(c *gin.Context) {
+
+	var input TaxRateRecordInput
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.Category == "" && input.ProductId == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "category or product_id is required"})
+		return
+	}
+
+	if input.EffectiveTo != nil && !input.EffectiveTo.After(input.EffectiveFrom) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "effective_to must be after effective_from"})
+		return
+	}
+
+	t := models.TaxRate{}
+
+	t.TaxRateName = input.Name
+	t.TaxRateCategory = input.Category
+	t.TaxRateProductId = input.ProductId
+	t.TaxRatePercent = input.Percent
+	t.TaxRateEffectiveFrom = input.EffectiveFrom
+	t.TaxRateEffectiveTo = input.EffectiveTo
+
+	err := models.CreateTaxRate(repository.Db, &t)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		c.Abort()
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"message": "Tax rate save successfully", "id": t.ID, "name": t.TaxRateName})
+
+}
+
+func (repository *TaxRateRepo) GetTaxRateById(c *gin.Context) {
+
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	t := models.TaxRate{}
+
+	if err := models.GetTaxRateById(repository.Db, &t, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Tax rate not found!"})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success", "data": taxRateResponse(t)})
+}
+
+type TaxRateUpdateInput struct {
+	Name          string     `json:"name"`
+	Percent       *float64   `json:"percent" binding:"omitempty,gte=0,lte=100"`
+	EffectiveFrom *time.Time `json:"effective_from"`
+	EffectiveTo   *time.Time `json:"effective_to"`
+}
+
+func (repository *TaxRateRepo) UpdateTaxRate(c *gin.Context) {
+	var input TaxRateUpdateInput
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	t := models.TaxRate{}
+
+	err := models.GetTaxRateById(repository.Db, &t, id)
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	if input.Name != "" {
+		t.TaxRateName = input.Name
+	}
+
+	if input.Percent != nil {
+		t.TaxRatePercent = *input.Percent
+	}
+
+	if input.EffectiveFrom != nil {
+		t.TaxRateEffectiveFrom = *input.EffectiveFrom
+	}
+
+	if input.EffectiveTo != nil {
+		t.TaxRateEffectiveTo = input.EffectiveTo
+	}
+
+	if t.TaxRateEffectiveTo != nil && !t.TaxRateEffectiveTo.After(t.TaxRateEffectiveFrom) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "effective_to must be after effective_from"})
+		return
+	}
+
+	err = models.UpdateTaxRate(repository.Db, &t, id)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusOK, taxRateResponse(t))
+}
+
+func (repository *TaxRateRepo) GetTaxRatesData(c *gin.Context) {
+
+	page, pageSize, orderBy, err := pagination.Paginate(c, models.TaxRateSorts)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var t models.TaxRate
+
+	TaxRates, totalPages, err := t.GetTaxRatesPaginate(repository.Db, page, pageSize, orderBy)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Tax rate not found!"})
+		c.Abort()
+		return
+	}
+
+	var responses []TaxRateResponse
+	for _, TaxRate := range TaxRates {
+		responses = append(responses, taxRateResponse(TaxRate))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":       responses,
+		"totalPages": totalPages,
+	})
+}
+
+func (repository *TaxRateRepo) DeleteTaxRate(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	t := models.TaxRate{}
+
+	err := models.DeleteTaxRate(repository.Db, &t, id)
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "data deleted"})
+}
@@ -0,0 +1,33 @@
+package controllers
+
+import (
+	"be-dbo-golang/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// invalid request fields by json name, reported together with 422
+type fieldErrors map[string]string
+
+// add an error for the field when no record of the model has the id
+func (errs fieldErrors) checkExists(db *gorm.DB, field string, model interface{}, id int, message string) error {
+	exists, err := models.RecordExists(db, model, id)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		errs[field] = message
+	}
+	return nil
+}
+
+// reply 422 with the field errors, false when there are none
+func (errs fieldErrors) abort(c *gin.Context) bool {
+	if len(errs) == 0 {
+		return false
+	}
+	c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": "invalid references", "fields": errs})
+	return true
+}
@@ -0,0 +1,347 @@
+package controllers
+
+import (
+	"be-dbo-golang/database"
+	"be-dbo-golang/models"
+	"be-dbo-golang/utils/auth"
+	"be-dbo-golang/utils/pagination"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type WarehouseRepo struct {
+	Db *gorm.DB
+}
+
+func NewWarehouse() *WarehouseRepo {
+	db := database.InitDb()
+	db.AutoMigrate(&models.Warehouse{}, &models.WarehouseStock{}, &models.WarehouseTransfer{})
+	return &WarehouseRepo{Db: db}
+}
+
+// how order lines are allocated to warehouses: nearest, most_stock or priority
+func warehouseAllocationStrategy() string {
+	switch strategy := os.Getenv("WAREHOUSE_ALLOCATION_STRATEGY"); strategy {
+	case models.AllocationNearest, models.AllocationMostStock, models.AllocationPriority:
+		return strategy
+	}
+	return models.AllocationPriority // Default priority
+}
+
+type WarehouseResponse struct {
+	ID       uint           `json:"id"`
+	Name     string         `json:"name"`
+	Code     string         `json:"code"`
+	Address  models.Address `json:"address"`
+	Priority int            `json:"priority"`
+	IsActive bool           `json:"is_active"`
+}
+
+func warehouseResponse(w models.Warehouse) WarehouseResponse {
+	return WarehouseResponse{
+		ID:       w.ID,
+		Name:     w.WarehouseName,
+		Code:     w.WarehouseCode,
+		Address:  w.WarehouseAddress,
+		Priority: w.WarehousePriority,
+		IsActive: w.WarehouseIsActive,
+	}
+}
+
+type WarehouseStockResponse struct {
+	WarehouseId   int    `json:"warehouse_id"`
+	WarehouseCode string `json:"warehouse_code"`
+	WarehouseName string `json:"warehouse_name"`
+	VariantId     int    `json:"variant_id,omitempty"`
+	Stock         int    `json:"stock"`
+}
+
+func warehouseStockResponse(s models.WarehouseStock) WarehouseStockResponse {
+	return WarehouseStockResponse{
+		WarehouseId:   s.WarehouseStockWarehouseId,
+		WarehouseCode: s.WarehouseStockWarehouse.WarehouseCode,
+		WarehouseName: s.WarehouseStockWarehouse.WarehouseName,
+		VariantId:     s.WarehouseStockVariantId,
+		Stock:         s.WarehouseStockQty,
+	}
+}
+
+// stock of the product, or of one of its variants, by warehouse
+func warehouseStockResponses(stocks []models.WarehouseStock, variantId int) []WarehouseStockResponse {
+	responses := []WarehouseStockResponse{}
+	for _, stock := range stocks {
+		if stock.WarehouseStockVariantId == variantId {
+			responses = append(responses, warehouseStockResponse(stock))
+		}
+	}
+	return responses
+}
+
+// reply to an error of a warehouse change
+func warehouseError(c *gin.Context, err error) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	if errors.Is(err, models.ErrWarehouseCodeTaken) || errors.Is(err, models.ErrWarehouseHasStock) || errors.Is(err, models.ErrTransferSameWarehouse) || errors.Is(err, models.ErrStockNegative) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+}
+
+type WarehouseRecordInput struct {
+	Name     string        `json:"name" binding:"required"`
+	Code     string        `json:"code" binding:"required,max=50"`
+	Address  *AddressInput `json:"address"`
+	Priority int           `json:"priority"`
+	IsActive *bool         `json:"is_active"`
+}
+
+func (repository *WarehouseRepo) SaveWarehouseData(c *gin.Context) {
+
+	var input WarehouseRecordInput
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	w := models.Warehouse{}
+
+	w.WarehouseName = input.Name
+	w.WarehouseCode = input.Code
+	if input.Address != nil {
+		w.WarehouseAddress = addressFromInput(*input.Address)
+	}
+	w.WarehousePriority = input.Priority
+	w.WarehouseIsActive = input.IsActive == nil || *input.IsActive
+
+	if err := models.CreateWarehouse(repository.Db, &w); err != nil {
+		warehouseError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Warehouse save successfully", "data": warehouseResponse(w)})
+}
+
+func (repository *WarehouseRepo) GetWarehouseById(c *gin.Context) {
+
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	w := models.Warehouse{}
+
+	if err := models.GetWarehouseById(repository.Db, &w, id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Warehouse not found!"})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success", "data": warehouseResponse(w)})
+}
+
+type WarehouseUpdateInput struct {
+	Name     string        `json:"name"`
+	Code     string        `json:"code" binding:"max=50"`
+	Address  *AddressInput `json:"address"`
+	Priority *int          `json:"priority"`
+	IsActive *bool         `json:"is_active"`
+}
+
+func (repository *WarehouseRepo) UpdateWarehouse(c *gin.Context) {
+	var input WarehouseUpdateInput
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	w := models.Warehouse{}
+
+	err := models.GetWarehouseById(repository.Db, &w, id)
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	if input.Name != "" {
+		w.WarehouseName = input.Name
+	}
+
+	if input.Code != "" {
+		w.WarehouseCode = input.Code
+	}
+
+	if input.Address != nil {
+		w.WarehouseAddress = addressFromInput(*input.Address)
+	}
+
+	if input.Priority != nil {
+		w.WarehousePriority = *input.Priority
+	}
+
+	// an inactive warehouse keeps its stock but orders are no longer allocated from it
+	if input.IsActive != nil {
+		w.WarehouseIsActive = *input.IsActive
+	}
+
+	if err := models.UpdateWarehouse(repository.Db, &w); err != nil {
+		warehouseError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success", "data": warehouseResponse(w)})
+}
+
+func (repository *WarehouseRepo) GetWarehousesData(c *gin.Context) {
+
+	page, pageSize, orderBy, err := pagination.Paginate(c, models.WarehouseSorts)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var w models.Warehouse
+
+	Warehouses, totalPages, err := w.GetWarehousesPaginate(repository.Db, page, pageSize, orderBy)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Warehouse not found!"})
+		c.Abort()
+		return
+	}
+
+	var responses []WarehouseResponse
+	for _, Warehouse := range Warehouses {
+		responses = append(responses, warehouseResponse(Warehouse))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":       responses,
+		"totalPages": totalPages,
+	})
+}
+
+func (repository *WarehouseRepo) DeleteWarehouse(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	w := models.Warehouse{}
+
+	if err := models.DeleteWarehouse(repository.Db, &w, id); err != nil {
+		warehouseError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "data deleted"})
+}
+
+type WarehouseTransferInput struct {
+	FromWarehouseId int    `json:"from_warehouse_id" binding:"required"`
+	ToWarehouseId   int    `json:"to_warehouse_id" binding:"required"`
+	ProductId       int    `json:"product_id" binding:"required"`
+	VariantId       int    `json:"variant_id" binding:"gte=0"`
+	Qty             int    `json:"quantity" binding:"required,gt=0"`
+	Note            string `json:"note" binding:"max=255"`
+}
+
+// move stock of a product or variant from one warehouse to another
+func (repository *WarehouseRepo) TransferStock(c *gin.Context) {
+	var input WarehouseTransferInput
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims, err := auth.ExtractTokenClaims(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	errs := fieldErrors{}
+
+	for field, id := range map[string]int{"from_warehouse_id": input.FromWarehouseId, "to_warehouse_id": input.ToWarehouseId} {
+		if err := errs.checkExists(repository.Db, field, &models.Warehouse{}, id, "warehouse not found"); err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+			return
+		}
+	}
+
+	if err := errs.checkExists(repository.Db, "product_id", &models.Product{}, input.ProductId, "product not found"); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	if errs.abort(c) {
+		return
+	}
+
+	transfer := models.WarehouseTransfer{}
+
+	transfer.WarehouseTransferFromId = input.FromWarehouseId
+	transfer.WarehouseTransferToId = input.ToWarehouseId
+	transfer.WarehouseTransferProductId = input.ProductId
+	transfer.WarehouseTransferVariantId = input.VariantId
+	transfer.WarehouseTransferQty = input.Qty
+	transfer.WarehouseTransferActorId = claims.ID
+	transfer.WarehouseTransferActorRole = claims.Role
+	transfer.WarehouseTransferNote = input.Note
+
+	if err := models.TransferStock(repository.Db, &transfer); err != nil {
+		warehouseError(c, err)
+		return
+	}
+
+	// stock moved into an active warehouse can go to waiting backorders
+	if err := models.AllocateBackorders(repository.Db, input.ProductId); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Stock transfer success", "data": transfer})
+}
+
+// stock of the product and its variants by warehouse
+func (repository *WarehouseRepo) GetProductWarehouseStocks(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	if exists, err := models.RecordExists(repository.Db, &models.Product{}, id); err != nil || !exists {
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+			return
+		}
+
+		c.JSON(http.StatusNotFound, gin.H{"message": "Product not found!"})
+		c.Abort()
+		return
+	}
+
+	var stocks []models.WarehouseStock
+
+	if err := models.GetWarehouseStocks(repository.Db, &stocks, id); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	responses := []WarehouseStockResponse{}
+	for _, stock := range stocks {
+		responses = append(responses, warehouseStockResponse(stock))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success", "data": responses})
+}
@@ -0,0 +1,62 @@
+package database
+
+import (
+	"be-dbo-golang/utils/money"
+	"fmt"
+	"log"
+	"math/big"
+
+	"gorm.io/gorm"
+)
+
+// MigrateMoneyColumn moves a float amount column into the minor unit and currency columns of a
+// money.Money embedded with the prefix, then drops the old column. Existing amounts are taken as
+// the default currency and rounded half away from zero on the exact decimal value.
+func MigrateMoneyColumn(db *gorm.DB, table, column, prefix string) error {
+	return MigrateMoneyColumnWhere(db, table, column, prefix, "1 = 1")
+}
+
+// MigrateMoneyColumnWhere only converts the rows matching the condition, the others keep a zero amount
+func MigrateMoneyColumnWhere(db *gorm.DB, table, column, prefix, condition string) error {
+	if !db.Migrator().HasTable(table) || !db.Migrator().HasColumn(table, column) {
+		return nil
+	}
+
+	currency := money.DefaultCurrency()
+	factor := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(money.Exponent(currency))), nil)
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		query := fmt.Sprintf(
+			"UPDATE %s SET %sminor = CASE WHEN %s THEN ROUND(CAST(%s AS DECIMAL(65,10)) * %s) ELSE 0 END, %scurrency = ? WHERE %scurrency = ''",
+			table, prefix, condition, column, factor.String(), prefix, prefix,
+		)
+		if err := tx.Exec(query, currency).Error; err != nil {
+			return err
+		}
+
+		return DropColumn(tx, table, column)
+	})
+}
+
+// DropColumn removes a column that is no longer part of the model
+func DropColumn(db *gorm.DB, table, column string) error {
+	if !db.Migrator().HasColumn(table, column) {
+		return nil
+	}
+	return db.Exec(fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", table, column)).Error
+}
+
+// AddForeignKey references the id of another table from the column. Rows that already point to
+// missing records keep the key from being added, the error is logged until they are fixed.
+func AddForeignKey(db *gorm.DB, table, column, referenced string) error {
+	name := fmt.Sprintf("fk_%s_%s", table, column)
+	if db.Migrator().HasConstraint(table, name) {
+		return nil
+	}
+
+	err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s(id)", table, name, column, referenced)).Error
+	if err != nil {
+		log.Printf("foreign key %s not added: %v", name, err)
+	}
+	return err
+}
@@ -2,7 +2,12 @@ package main
 
 import (
 	"be-dbo-golang/controllers"
+	"be-dbo-golang/database"
+	"be-dbo-golang/models"
+	"be-dbo-golang/utils/auth"
+	"be-dbo-golang/utils/storage"
 	"os"
+	"time"
 
 	"be-dbo-golang/utils/middlewares"
 
@@ -29,12 +34,41 @@ func main() {
 
 	supplierRepo := controllers.NewSupplier()
 
+	brandRepo := controllers.NewBrand()
+
+	categoryRepo := controllers.NewCategory()
+
 	productRepo := controllers.NewProduct()
+	productRepo.StartPriceScheduler()
+	productRepo.StartStockAlertNotifier()
+	brandRepo.Search = productRepo.Search
 
-	brandRepo := controllers.NewBrand()
+	warehouseRepo := controllers.NewWarehouse()
 
 	orderRepo := controllers.NewOrder()
 
+	shippingAddressRepo := controllers.NewShippingAddress()
+
+	shipmentRepo := controllers.NewShipment()
+
+	couponRepo := controllers.NewCoupon()
+
+	taxRateRepo := controllers.NewTaxRate()
+
+	cartRepo := controllers.NewCart()
+
+	purchaseOrderRepo := controllers.NewPurchaseOrder()
+
+	subscriptionRepo := controllers.NewSubscription()
+	subscriptionRepo.StartScheduler()
+
+	idempotencyDb := database.InitDb()
+	idempotencyDb.AutoMigrate(&models.IdempotencyKey{})
+	models.DeleteExpiredIdempotencyKeys(idempotencyDb, time.Now())
+
+	// uploaded files of the local storage
+	router.Static(storage.LocalBaseURL(), storage.LocalRoot())
+
 	apiEndpoint := router.Group("/api/v1")
 	{
 		apiEndpoint.GET("/", func(c *gin.Context) {
@@ -59,13 +93,20 @@ func main() {
 		//PRODUCT OPEN API
 		apiEndpoint.GET("/product/list", productRepo.GetProductsData)
 		apiEndpoint.GET("/product/data/:id", productRepo.GetProductById)
+		apiEndpoint.GET("/product/search", productRepo.SearchProducts)
+		apiEndpoint.GET("/product/price/at/:id", productRepo.GetProductPriceAt)
 
 		//BRAND OPEN API
 		apiEndpoint.GET("/brand/list", brandRepo.GetBrandsData)
 		apiEndpoint.GET("/brand/data/:id", brandRepo.GetBrandById)
 
+		//CATEGORY OPEN API
+		apiEndpoint.GET("/category/list", categoryRepo.GetCategoriesData)
+		apiEndpoint.GET("/category/data/:id", categoryRepo.GetCategoryById)
+		apiEndpoint.GET("/category/products/:id", categoryRepo.GetCategoryProductsData)
+
 		// PRIVATE API
-		secured := apiEndpoint.Group("/secured").Use(middlewares.JwtAuthMiddleware())
+		secured := apiEndpoint.Group("/secured").Use(middlewares.JwtAuthMiddleware(), middlewares.IdempotencyMiddleware(idempotencyDb))
 		{
 			// ADMIN
 			secured.GET("/admin/data", adminRepo.AdminLoggedIn)
@@ -83,9 +124,24 @@ func main() {
 			secured.DELETE("/supplier/delete/:id", supplierRepo.DeleteSupplier)
 
 			// PRODUCT
-			secured.POST("/product/create", productRepo.SaveProductData)
-			secured.PUT("/product/update/:id", productRepo.UpdateProduct)
-			secured.DELETE("/product/delete/:id", productRepo.DeleteProduct)
+			adminOnly := middlewares.RoleMiddleware(auth.RoleAdmin)
+			secured.POST("/product/create", adminOnly, productRepo.SaveProductData)
+			secured.PUT("/product/update/:id", adminOnly, productRepo.UpdateProduct)
+			secured.DELETE("/product/delete/:id", adminOnly, productRepo.DeleteProduct)
+			secured.POST("/product/variant/create/:id", adminOnly, productRepo.SaveProductVariantData)
+			secured.PUT("/product/variant/update/:id", adminOnly, productRepo.UpdateProductVariant)
+			secured.DELETE("/product/variant/delete/:id", adminOnly, productRepo.DeleteProductVariant)
+			secured.POST("/product/image/upload/:id", adminOnly, productRepo.UploadProductImage)
+			secured.PUT("/product/image/update/:id", adminOnly, productRepo.UpdateProductImage)
+			secured.PUT("/product/image/reorder/:id", adminOnly, productRepo.ReorderProductImages)
+			secured.DELETE("/product/image/delete/:id", adminOnly, productRepo.DeleteProductImage)
+			secured.GET("/product/price/history/:id", productRepo.GetProductPriceHistory)
+			secured.POST("/product/price/schedule/:id", adminOnly, productRepo.ScheduleProductPrice)
+			secured.PUT("/product/price/cancel/:id", adminOnly, productRepo.CancelProductPriceChange)
+			secured.GET("/product/stock/movements/:id", adminOnly, productRepo.GetStockMovementsData)
+			secured.GET("/product/stock/at/:id", adminOnly, productRepo.GetStockAt)
+			secured.POST("/product/stock/adjust/:id", adminOnly, productRepo.AdjustProductStock)
+			secured.POST("/product/stock/count/:id", adminOnly, productRepo.CountProductStock)
 
 			// BRAND
 			secured.POST("/brand/create", brandRepo.SaveBrandData)
@@ -93,11 +149,107 @@ func main() {
 			secured.DELETE("/brand/delete/:id", brandRepo.DeleteBrand)
 
 			// ORDER
-			secured.GET("/order/list", orderRepo.GetOrdersData)
+			secured.GET("/order/list", adminOnly, orderRepo.GetOrdersData)
 			secured.GET("/order/data/:id", orderRepo.GetOrderById)
-			secured.POST("/order/create", orderRepo.SaveOrderData)
-			secured.PUT("/order/update/:id", orderRepo.UpdateOrder)
-			secured.DELETE("/order/delete/:id", orderRepo.DeleteOrder)
+			customerOrAdmin := middlewares.RoleMiddleware(auth.RoleCustomer, auth.RoleAdmin)
+			secured.POST("/order/create", customerOrAdmin, orderRepo.SaveOrderData)
+			secured.PUT("/order/update/:id", adminOnly, orderRepo.UpdateOrder)
+			secured.DELETE("/order/delete/:id", adminOnly, orderRepo.DeleteOrder)
+
+			// ORDER COMMENT
+			secured.GET("/order/comment/list/:id", orderRepo.GetOrderCommentsData)
+			secured.GET("/order/comment/data/:id", orderRepo.GetOrderCommentById)
+			secured.POST("/order/comment/create/:id", orderRepo.SaveOrderCommentData)
+			secured.PUT("/order/comment/update/:id", orderRepo.UpdateOrderComment)
+
+			// CATEGORY
+			secured.POST("/category/create", adminOnly, categoryRepo.SaveCategoryData)
+			secured.PUT("/category/update/:id", adminOnly, categoryRepo.UpdateCategory)
+			secured.DELETE("/category/delete/:id", adminOnly, categoryRepo.DeleteCategory)
+
+			// CUSTOMER ORDER
+			customerOnly := middlewares.RoleMiddleware(auth.RoleCustomer)
+			secured.GET("/customer/order/list", customerOnly, orderRepo.GetCustomerOrdersData)
+			secured.GET("/customer/order/data/:id", customerOnly, orderRepo.GetCustomerOrderById)
+
+			// SUPPLIER ORDER
+			supplierOnly := middlewares.RoleMiddleware(auth.RoleSupplier)
+			secured.GET("/supplier/order/list", supplierOnly, orderRepo.GetSupplierOrdersData)
+			secured.GET("/supplier/order/data/:id", supplierOnly, orderRepo.GetSupplierOrderById)
+			secured.PUT("/supplier/order/accept/:id", supplierOnly, orderRepo.AcceptSupplierOrder)
+			secured.PUT("/supplier/order/reject/:id", supplierOnly, orderRepo.RejectSupplierOrder)
+			secured.POST("/supplier/order/ship/:id", supplierOnly, orderRepo.ShipSupplierOrder)
+
+			// CART
+			secured.GET("/customer/cart", customerOnly, cartRepo.GetCartData)
+			secured.POST("/customer/cart/item/create", customerOnly, cartRepo.SaveCartItemData)
+			secured.PUT("/customer/cart/item/update/:id", customerOnly, cartRepo.UpdateCartItem)
+			secured.DELETE("/customer/cart/item/delete/:id", customerOnly, cartRepo.DeleteCartItem)
+			secured.POST("/customer/cart/checkout", customerOnly, cartRepo.CheckoutCart)
+			secured.GET("/customer/checkout/list", customerOnly, cartRepo.GetCheckoutsData)
+			secured.GET("/customer/checkout/data/:id", customerOnly, cartRepo.GetCheckoutById)
+
+			// SUBSCRIPTION
+			secured.GET("/customer/subscription/list", customerOnly, subscriptionRepo.GetSubscriptionsData)
+			secured.GET("/customer/subscription/data/:id", customerOnly, subscriptionRepo.GetSubscriptionById)
+			secured.GET("/customer/subscription/runs/:id", customerOnly, subscriptionRepo.GetSubscriptionRunsData)
+			secured.POST("/customer/subscription/create", customerOnly, subscriptionRepo.SaveSubscriptionData)
+			secured.PUT("/customer/subscription/update/:id", customerOnly, subscriptionRepo.UpdateSubscription)
+			secured.PUT("/customer/subscription/pause/:id", customerOnly, subscriptionRepo.PauseSubscription)
+			secured.PUT("/customer/subscription/resume/:id", customerOnly, subscriptionRepo.ResumeSubscription)
+			secured.PUT("/customer/subscription/skip/:id", customerOnly, subscriptionRepo.SkipSubscription)
+			secured.PUT("/customer/subscription/cancel/:id", customerOnly, subscriptionRepo.CancelSubscription)
+
+			// SHIPPING ADDRESS
+			secured.GET("/customer/address/list", customerOnly, shippingAddressRepo.GetShippingAddressesData)
+			secured.POST("/customer/address/create", customerOnly, shippingAddressRepo.SaveShippingAddressData)
+			secured.PUT("/customer/address/update/:id", customerOnly, shippingAddressRepo.UpdateShippingAddress)
+			secured.DELETE("/customer/address/delete/:id", customerOnly, shippingAddressRepo.DeleteShippingAddress)
+
+			// SHIPMENT
+			supplierOrAdmin := middlewares.RoleMiddleware(auth.RoleSupplier, auth.RoleAdmin)
+			secured.GET("/shipment/data/:id", shipmentRepo.GetShipmentById)
+			secured.GET("/shipment/order/:id", shipmentRepo.GetOrderShipmentsData)
+			secured.POST("/shipment/create", supplierOrAdmin, shipmentRepo.SaveShipmentData)
+			secured.PUT("/shipment/update/:id", supplierOrAdmin, shipmentRepo.UpdateShipment)
+			secured.PUT("/shipment/deliver/:id", supplierOrAdmin, shipmentRepo.DeliverShipment)
+
+			// PURCHASE ORDER
+			secured.GET("/purchase-order/list", supplierOrAdmin, purchaseOrderRepo.GetPurchaseOrdersData)
+			secured.GET("/purchase-order/data/:id", supplierOrAdmin, purchaseOrderRepo.GetPurchaseOrderById)
+			secured.GET("/purchase-order/receipts/:id", supplierOrAdmin, purchaseOrderRepo.GetGoodsReceiptsData)
+			secured.POST("/purchase-order/create", adminOnly, purchaseOrderRepo.SavePurchaseOrderData)
+			secured.PUT("/purchase-order/update/:id", adminOnly, purchaseOrderRepo.UpdatePurchaseOrder)
+			secured.PUT("/purchase-order/send/:id", adminOnly, purchaseOrderRepo.SendPurchaseOrder)
+			secured.PUT("/purchase-order/close/:id", adminOnly, purchaseOrderRepo.ClosePurchaseOrder)
+			secured.POST("/purchase-order/receive/:id", adminOnly, purchaseOrderRepo.ReceivePurchaseOrder)
+			secured.DELETE("/purchase-order/delete/:id", adminOnly, purchaseOrderRepo.DeletePurchaseOrder)
+
+			// STOCK ALERT
+			secured.GET("/product/low-stock", supplierOrAdmin, productRepo.GetLowStockData)
+
+			// COUPON
+			secured.GET("/coupon/list", adminOnly, couponRepo.GetCouponsData)
+			secured.GET("/coupon/data/:id", adminOnly, couponRepo.GetCouponById)
+			secured.POST("/coupon/create", adminOnly, couponRepo.SaveCouponData)
+			secured.PUT("/coupon/update/:id", adminOnly, couponRepo.UpdateCoupon)
+			secured.DELETE("/coupon/delete/:id", adminOnly, couponRepo.DeleteCoupon)
+
+			// TAX RATE
+			secured.GET("/tax-rate/list", adminOnly, taxRateRepo.GetTaxRatesData)
+			secured.GET("/tax-rate/data/:id", adminOnly, taxRateRepo.GetTaxRateById)
+			secured.POST("/tax-rate/create", adminOnly, taxRateRepo.SaveTaxRateData)
+			secured.PUT("/tax-rate/update/:id", adminOnly, taxRateRepo.UpdateTaxRate)
+			secured.DELETE("/tax-rate/delete/:id", adminOnly, taxRateRepo.DeleteTaxRate)
+
+			// WAREHOUSE
+			secured.GET("/warehouse/list", adminOnly, warehouseRepo.GetWarehousesData)
+			secured.GET("/warehouse/data/:id", adminOnly, warehouseRepo.GetWarehouseById)
+			secured.POST("/warehouse/create", adminOnly, warehouseRepo.SaveWarehouseData)
+			secured.PUT("/warehouse/update/:id", adminOnly, warehouseRepo.UpdateWarehouse)
+			secured.DELETE("/warehouse/delete/:id", adminOnly, warehouseRepo.DeleteWarehouse)
+			secured.POST("/warehouse/transfer", adminOnly, warehouseRepo.TransferStock)
+			secured.GET("/warehouse/stock/:id", adminOnly, warehouseRepo.GetProductWarehouseStocks)
 		}
 	}
 
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// Address is embedded in every record that needs a postal address
+type Address struct {
+	RecipientName string `gorm:"size:255" json:"recipient_name"`
+	Phone         string `gorm:"size:255" json:"phone"`
+	Line1         string `gorm:"size:255" json:"line1"`
+	Line2         string `gorm:"size:255" json:"line2"`
+	City          string `gorm:"size:255" json:"city"`
+	Province      string `gorm:"size:255" json:"province"`
+	PostalCode    string `gorm:"size:50" json:"postal_code"`
+	Country       string `gorm:"size:2" json:"country"`
+}
+
+// columns of an Address embedded with the prefix, to select them for an update
+func AddressColumns(prefix string) []string {
+	return []string{
+		prefix + "recipient_name", prefix + "phone", prefix + "line1", prefix + "line2",
+		prefix + "city", prefix + "province", prefix + "postal_code", prefix + "country",
+	}
+}
+
+// saved addresses of a customer
+type ShippingAddress struct {
+	gorm.Model
+	ShippingAddressCustomerId int     `gorm:"not null;index" json:"shipping_address_customer_id"`
+	ShippingAddressLabel      string  `gorm:"size:255" json:"shipping_address_label"`
+	ShippingAddress           Address `gorm:"embedded;embeddedPrefix:shipping_address_" json:"shipping_address"`
+}
+
+func CreateShippingAddress(db *gorm.DB, ShippingAddress *ShippingAddress) (err error) {
+	err = db.Create(ShippingAddress).Error
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// get shipping addresses of a customer
+func GetShippingAddressesByCustomer(db *gorm.DB, ShippingAddresses *[]ShippingAddress, customerId int) (err error) {
+	err = db.Where("shipping_address_customer_id = ?", customerId).Order("id asc").Find(ShippingAddresses).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// get shipping address by id, only when it belongs to the customer
+func GetShippingAddressById(db *gorm.DB, ShippingAddress *ShippingAddress, id, customerId int) (err error) {
+	err = db.Where("id = ? AND shipping_address_customer_id = ?", id, customerId).First(ShippingAddress).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// update shipping address
+func UpdateShippingAddress(db *gorm.DB, ShippingAddress *ShippingAddress, id int) (err error) {
+	err = db.Where("id = ?", id).Updates(ShippingAddress).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// delete shipping address
+func DeleteShippingAddress(db *gorm.DB, ShippingAddress *ShippingAddress, id, customerId int) (err error) {
+	err = db.Where("id = ? AND shipping_address_customer_id = ?", id, customerId).Delete(ShippingAddress).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"be-dbo-golang/utils/pagination"
+
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
@@ -14,6 +16,15 @@ type Admin struct {
 	AdminPhone    string `gorm:"size:255;not null" json:"admin_phone"`
 }
 
+// fields the admin list can be sorted by
+var AdminSorts = pagination.Sortable{
+	"id":         "id",
+	"name":       "admin_name",
+	"username":   "admin_username",
+	"email":      "admin_email",
+	"created_at": "created_at",
+}
+
 // Record admin data
 func CreateAdmin(db *gorm.DB, Admin *Admin) (err error) {
 	err = db.Create(Admin).Error
@@ -26,7 +37,7 @@ func CreateAdmin(db *gorm.DB, Admin *Admin) (err error) {
 }
 
 // Get Admin List
-func (a *Admin) GetAdminsPaginate(db *gorm.DB, page, pageSize int, sortField, sortOrder string) ([]Admin, int, error) {
+func (a *Admin) GetAdminsPaginate(db *gorm.DB, page, pageSize int, orderBy string) ([]Admin, int, error) {
 	var admins []Admin
 	var count int64
 
@@ -39,7 +50,7 @@ func (a *Admin) GetAdminsPaginate(db *gorm.DB, page, pageSize int, sortField, so
 	totalPages := (int(count) + pageSize - 1) / pageSize
 
 	// Paginate and sort
-	if err := db.Order(sortField + " " + sortOrder).Offset((page - 1) * pageSize).Limit(pageSize).Find(&admins).Error; err != nil {
+	if err := db.Order(orderBy).Offset((page - 1) * pageSize).Limit(pageSize).Find(&admins).Error; err != nil {
 		return nil, 0, err
 	}
 
@@ -1,6 +1,9 @@
 package models
 
 import (
+	"be-dbo-golang/utils/filter"
+	"be-dbo-golang/utils/pagination"
+
 	"gorm.io/gorm"
 )
 
@@ -10,6 +13,25 @@ type Brand struct {
 	BrandCode string `gorm:"size:255;not null" json:"brand_code"`
 }
 
+// fields the brand list can be filtered on
+var BrandFilters = filter.Spec{
+	Fields: map[string]filter.Field{
+		"id":         {Column: "id", Kind: filter.Int, Ops: filter.Comparable},
+		"name":       {Column: "brand_name", Kind: filter.String, Ops: filter.Text},
+		"code":       {Column: "brand_code", Kind: filter.String, Ops: filter.Text},
+		"created_at": {Column: "created_at", Kind: filter.Time, Ops: filter.Range},
+	},
+	Search: []string{"brand_name", "brand_code"},
+}
+
+// fields the brand list can be sorted by
+var BrandSorts = pagination.Sortable{
+	"id":         "id",
+	"name":       "brand_name",
+	"code":       "brand_code",
+	"created_at": "created_at",
+}
+
 func CreateBrand(db *gorm.DB, Brand *Brand) (err error) {
 	err = db.Create(Brand).Error
 
@@ -20,7 +42,7 @@ func CreateBrand(db *gorm.DB, Brand *Brand) (err error) {
 	return nil
 }
 
-func (b *Brand) GetBrandsPaginate(db *gorm.DB, page, pageSize int, sortField, sortOrder string) ([]Brand, int, error) {
+func (b *Brand) GetBrandsPaginate(db *gorm.DB, page, pageSize int, orderBy string) ([]Brand, int, error) {
 	var brands []Brand
 	var count int64
 
@@ -33,7 +55,7 @@ func (b *Brand) GetBrandsPaginate(db *gorm.DB, page, pageSize int, sortField, so
 	totalPages := (int(count) + pageSize - 1) / pageSize
 
 	// Paginate and sort
-	if err := db.Order(sortField + " " + sortOrder).Offset((page - 1) * pageSize).Limit(pageSize).Find(&brands).Error; err != nil {
+	if err := db.Order(orderBy).Offset((page - 1) * pageSize).Limit(pageSize).Find(&brands).Error; err != nil {
 		return nil, 0, err
 	}
 
@@ -0,0 +1,262 @@
+package models
+
+import (
+	"be-dbo-golang/utils/money"
+	"errors"
+	"sort"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrCartEmpty              = errors.New("cart is empty")
+	ErrCartProductUnavailable = errors.New("a product in the cart is no longer available")
+)
+
+// Cart keeps the items a customer is about to order, there is one cart per customer
+type Cart struct {
+	gorm.Model
+	CartCustomerId int           `gorm:"not null;uniqueIndex" json:"cart_customer_id"`
+	CartItems      []CartItem    `gorm:"foreignKey:CartItemCartId" json:"cart_items"`
+	CartSubtotals  []money.Money `gorm:"-" json:"cart_subtotals"`
+}
+
+// CartItem stores the product and quantity, prices are read from the product every time the cart is priced
+type CartItem struct {
+	gorm.Model
+	CartItemCartId      int         `gorm:"type:bigint unsigned;not null;uniqueIndex:idx_cart_item_variant" json:"cart_item_cart_id"`
+	CartItemProductId   int         `gorm:"not null;uniqueIndex:idx_cart_item_variant" json:"cart_item_product_id"`
+	CartItemVariantId   int         `gorm:"not null;default:0;uniqueIndex:idx_cart_item_variant" json:"cart_item_variant_id"`
+	CartItemQty         int         `gorm:"not null" json:"cart_item_qty"`
+	CartItemProductName string      `gorm:"-" json:"cart_item_product_name"`
+	CartItemSku         string      `gorm:"-" json:"cart_item_sku"`
+	CartItemSupplierId  int         `gorm:"-" json:"cart_item_supplier_id"`
+	CartItemUnitPrice   money.Money `gorm:"-" json:"cart_item_unit_price"`
+	CartItemTotalAmount money.Money `gorm:"-" json:"cart_item_total_amount"`
+	CartItemStock       int         `gorm:"-" json:"cart_item_stock"`
+	CartItemAvailable   bool        `gorm:"-" json:"cart_item_available"`
+	// part of the quantity that would be backordered at checkout
+	CartItemBackorderQty int `gorm:"-" json:"cart_item_backorder_qty"`
+}
+
+// get the cart of a customer, creating it the first time
+func GetCustomerCart(db *gorm.DB, Cart *Cart, customerId int) (err error) {
+	Cart.CartCustomerId = customerId
+
+	err = db.Preload("CartItems", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id asc")
+	}).Where("cart_customer_id = ?", customerId).FirstOrCreate(Cart).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// add the quantity to the cart, an item already in the cart is increased
+func AddCartItem(db *gorm.DB, item *CartItem) (err error) {
+	return db.Transaction(func(tx *gorm.DB) error {
+		existing := CartItem{}
+
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("cart_item_cart_id = ? AND cart_item_product_id = ? AND cart_item_variant_id = ?", item.CartItemCartId, item.CartItemProductId, item.CartItemVariantId).First(&existing).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return tx.Create(item).Error
+		}
+		if err != nil {
+			return err
+		}
+
+		existing.CartItemQty += item.CartItemQty
+		*item = existing
+
+		return tx.Model(item).Update("cart_item_qty", item.CartItemQty).Error
+	})
+}
+
+// get CartItem by id, only when it is in the cart
+func GetCartItemById(db *gorm.DB, CartItem *CartItem, id, cartId int) (err error) {
+	err = db.Where("id = ? AND cart_item_cart_id = ?", id, cartId).First(CartItem).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// update CartItem quantity
+func UpdateCartItem(db *gorm.DB, CartItem *CartItem, id int) (err error) {
+	err = db.Model(CartItem).Where("id = ?", id).Update("cart_item_qty", CartItem.CartItemQty).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// delete CartItem
+func DeleteCartItem(db *gorm.DB, CartItem *CartItem, id, cartId int) (err error) {
+	db.Unscoped().Where("id = ? AND cart_item_cart_id = ?", id, cartId).Delete(CartItem)
+	return nil
+}
+
+// fill the items with the current product price and stock, subtotals are given per currency
+func PriceCart(db *gorm.DB, Cart *Cart) (err error) {
+	subtotals := map[string]money.Money{}
+
+	for i := range Cart.CartItems {
+		item := &Cart.CartItems[i]
+		p := Product{}
+
+		err := db.Where("id = ?", item.CartItemProductId).First(&p).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			item.CartItemAvailable = false
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		variant, err := ResolveProductVariant(db, p, item.CartItemVariantId)
+		if errors.Is(err, ErrVariantNotFound) || errors.Is(err, ErrVariantRequired) {
+			item.CartItemAvailable = false
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		line := NewVariantOrderLine(p, variant, item.CartItemQty)
+
+		item.CartItemProductName = line.OrderLineProductName
+		item.CartItemSku = line.OrderLineSku
+		item.CartItemSupplierId = p.ProductSupplierId
+		item.CartItemUnitPrice = line.OrderLineUnitPrice
+		item.CartItemTotalAmount = line.OrderLineTotalAmount
+		item.CartItemStock = p.ProductStock
+		if variant != nil {
+			item.CartItemStock = variant.ProductVariantStock
+		}
+
+		shortage, err := p.stockShortage(db, item.CartItemStock, item.CartItemQty, 0)
+		if err != nil && !errors.Is(err, ErrInsufficientStock) {
+			return err
+		}
+		item.CartItemAvailable = err == nil
+		item.CartItemBackorderQty = shortage
+
+		currency := item.CartItemTotalAmount.Currency
+		if subtotal, ok := subtotals[currency]; ok {
+			subtotals[currency] = subtotal.Add(item.CartItemTotalAmount)
+		} else {
+			subtotals[currency] = item.CartItemTotalAmount
+		}
+	}
+
+	Cart.CartSubtotals = []money.Money{}
+	for _, subtotal := range subtotals {
+		Cart.CartSubtotals = append(Cart.CartSubtotals, subtotal)
+	}
+	sort.Slice(Cart.CartSubtotals, func(i, j int) bool {
+		return Cart.CartSubtotals[i].Currency < Cart.CartSubtotals[j].Currency
+	})
+
+	return nil
+}
+
+// turn the cart into a checkout split in one order per supplier and empty it, the coupon goes to the orders it applies to
+func CheckoutCart(db *gorm.DB, Cart *Cart, address Address, couponCode string) (checkout Checkout, err error) {
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var items []CartItem
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("cart_item_cart_id = ?", Cart.ID).Order("id asc").Find(&items).Error; err != nil {
+			return err
+		}
+
+		if len(items) == 0 {
+			return ErrCartEmpty
+		}
+
+		checkout = Checkout{CheckoutCustomerId: Cart.CartCustomerId, CheckoutCouponCode: couponCode, CheckoutShippingAddress: address}
+		if err := tx.Create(&checkout).Error; err != nil {
+			return err
+		}
+		checkoutId := int(checkout.ID)
+
+		var supplierIds []int
+		bySupplier := map[int]*Order{}
+
+		for _, item := range items {
+			p := Product{}
+
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", item.CartItemProductId).First(&p).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return ErrCartProductUnavailable
+				}
+				return err
+			}
+
+			o, ok := bySupplier[p.ProductSupplierId]
+			if !ok {
+				o = &Order{
+					OrderCustomerId:      Cart.CartCustomerId,
+					OrderSupplierId:      p.ProductSupplierId,
+					OrderProductId:       item.CartItemProductId,
+					OrderStatus:          OrderStatusPending,
+					OrderShippingAddress: address,
+					OrderCheckoutId:      &checkoutId,
+				}
+				bySupplier[p.ProductSupplierId] = o
+				supplierIds = append(supplierIds, p.ProductSupplierId)
+			}
+
+			variant, err := ResolveProductVariant(tx, p, item.CartItemVariantId)
+			if errors.Is(err, ErrVariantNotFound) || errors.Is(err, ErrVariantRequired) {
+				return ErrCartProductUnavailable
+			}
+			if err != nil {
+				return err
+			}
+
+			o.OrderQty += item.CartItemQty
+			o.OrderLines = append(o.OrderLines, NewVariantOrderLine(p, variant, item.CartItemQty))
+		}
+
+		couponApplied := couponCode == ""
+
+		for _, supplierId := range supplierIds {
+			o := bySupplier[supplierId]
+
+			if !couponApplied {
+				// PlaceOrder runs in a savepoint, an order the coupon doesn't fit is placed again without it
+				attempt := *o
+				attempt.OrderLines = append([]OrderLine(nil), o.OrderLines...)
+
+				err := PlaceOrder(tx, &attempt, couponCode)
+				if err == nil {
+					couponApplied = true
+					checkout.CheckoutOrders = append(checkout.CheckoutOrders, attempt)
+					continue
+				}
+				if !errors.Is(err, ErrCouponNotApplicable) && !errors.Is(err, ErrCouponMinSpend) {
+					return err
+				}
+			}
+
+			if err := PlaceOrder(tx, o, ""); err != nil {
+				return err
+			}
+			checkout.CheckoutOrders = append(checkout.CheckoutOrders, *o)
+		}
+
+		if !couponApplied {
+			return ErrCouponNotApplicable
+		}
+
+		return tx.Unscoped().Where("cart_item_cart_id = ?", Cart.ID).Delete(&CartItem{}).Error
+	})
+
+	if err != nil {
+		return Checkout{}, err
+	}
+
+	Cart.CartItems = nil
+	checkout.summarize()
+	return checkout, nil
+}
@@ -0,0 +1,191 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrCategoryHasChildren = errors.New("category still has child categories")
+	ErrCategoryCycle       = errors.New("category can't be moved below itself")
+)
+
+// Category is a node of the category tree, the path lists the ids from the root down to the category
+type Category struct {
+	gorm.Model
+	CategoryParentId  *int       `gorm:"type:bigint unsigned;index" json:"category_parent_id"`
+	CategoryName      string     `gorm:"size:255;not null" json:"category_name"`
+	CategorySlug      string     `gorm:"size:255;not null" json:"category_slug"`
+	CategoryPath      string     `gorm:"size:512;not null;index" json:"category_path"`
+	CategoryDepth     int        `gorm:"not null;default:0" json:"category_depth"`
+	CategorySortOrder int        `gorm:"not null;default:0" json:"category_sort_order"`
+	CategoryChildren  []Category `gorm:"-" json:"category_children,omitempty"`
+}
+
+// path of a category below the parent, e.g. "1/5/12/"
+func categoryPath(parent *Category, id uint) string {
+	if parent == nil {
+		return fmt.Sprintf("%d/", id)
+	}
+	return fmt.Sprintf("%s%d/", parent.CategoryPath, id)
+}
+
+func CreateCategory(db *gorm.DB, category *Category) (err error) {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var parent *Category
+		if category.CategoryParentId != nil {
+			parent = &Category{}
+			if err := tx.Where("id = ?", *category.CategoryParentId).First(parent).Error; err != nil {
+				return err
+			}
+			category.CategoryDepth = parent.CategoryDepth + 1
+		}
+
+		if err := tx.Create(category).Error; err != nil {
+			return err
+		}
+
+		category.CategoryPath = categoryPath(parent, category.ID)
+		return tx.Model(category).Update("category_path", category.CategoryPath).Error
+	})
+}
+
+// get every category in tree order, siblings by sort order and name
+func GetCategories(db *gorm.DB, Categories *[]Category) (err error) {
+	err = db.Order("category_depth asc, category_sort_order asc, category_name asc").Find(Categories).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// nest the categories below their parents, the roots are returned
+func CategoryTree(categories []Category) []Category {
+	children := map[int][]Category{}
+	for _, category := range categories {
+		parentId := 0
+		if category.CategoryParentId != nil {
+			parentId = *category.CategoryParentId
+		}
+		children[parentId] = append(children[parentId], category)
+	}
+
+	var nest func(parentId int) []Category
+	nest = func(parentId int) []Category {
+		nodes := children[parentId]
+		for i := range nodes {
+			nodes[i].CategoryChildren = nest(int(nodes[i].ID))
+		}
+		return nodes
+	}
+
+	return nest(0)
+}
+
+// get Category by id
+func GetCategoryById(db *gorm.DB, Category *Category, id int) (err error) {
+	err = db.Where("id = ?", id).First(Category).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// update Category, moving it to another parent moves its descendants along
+func UpdateCategory(db *gorm.DB, category *Category, parentId *int) (err error) {
+	return db.Transaction(func(tx *gorm.DB) error {
+		oldPath := category.CategoryPath
+		oldDepth := category.CategoryDepth
+
+		var parent *Category
+		if parentId != nil {
+			parent = &Category{}
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", *parentId).First(parent).Error; err != nil {
+				return err
+			}
+			if strings.HasPrefix(parent.CategoryPath, oldPath) {
+				return ErrCategoryCycle
+			}
+		}
+
+		category.CategoryParentId = parentId
+		category.CategoryPath = categoryPath(parent, category.ID)
+		category.CategoryDepth = 0
+		if parent != nil {
+			category.CategoryDepth = parent.CategoryDepth + 1
+		}
+
+		if err := tx.Model(category).Select("category_parent_id", "category_name", "category_slug", "category_path", "category_depth", "category_sort_order").Updates(category).Error; err != nil {
+			return err
+		}
+
+		if category.CategoryPath == oldPath {
+			return nil
+		}
+
+		return tx.Model(&Category{}).Where("category_path LIKE ? AND id <> ?", oldPath+"%", category.ID).Updates(map[string]interface{}{
+			"category_path":  gorm.Expr("CONCAT(?, SUBSTRING(category_path, ?))", category.CategoryPath, len(oldPath)+1),
+			"category_depth": gorm.Expr("category_depth + ?", category.CategoryDepth-oldDepth),
+		}).Error
+	})
+}
+
+// delete Category, only a leaf can be deleted and its products lose the category
+func DeleteCategory(db *gorm.DB, Category *Category, id int) (err error) {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var children int64
+		if err := tx.Model(Category).Where("category_parent_id = ?", id).Count(&children).Error; err != nil {
+			return err
+		}
+		if children > 0 {
+			return ErrCategoryHasChildren
+		}
+
+		if err := tx.Table("product_categories").Where("category_id = ?", id).Delete(nil).Error; err != nil {
+			return err
+		}
+
+		return tx.Where("id = ?", id).Delete(Category).Error
+	})
+}
+
+// replace the categories of the product
+func SetProductCategories(db *gorm.DB, product *Product, categoryIds []int) (err error) {
+	var categories []Category
+	if len(categoryIds) > 0 {
+		if err := db.Where("id IN ?", categoryIds).Find(&categories).Error; err != nil {
+			return err
+		}
+	}
+
+	return db.Model(product).Association("ProductCategories").Replace(categories)
+}
+
+// products in the category or any category below it
+func (p *Product) GetCategoryProductsPaginate(db *gorm.DB, category Category, page, pageSize int, orderBy string) ([]Product, int, error) {
+	var products []Product
+	var count int64
+
+	inCategory := db.Table("product_categories").Select("product_categories.product_id").
+		Joins("JOIN categories ON categories.id = product_categories.category_id AND categories.deleted_at IS NULL").
+		Where("categories.category_path LIKE ?", category.CategoryPath+"%")
+
+	// Count total records
+	if err := db.Model(&Product{}).Where("id IN (?)", inCategory).Count(&count).Error; err != nil {
+		return nil, 0, err
+	}
+
+	// Calculate total pages
+	totalPages := (int(count) + pageSize - 1) / pageSize
+
+	// Paginate and sort
+	if err := PreloadProductDetails(db).Where("id IN (?)", inCategory).Order(orderBy).Offset((page - 1) * pageSize).Limit(pageSize).Find(&products).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return products, totalPages, nil
+}
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"be-dbo-golang/utils/money"
+	"sort"
+
+	"gorm.io/gorm"
+)
+
+// Checkout groups the supplier orders placed together by a customer, each order keeps its own status and totals
+type Checkout struct {
+	gorm.Model
+	CheckoutCustomerId      int           `gorm:"type:bigint unsigned;not null;index" json:"checkout_customer_id"`
+	CheckoutCouponCode      string        `gorm:"size:64" json:"checkout_coupon_code"`
+	CheckoutShippingAddress Address       `gorm:"embedded;embeddedPrefix:checkout_shipping_" json:"checkout_shipping_address"`
+	CheckoutOrders          []Order       `gorm:"foreignKey:OrderCheckoutId" json:"checkout_orders"`
+	CheckoutStatus          string        `gorm:"-" json:"checkout_status"`
+	CheckoutTotals          []money.Money `gorm:"-" json:"checkout_totals"`
+}
+
+// status of the checkout from the statuses of its orders, rejected orders only count when all are rejected
+func aggregateOrderStatus(orders []Order) string {
+	counts := map[string]int{}
+	live := 0
+
+	for _, o := range orders {
+		counts[o.OrderStatus]++
+		if o.OrderStatus != OrderStatusRejected {
+			live++
+		}
+	}
+
+	switch {
+	case live == 0:
+		return OrderStatusRejected
+	case counts[OrderStatusDelivered] == live:
+		return OrderStatusDelivered
+	case counts[OrderStatusShipped]+counts[OrderStatusDelivered] == live:
+		return OrderStatusShipped
+	case counts[OrderStatusShipped]+counts[OrderStatusDelivered]+counts[OrderStatusPartiallyShipped] > 0:
+		return OrderStatusPartiallyShipped
+	case counts[OrderStatusAccepted] == live:
+		return OrderStatusAccepted
+	case counts[OrderStatusBackordered] > 0:
+		return OrderStatusBackordered
+	}
+	return OrderStatusPending
+}
+
+// fill the aggregated status and the totals per currency of the orders that weren't rejected
+func (checkout *Checkout) summarize() {
+	checkout.CheckoutStatus = aggregateOrderStatus(checkout.CheckoutOrders)
+
+	totals := map[string]money.Money{}
+	for _, o := range checkout.CheckoutOrders {
+		if o.OrderStatus == OrderStatusRejected {
+			continue
+		}
+
+		currency := o.OrderTotalAmount.Currency
+		if total, ok := totals[currency]; ok {
+			totals[currency] = total.Add(o.OrderTotalAmount)
+		} else {
+			totals[currency] = o.OrderTotalAmount
+		}
+	}
+
+	checkout.CheckoutTotals = []money.Money{}
+	for _, total := range totals {
+		checkout.CheckoutTotals = append(checkout.CheckoutTotals, total)
+	}
+	sort.Slice(checkout.CheckoutTotals, func(i, j int) bool {
+		return checkout.CheckoutTotals[i].Currency < checkout.CheckoutTotals[j].Currency
+	})
+}
+
+func preloadCheckoutOrders(db *gorm.DB) *gorm.DB {
+	return db.Preload("CheckoutOrders", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id asc")
+	}).Preload("CheckoutOrders.OrderLines")
+}
+
+// get checkouts of a customer, latest first
+func GetCheckoutsByCustomer(db *gorm.DB, Checkouts *[]Checkout, customerId int) (err error) {
+	err = preloadCheckoutOrders(db).Where("checkout_customer_id = ?", customerId).Order("id desc").Find(Checkouts).Error
+	if err != nil {
+		return err
+	}
+
+	for i := range *Checkouts {
+		(*Checkouts)[i].summarize()
+	}
+	return nil
+}
+
+// get checkout by id, only when it belongs to the customer
+func GetCheckoutById(db *gorm.DB, Checkout *Checkout, id, customerId int) (err error) {
+	err = preloadCheckoutOrders(db).Where("id = ? AND checkout_customer_id = ?", id, customerId).First(Checkout).Error
+	if err != nil {
+		return err
+	}
+
+	Checkout.summarize()
+	return nil
+}
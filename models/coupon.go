@@ -0,0 +1,207 @@
+package models
+
+import (
+	"be-dbo-golang/utils/money"
+	"be-dbo-golang/utils/pagination"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	CouponDiscountPercentage = "percentage"
+	CouponDiscountFixed      = "fixed"
+)
+
+var (
+	ErrCouponNotFound      = errors.New("coupon not found")
+	ErrCouponNotActive     = errors.New("coupon is not active")
+	ErrCouponExhausted     = errors.New("coupon usage limit reached")
+	ErrCouponMinSpend      = errors.New("order does not reach the coupon minimum spend")
+	ErrCouponNotApplicable = errors.New("coupon does not apply to any product in the order")
+)
+
+// Coupon is redeemed by code, automatic coupons are promotions applied to every matching order
+type Coupon struct {
+	gorm.Model
+	CouponCode             string      `gorm:"size:64;not null;unique" json:"coupon_code"`
+	CouponName             string      `gorm:"size:255;not null" json:"coupon_name"`
+	CouponDiscountType     string      `gorm:"size:20;not null" json:"coupon_discount_type"`
+	CouponDiscountPercent  float64     `gorm:"not null;default:0" json:"coupon_discount_percent"`
+	CouponDiscountAmount   money.Money `gorm:"embedded;embeddedPrefix:coupon_discount_amount_" json:"coupon_discount_amount"`
+	CouponMinSpend         money.Money `gorm:"embedded;embeddedPrefix:coupon_min_spend_" json:"coupon_min_spend"`
+	CouponUsageLimit       int         `gorm:"not null;default:0" json:"coupon_usage_limit"`
+	CouponPerCustomerLimit int         `gorm:"not null;default:0" json:"coupon_per_customer_limit"`
+	CouponUsedCount        int         `gorm:"not null;default:0" json:"coupon_used_count"`
+	CouponStartsAt         *time.Time  `json:"coupon_starts_at"`
+	CouponEndsAt           *time.Time  `json:"coupon_ends_at"`
+	CouponBrandId          int         `gorm:"not null;default:0" json:"coupon_brand_id"`
+	CouponSupplierId       int         `gorm:"not null;default:0" json:"coupon_supplier_id"`
+	CouponProductId        int         `gorm:"not null;default:0" json:"coupon_product_id"`
+	CouponIsAutomatic      bool        `gorm:"not null;default:false;index" json:"coupon_is_automatic"`
+	CouponIsActive         bool        `gorm:"not null;default:true" json:"coupon_is_active"`
+}
+
+// fields the coupon list can be sorted by
+var CouponSorts = pagination.Sortable{
+	"id":         "id",
+	"code":       "coupon_code",
+	"name":       "coupon_name",
+	"used_count": "coupon_used_count",
+	"starts_at":  "coupon_starts_at",
+	"ends_at":    "coupon_ends_at",
+	"created_at": "created_at",
+}
+
+type CouponRedemption struct {
+	gorm.Model
+	CouponRedemptionCouponId   int         `gorm:"not null;index" json:"coupon_redemption_coupon_id"`
+	CouponRedemptionCustomerId int         `gorm:"not null;index" json:"coupon_redemption_customer_id"`
+	CouponRedemptionOrderId    int         `gorm:"not null;index" json:"coupon_redemption_order_id"`
+	CouponRedemptionAmount     money.Money `gorm:"embedded;embeddedPrefix:coupon_redemption_amount_" json:"coupon_redemption_amount"`
+}
+
+func CreateCoupon(db *gorm.DB, Coupon *Coupon) (err error) {
+	err = db.Create(Coupon).Error
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (cp *Coupon) GetCouponsPaginate(db *gorm.DB, page, pageSize int, orderBy string) ([]Coupon, int, error) {
+	var coupons []Coupon
+	var count int64
+
+	// Count total records
+	if err := db.Model(&Coupon{}).Count(&count).Error; err != nil {
+		return nil, 0, err
+	}
+
+	// Calculate total pages
+	totalPages := (int(count) + pageSize - 1) / pageSize
+
+	// Paginate and sort
+	if err := db.Order(orderBy).Offset((page - 1) * pageSize).Limit(pageSize).Find(&coupons).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return coupons, totalPages, nil
+}
+
+// get Coupon by id
+func GetCouponById(db *gorm.DB, Coupon *Coupon, id int) (err error) {
+	err = db.Where("id = ?", id).First(Coupon).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// update Coupon, zero values are written too so flags and limits can be switched off. The used count is left to
+// redemptions, which may happen while the update runs
+func UpdateCoupon(db *gorm.DB, Coupon *Coupon, id int) (err error) {
+	err = db.Select("*").Omit("id", "created_at", "deleted_at", "coupon_used_count").Where("id = ?", id).Updates(Coupon).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// delete Coupon
+func DeleteCoupon(db *gorm.DB, Coupon *Coupon, id int) (err error) {
+	db.Where("id = ?", id).Delete(Coupon)
+	return nil
+}
+
+// check window, activation and usage caps of the coupon for a customer
+func (cp *Coupon) validFor(db *gorm.DB, customerId int, now time.Time) error {
+	if !cp.CouponIsActive || (cp.CouponStartsAt != nil && now.Before(*cp.CouponStartsAt)) || (cp.CouponEndsAt != nil && now.After(*cp.CouponEndsAt)) {
+		return ErrCouponNotActive
+	}
+
+	if cp.CouponUsageLimit > 0 && cp.CouponUsedCount >= cp.CouponUsageLimit {
+		return ErrCouponExhausted
+	}
+
+	if cp.CouponPerCustomerLimit > 0 {
+		var used int64
+		if err := db.Model(&CouponRedemption{}).Where("coupon_redemption_coupon_id = ? AND coupon_redemption_customer_id = ?", cp.ID, customerId).Count(&used).Error; err != nil {
+			return err
+		}
+
+		if int(used) >= cp.CouponPerCustomerLimit {
+			return ErrCouponExhausted
+		}
+	}
+
+	return nil
+}
+
+// whether the coupon scope covers the product
+func (cp *Coupon) covers(p Product) bool {
+	if cp.CouponProductId > 0 && int(p.ID) != cp.CouponProductId {
+		return false
+	}
+	if cp.CouponBrandId > 0 && p.ProductBrandId != cp.CouponBrandId {
+		return false
+	}
+	if cp.CouponSupplierId > 0 && p.ProductSupplierId != cp.CouponSupplierId {
+		return false
+	}
+	return true
+}
+
+// discount per line index of the coupon, spread over the eligible lines by their amount
+func (cp *Coupon) lineDiscounts(lines []OrderLine, products map[int]Product) (map[int]money.Money, error) {
+	if len(lines) == 0 {
+		return nil, ErrCouponNotApplicable
+	}
+
+	eligible := money.Zero(lines[0].OrderLineTotalAmount.Currency)
+	var covered []int
+	var weights []int64
+
+	for i, line := range lines {
+		if cp.covers(products[line.OrderLineProductId]) {
+			amount := line.OrderLineTotalAmount.Sub(line.OrderLineDiscountAmount)
+			eligible = eligible.Add(amount)
+			covered = append(covered, i)
+			weights = append(weights, amount.Minor)
+		}
+	}
+
+	if len(covered) == 0 || eligible.Minor <= 0 {
+		return nil, ErrCouponNotApplicable
+	}
+
+	// fixed amounts and minimum spend only make sense in the currency they were set in
+	if !cp.CouponMinSpend.IsZero() {
+		if !cp.CouponMinSpend.SameCurrency(eligible) {
+			return nil, ErrCouponNotApplicable
+		}
+		if eligible.Cmp(cp.CouponMinSpend) < 0 {
+			return nil, ErrCouponMinSpend
+		}
+	}
+
+	var discount money.Money
+	if cp.CouponDiscountType == CouponDiscountPercentage {
+		discount = eligible.Percent(cp.CouponDiscountPercent)
+	} else {
+		if !cp.CouponDiscountAmount.SameCurrency(eligible) {
+			return nil, ErrCouponNotApplicable
+		}
+		discount = cp.CouponDiscountAmount.Min(eligible)
+	}
+
+	discounts := map[int]money.Money{}
+	for n, share := range discount.Allocate(weights) {
+		discounts[covered[n]] = share
+	}
+
+	return discounts, nil
+}
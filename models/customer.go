@@ -1,6 +1,9 @@
 package models
 
 import (
+	"be-dbo-golang/utils/filter"
+	"be-dbo-golang/utils/pagination"
+
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
@@ -15,6 +18,28 @@ type Customer struct {
 	CustomerAddress  string `json:"customer_address"`
 }
 
+// fields the customer list can be filtered on
+var CustomerFilters = filter.Spec{
+	Fields: map[string]filter.Field{
+		"id":         {Column: "id", Kind: filter.Int, Ops: filter.Comparable},
+		"name":       {Column: "customer_name", Kind: filter.String, Ops: filter.Text},
+		"username":   {Column: "customer_username", Kind: filter.String, Ops: filter.Text},
+		"email":      {Column: "customer_email", Kind: filter.String, Ops: filter.Text},
+		"phone":      {Column: "customer_phone", Kind: filter.String, Ops: filter.Text},
+		"created_at": {Column: "created_at", Kind: filter.Time, Ops: filter.Range},
+	},
+	Search: []string{"customer_name", "customer_username", "customer_email", "customer_phone"},
+}
+
+// fields the customer list can be sorted by
+var CustomerSorts = pagination.Sortable{
+	"id":         "id",
+	"name":       "customer_name",
+	"username":   "customer_username",
+	"email":      "customer_email",
+	"created_at": "created_at",
+}
+
 func CreateCustomer(db *gorm.DB, Customer *Customer) (err error) {
 	err = db.Create(Customer).Error
 
@@ -25,7 +50,7 @@ func CreateCustomer(db *gorm.DB, Customer *Customer) (err error) {
 	return nil
 }
 
-func (c *Customer) GetCustomersPaginate(db *gorm.DB, page, pageSize int, sortField, sortOrder string) ([]Customer, int, error) {
+func (c *Customer) GetCustomersPaginate(db *gorm.DB, page, pageSize int, orderBy string) ([]Customer, int, error) {
 	var customers []Customer
 	var count int64
 
@@ -38,13 +63,18 @@ func (c *Customer) GetCustomersPaginate(db *gorm.DB, page, pageSize int, sortFie
 	totalPages := (int(count) + pageSize - 1) / pageSize
 
 	// Paginate and sort
-	if err := db.Order(sortField + " " + sortOrder).Offset((page - 1) * pageSize).Limit(pageSize).Find(&customers).Error; err != nil {
+	if err := db.Order(orderBy).Offset((page - 1) * pageSize).Limit(pageSize).Find(&customers).Error; err != nil {
 		return nil, 0, err
 	}
 
 	return customers, totalPages, nil
 }
 
+// call fn for every Customer in the list order, for exports
+func (c *Customer) EachCustomer(db *gorm.DB, orderBy string, fn func(Customer) error) error {
+	return eachRow(db.Order(orderBy), fn)
+}
+
 func GetCustomerByEmail(db *gorm.DB, Customer *Customer, email string) (err error) {
 	err = db.Where("customer_email = ?", email).First(Customer).Error
 	if err != nil {
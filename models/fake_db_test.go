@@ -0,0 +1,110 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"testing"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// statement sent to the fake database
+type fakeQuery struct {
+	SQL  string
+	Args []driver.Value
+}
+
+// fakeDb keeps the statements it is sent and answers the queries with the rows reply gives, so the models can be
+// tested without a mysql server
+type fakeDb struct {
+	queries []fakeQuery
+	reply   func(query string) (columns []string, rows [][]driver.Value)
+}
+
+// gorm on a fake database, queries get no rows when reply is nil
+func newFakeDb(t *testing.T, reply func(query string) ([]string, [][]driver.Value)) (*gorm.DB, *fakeDb) {
+	fake := &fakeDb{reply: reply}
+
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: sql.OpenDB(fake), SkipInitializeWithVersion: true}), &gorm.Config{DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, fake
+}
+
+// last statement sent
+func (f *fakeDb) last() fakeQuery {
+	if len(f.queries) == 0 {
+		return fakeQuery{}
+	}
+	return f.queries[len(f.queries)-1]
+}
+
+func (f *fakeDb) record(query string, args []driver.NamedValue) {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	f.queries = append(f.queries, fakeQuery{SQL: query, Args: values})
+}
+
+func (f *fakeDb) Connect(context.Context) (driver.Conn, error) { return fakeConn{f}, nil }
+func (f *fakeDb) Driver() driver.Driver                        { return fakeDriver{f} }
+
+type fakeDriver struct{ db *fakeDb }
+
+func (d fakeDriver) Open(string) (driver.Conn, error) { return fakeConn{d.db}, nil }
+
+type fakeConn struct{ db *fakeDb }
+
+func (c fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("fake db: prepare not supported")
+}
+func (c fakeConn) Close() error              { return nil }
+func (c fakeConn) Begin() (driver.Tx, error) { return fakeTx{}, nil }
+
+func (c fakeConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.db.record(query, args)
+	return fakeResult{}, nil
+}
+
+func (c fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.db.record(query, args)
+
+	rows := &fakeRows{}
+	if c.db.reply != nil {
+		rows.columns, rows.rows = c.db.reply(query)
+	}
+	return rows, nil
+}
+
+type fakeResult struct{}
+
+func (fakeResult) LastInsertId() (int64, error) { return 1, nil }
+func (fakeResult) RowsAffected() (int64, error) { return 1, nil }
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
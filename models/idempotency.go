@@ -0,0 +1,67 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type IdempotencyKey struct {
+	gorm.Model
+	IdempotencyKey        string    `gorm:"size:255;not null;uniqueIndex:idx_idempotency_key_scope" json:"idempotency_key"`
+	IdempotencyScope      string    `gorm:"size:255;not null;uniqueIndex:idx_idempotency_key_scope" json:"idempotency_scope"`
+	IdempotencyHash       string    `gorm:"size:64;not null" json:"idempotency_hash"`
+	IdempotencyStatusCode int       `gorm:"not null;default:0" json:"idempotency_status_code"`
+	IdempotencyBody       []byte    `json:"idempotency_body"`
+	IdempotencyExpiresAt  time.Time `gorm:"not null;index" json:"idempotency_expires_at"`
+}
+
+// Record idempotency key, fails when the key is already taken for the scope
+func CreateIdempotencyKey(db *gorm.DB, IdempotencyKey *IdempotencyKey) (err error) {
+	err = db.Create(IdempotencyKey).Error
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// get idempotency key by key and scope
+func GetIdempotencyKey(db *gorm.DB, IdempotencyKey *IdempotencyKey, key, scope string) (err error) {
+	err = db.Where("idempotency_key = ? AND idempotency_scope = ?", key, scope).First(IdempotencyKey).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// store the response that belongs to the key
+func CompleteIdempotencyKey(db *gorm.DB, IdempotencyKey *IdempotencyKey, statusCode int, body []byte) (err error) {
+	err = db.Model(IdempotencyKey).Updates(map[string]interface{}{
+		"idempotency_status_code": statusCode,
+		"idempotency_body":        body,
+	}).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// delete idempotency key, hard delete so the key can be used again
+func DeleteIdempotencyKey(db *gorm.DB, IdempotencyKey *IdempotencyKey) (err error) {
+	err = db.Unscoped().Delete(IdempotencyKey).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// delete every expired idempotency key
+func DeleteExpiredIdempotencyKeys(db *gorm.DB, now time.Time) (err error) {
+	err = db.Unscoped().Where("idempotency_expires_at < ?", now).Delete(&IdempotencyKey{}).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
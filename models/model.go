@@ -2,8 +2,42 @@ package models
 
 import (
 	"fmt"
+
+	"gorm.io/gorm"
 )
 
 func DefaultModel() {
 	fmt.Println("Hello World!")
 }
+
+// whether a record of the model exists with the id, soft deleted records don't count
+func RecordExists(db *gorm.DB, model interface{}, id int) (bool, error) {
+	var count int64
+	if err := db.Model(model).Where("id = ?", id).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// scan the rows of the query one at a time, the result is never held in memory as a whole
+func eachRow[T any](db *gorm.DB, fn func(T) error) error {
+	query := db.Model(new(T))
+
+	rows, err := query.Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row T
+		if err := query.ScanRows(rows, &row); err != nil {
+			return err
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
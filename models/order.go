@@ -1,19 +1,90 @@
 package models
 
 import (
+	"be-dbo-golang/utils/filter"
+	"be-dbo-golang/utils/money"
+	"be-dbo-golang/utils/pagination"
+	"errors"
+	"time"
+
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	OrderStatusPending          = "pending"
+	OrderStatusBackordered      = "backordered"
+	OrderStatusAccepted         = "accepted"
+	OrderStatusRejected         = "rejected"
+	OrderStatusPartiallyShipped = "partially_shipped"
+	OrderStatusShipped          = "shipped"
+	OrderStatusDelivered        = "delivered"
+)
+
+var (
+	ErrOrderNotPending = errors.New("order is no longer pending")
+	ErrOrderRejected   = errors.New("order was rejected by the supplier")
 )
 
+// statuses of orders the supplier still has to ship
+var OrderUnfulfilledStatuses = []string{OrderStatusPending, OrderStatusBackordered, OrderStatusAccepted, OrderStatusPartiallyShipped}
+
 type Order struct {
 	gorm.Model
-	OrderCustomerId  int     `gorm:"size:255;not null" json:"order_customer_id"`
-	OrderSupplierId  int     `gorm:"size:255;not null" json:"order_supplier_id"`
-	OrderProductId   int     `gorm:"size:255;not null" json:"order_product_id"`
-	OrderQty         int     `gorm:"size:255;not null" json:"order_qty"`
-	OrderTotalAmount float64 `gorm:"size:255;not null" json:"order_total_amount"`
-	OrderIsPaid      int8    `gorm:"size:255;not null" json:"order_is_paid"`
+	OrderCustomerId      int         `gorm:"type:bigint unsigned;not null;index" json:"order_customer_id"`
+	OrderSupplierId      int         `gorm:"type:bigint unsigned;not null;index" json:"order_supplier_id"`
+	OrderProductId       int         `gorm:"type:bigint unsigned;not null;index" json:"order_product_id"`
+	OrderQty             int         `gorm:"size:255;not null" json:"order_qty"`
+	OrderSubtotalAmount  money.Money `gorm:"embedded;embeddedPrefix:order_subtotal_amount_" json:"order_subtotal_amount"`
+	OrderDiscountAmount  money.Money `gorm:"embedded;embeddedPrefix:order_discount_amount_" json:"order_discount_amount"`
+	OrderNetAmount       money.Money `gorm:"embedded;embeddedPrefix:order_net_amount_" json:"order_net_amount"`
+	OrderTaxAmount       money.Money `gorm:"embedded;embeddedPrefix:order_tax_amount_" json:"order_tax_amount"`
+	OrderGrossAmount     money.Money `gorm:"embedded;embeddedPrefix:order_gross_amount_" json:"order_gross_amount"`
+	OrderTotalAmount     money.Money `gorm:"embedded;embeddedPrefix:order_total_amount_" json:"order_total_amount"`
+	OrderCouponCode      string      `gorm:"size:64" json:"order_coupon_code"`
+	OrderIsPaid          int8        `gorm:"size:255;not null" json:"order_is_paid"`
+	OrderStatus          string      `gorm:"size:50;not null;default:pending;index" json:"order_status"`
+	OrderAcceptedAt      *time.Time  `json:"order_accepted_at"`
+	OrderRejectedAt      *time.Time  `json:"order_rejected_at"`
+	OrderRejectReason    string      `gorm:"size:255" json:"order_reject_reason"`
+	OrderShippingAddress Address     `gorm:"embedded;embeddedPrefix:order_shipping_" json:"order_shipping_address"`
+	OrderCheckoutId      *int        `gorm:"type:bigint unsigned;index" json:"order_checkout_id"`
+	OrderLines           []OrderLine `gorm:"foreignKey:OrderLineOrderId" json:"order_lines"`
+}
+
+// fields the order list can be filtered on
+var OrderFilters = filter.Spec{
+	Fields: map[string]filter.Field{
+		"id":          {Column: "id", Kind: filter.Int, Ops: filter.Comparable},
+		"customer_id": {Column: "order_customer_id", Kind: filter.Int, Ops: filter.Equality},
+		"supplier_id": {Column: "order_supplier_id", Kind: filter.Int, Ops: filter.Equality},
+		"product_id":  {Column: "order_product_id", Kind: filter.Int, Ops: filter.Equality},
+		"checkout_id": {Column: "order_checkout_id", Kind: filter.Int, Ops: filter.Equality},
+		"status":      {Column: "order_status", Kind: filter.String, Ops: filter.Equality},
+		"qty":         {Column: "order_qty", Kind: filter.Int, Ops: filter.Comparable},
+		"total":       {Column: "order_total_amount_", Kind: filter.Money, Ops: filter.Amount},
+		"is_paid":     {Column: "order_is_paid", Kind: filter.Int, Ops: []string{"eq"}},
+		"coupon_code": {Column: "order_coupon_code", Kind: filter.String, Ops: filter.Text},
+		"country":     {Column: "order_shipping_country", Kind: filter.String, Ops: filter.Equality},
+		"created_at":  {Column: "created_at", Kind: filter.Time, Ops: filter.Range},
+		"accepted_at": {Column: "order_accepted_at", Kind: filter.Time, Ops: filter.Range},
+	},
+	Search: []string{"order_coupon_code", "order_shipping_recipient_name", "order_shipping_city"},
 }
 
+// fields the order list can be sorted by
+var OrderSorts = pagination.Sortable{
+	"id":          "id",
+	"customer_id": "order_customer_id",
+	"supplier_id": "order_supplier_id",
+	"status":      "order_status",
+	"qty":         "order_qty",
+	"total":       "order_total_amount_minor",
+	"created_at":  "created_at",
+	"accepted_at": "order_accepted_at",
+}
+
+// Record order together with its lines
 func CreateOrder(db *gorm.DB, Order *Order) (err error) {
 	err = db.Create(Order).Error
 
@@ -24,7 +95,255 @@ func CreateOrder(db *gorm.DB, Order *Order) (err error) {
 	return nil
 }
 
-func (o *Order) GetOrdersPaginate(db *gorm.DB, page, pageSize int, sortField, sortOrder string) ([]Order, int, error) {
+func isCouponError(err error) bool {
+	return errors.Is(err, ErrCouponNotActive) || errors.Is(err, ErrCouponExhausted) || errors.Is(err, ErrCouponMinSpend) || errors.Is(err, ErrCouponNotApplicable)
+}
+
+// products of the order lines and the suppliers that price them
+func loadOrderProducts(db *gorm.DB, lines []OrderLine) (map[int]Product, map[int]Supplier, error) {
+	products := map[int]Product{}
+	suppliers := map[int]Supplier{}
+	for _, line := range lines {
+		p := Product{}
+		if err := db.Where("id = ?", line.OrderLineProductId).First(&p).Error; err != nil {
+			return nil, nil, err
+		}
+		products[line.OrderLineProductId] = p
+
+		if _, ok := suppliers[p.ProductSupplierId]; !ok {
+			s := Supplier{}
+			if err := db.Where("id = ?", p.ProductSupplierId).First(&s).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, nil, err
+			}
+			suppliers[p.ProductSupplierId] = s
+		}
+	}
+	return products, suppliers, nil
+}
+
+// compute tax of every line and sum the order amounts, all lines must share one currency
+func calculateOrderTotals(db *gorm.DB, order *Order, products map[int]Product, suppliers map[int]Supplier, at time.Time) error {
+	if len(order.OrderLines) == 0 {
+		return nil
+	}
+
+	currency := order.OrderLines[0].OrderLineTotalAmount.Currency
+
+	order.OrderSubtotalAmount = money.Zero(currency)
+	order.OrderDiscountAmount = money.Zero(currency)
+	order.OrderNetAmount = money.Zero(currency)
+	order.OrderTaxAmount = money.Zero(currency)
+	order.OrderGrossAmount = money.Zero(currency)
+	for i := range order.OrderLines {
+		line := &order.OrderLines[i]
+		p := products[line.OrderLineProductId]
+
+		if line.OrderLineTotalAmount.Currency != currency {
+			return money.ErrCurrencyMismatch
+		}
+
+		if line.OrderLineDiscountAmount.Currency == "" {
+			line.OrderLineDiscountAmount = money.Zero(currency)
+		}
+		if line.OrderLineDiscountAmount.Currency != currency {
+			return money.ErrCurrencyMismatch
+		}
+
+		percent, err := GetEffectiveTaxPercent(db, p, at)
+		if err != nil {
+			return err
+		}
+		line.applyTax(percent, suppliers[p.ProductSupplierId].SupplierPricesIncludeTax)
+
+		order.OrderSubtotalAmount = order.OrderSubtotalAmount.Add(line.OrderLineTotalAmount)
+		order.OrderDiscountAmount = order.OrderDiscountAmount.Add(line.OrderLineDiscountAmount)
+		order.OrderNetAmount = order.OrderNetAmount.Add(line.OrderLineNetAmount)
+		order.OrderTaxAmount = order.OrderTaxAmount.Add(line.OrderLineTaxAmount)
+		order.OrderGrossAmount = order.OrderGrossAmount.Add(line.OrderLineGrossAmount)
+	}
+	order.OrderTotalAmount = order.OrderGrossAmount
+	return nil
+}
+
+// Record order with totals computed from its lines, the coupon and the automatic promotions
+// are redeemed in the same transaction so usage caps can't be exceeded. Tax is computed per
+// line on the discounted amount, in the pricing mode of the product supplier
+func PlaceOrder(db *gorm.DB, Order *Order, couponCode string) (err error) {
+	return db.Transaction(func(tx *gorm.DB) error {
+		products, suppliers, err := loadOrderProducts(tx, Order.OrderLines)
+		if err != nil {
+			return err
+		}
+
+		// discounts are added up per line, so they need to start in the order currency
+		for i := range Order.OrderLines {
+			line := &Order.OrderLines[i]
+			if line.OrderLineTotalAmount.Currency != Order.OrderLines[0].OrderLineTotalAmount.Currency {
+				return money.ErrCurrencyMismatch
+			}
+			line.OrderLineDiscountAmount = money.Zero(line.OrderLineTotalAmount.Currency)
+		}
+
+		now := time.Now()
+		var coupons []Coupon
+
+		if couponCode != "" {
+			cp := Coupon{}
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("coupon_code = ?", couponCode).First(&cp).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return ErrCouponNotFound
+				}
+				return err
+			}
+			coupons = append(coupons, cp)
+		}
+
+		var promotions []Coupon
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("coupon_is_automatic = ? AND coupon_is_active = ? AND coupon_code <> ?", true, true, couponCode).Order("id asc").Find(&promotions).Error; err != nil {
+			return err
+		}
+		coupons = append(coupons, promotions...)
+
+		var applied []Coupon
+		var appliedAmounts []money.Money
+
+		for _, cp := range coupons {
+			// a coupon given by the customer has to apply, promotions are skipped when they don't
+			explicit := couponCode != "" && cp.CouponCode == couponCode
+
+			discounts, err := func() (map[int]money.Money, error) {
+				if err := cp.validFor(tx, Order.OrderCustomerId, now); err != nil {
+					return nil, err
+				}
+				return cp.lineDiscounts(Order.OrderLines, products)
+			}()
+			if err != nil {
+				if explicit || !isCouponError(err) {
+					return err
+				}
+				continue
+			}
+
+			amount := money.Zero(Order.OrderLines[0].OrderLineTotalAmount.Currency)
+			for i, discount := range discounts {
+				Order.OrderLines[i].OrderLineDiscountAmount = Order.OrderLines[i].OrderLineDiscountAmount.Add(discount)
+				amount = amount.Add(discount)
+			}
+
+			applied = append(applied, cp)
+			appliedAmounts = append(appliedAmounts, amount)
+		}
+
+		if err := calculateOrderTotals(tx, Order, products, suppliers, now); err != nil {
+			return err
+		}
+		Order.OrderCouponCode = couponCode
+
+		sales := make([][]StockMovement, len(Order.OrderLines))
+		for i := range Order.OrderLines {
+			if sales[i], err = reserveStock(tx, &Order.OrderLines[i], Order.OrderShippingAddress); err != nil {
+				return err
+			}
+		}
+		Order.OrderStatus = backorderStatus(Order.OrderStatus, Order.OrderLines)
+
+		if err := tx.Create(Order).Error; err != nil {
+			return err
+		}
+
+		if err := recordSales(tx, Order.OrderLines, sales); err != nil {
+			return err
+		}
+
+		for i, cp := range applied {
+			if err := tx.Model(&cp).Update("coupon_used_count", gorm.Expr("coupon_used_count + 1")).Error; err != nil {
+				return err
+			}
+
+			redemption := CouponRedemption{
+				CouponRedemptionCouponId:   int(cp.ID),
+				CouponRedemptionCustomerId: Order.OrderCustomerId,
+				CouponRedemptionOrderId:    int(Order.ID),
+				CouponRedemptionAmount:     appliedAmounts[i],
+			}
+			if err := tx.Create(&redemption).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// recompute stock, tax and totals after the lines of the order changed, recorded discounts are kept
+func RecalculateOrder(db *gorm.DB, Order *Order) (err error) {
+	return db.Transaction(func(tx *gorm.DB) error {
+		products, suppliers, err := loadOrderProducts(tx, Order.OrderLines)
+		if err != nil {
+			return err
+		}
+
+		// lines whose product, variant or quantity changed give their stock back and take it again
+		var released []int
+		for i := range Order.OrderLines {
+			line := &Order.OrderLines[i]
+
+			stored := OrderLine{}
+			if err := tx.Where("id = ?", line.ID).First(&stored).Error; err != nil {
+				return err
+			}
+
+			if stored.OrderLineProductId == line.OrderLineProductId && stored.OrderLineVariantId == line.OrderLineVariantId && stored.OrderLineQty == line.OrderLineQty {
+				continue
+			}
+
+			if err := releaseStock(tx, stored); err != nil {
+				return err
+			}
+			released = append(released, stored.OrderLineProductId)
+
+			sales, err := reserveStock(tx, line, Order.OrderShippingAddress)
+			if err != nil {
+				return err
+			}
+			if err := recordSales(tx, []OrderLine{*line}, [][]StockMovement{sales}); err != nil {
+				return err
+			}
+		}
+		Order.OrderStatus = backorderStatus(Order.OrderStatus, Order.OrderLines)
+
+		for i := range Order.OrderLines {
+			line := &Order.OrderLines[i]
+			if line.OrderLineDiscountAmount.SameCurrency(line.OrderLineTotalAmount) && line.OrderLineDiscountAmount.Cmp(line.OrderLineTotalAmount) > 0 {
+				line.OrderLineDiscountAmount = line.OrderLineTotalAmount
+			}
+		}
+
+		if err := calculateOrderTotals(tx, Order, products, suppliers, Order.CreatedAt); err != nil {
+			return err
+		}
+
+		for _, line := range Order.OrderLines {
+			if err := tx.Save(&line).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Omit(clause.Associations).Save(Order).Error; err != nil {
+			return err
+		}
+
+		for _, productId := range released {
+			if err := AllocateBackorders(tx, productId); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (o *Order) GetOrdersPaginate(db *gorm.DB, page, pageSize int, orderBy string) ([]Order, int, error) {
 	var orders []Order
 	var count int64
 
@@ -37,7 +356,61 @@ func (o *Order) GetOrdersPaginate(db *gorm.DB, page, pageSize int, sortField, so
 	totalPages := (int(count) + pageSize - 1) / pageSize
 
 	// Paginate and sort
-	if err := db.Order(sortField + " " + sortOrder).Offset((page - 1) * pageSize).Limit(pageSize).Find(&orders).Error; err != nil {
+	if err := db.Order(orderBy).Offset((page - 1) * pageSize).Limit(pageSize).Find(&orders).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return orders, totalPages, nil
+}
+
+// call fn for every Order in the list order, for exports
+func (o *Order) EachOrder(db *gorm.DB, orderBy string, fn func(Order) error) error {
+	return eachRow(db.Order(orderBy), fn)
+}
+
+// OrderFilter narrows an order listing, zero values don't filter
+type OrderFilter struct {
+	CustomerId  int
+	SupplierId  int
+	Statuses    []string
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+}
+
+func (f OrderFilter) apply(db *gorm.DB) *gorm.DB {
+	if f.CustomerId > 0 {
+		db = db.Where("order_customer_id = ?", f.CustomerId)
+	}
+	if f.SupplierId > 0 {
+		db = db.Where("order_supplier_id = ?", f.SupplierId)
+	}
+	if len(f.Statuses) > 0 {
+		db = db.Where("order_status IN ?", f.Statuses)
+	}
+	if f.CreatedFrom != nil {
+		db = db.Where("created_at >= ?", *f.CreatedFrom)
+	}
+	if f.CreatedTo != nil {
+		db = db.Where("created_at < ?", *f.CreatedTo)
+	}
+	return db
+}
+
+// Get Order list matching the filter, with the order lines
+func (o *Order) GetOrdersFilteredPaginate(db *gorm.DB, filter OrderFilter, page, pageSize int, orderBy string) ([]Order, int, error) {
+	var orders []Order
+	var count int64
+
+	// Count total records
+	if err := filter.apply(db.Model(&Order{})).Count(&count).Error; err != nil {
+		return nil, 0, err
+	}
+
+	// Calculate total pages
+	totalPages := (int(count) + pageSize - 1) / pageSize
+
+	// Paginate and sort
+	if err := filter.apply(db).Preload("OrderLines").Order(orderBy).Offset((page - 1) * pageSize).Limit(pageSize).Find(&orders).Error; err != nil {
 		return nil, 0, err
 	}
 
@@ -46,24 +419,135 @@ func (o *Order) GetOrdersPaginate(db *gorm.DB, page, pageSize int, sortField, so
 
 // get Order by id
 func GetOrderById(db *gorm.DB, Order *Order, id int) (err error) {
-	err = db.Where("id = ?", id).First(Order).Error
+	err = db.Preload("OrderLines").Where("id = ?", id).First(Order).Error
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// supplier accepts a pending Order
+func AcceptOrder(db *gorm.DB, Order *Order, acceptedAt time.Time) (err error) {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", Order.ID).First(Order).Error; err != nil {
+			return err
+		}
+
+		if Order.OrderStatus != OrderStatusPending {
+			return ErrOrderNotPending
+		}
+
+		Order.OrderStatus = OrderStatusAccepted
+		Order.OrderAcceptedAt = &acceptedAt
+
+		return tx.Model(Order).Updates(map[string]interface{}{"order_status": Order.OrderStatus, "order_accepted_at": acceptedAt}).Error
+	})
+}
+
+// give back the stock held by the lines of the order, drop their backorders and return the coupons it redeemed
+func releaseOrder(tx *gorm.DB, orderId int) ([]OrderLine, error) {
+	var lines []OrderLine
+	if err := tx.Where("order_line_order_id = ?", orderId).Find(&lines).Error; err != nil {
+		return nil, err
+	}
+
+	for _, line := range lines {
+		if err := releaseStock(tx, line); err != nil {
+			return nil, err
+		}
+		if err := tx.Model(&line).Update("order_line_backordered_qty", 0).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	var redemptions []CouponRedemption
+	if err := tx.Where("coupon_redemption_order_id = ?", orderId).Find(&redemptions).Error; err != nil {
+		return nil, err
+	}
+
+	for _, redemption := range redemptions {
+		if err := tx.Model(&Coupon{}).Where("id = ? AND coupon_used_count > 0", redemption.CouponRedemptionCouponId).Update("coupon_used_count", gorm.Expr("coupon_used_count - 1")).Error; err != nil {
+			return nil, err
+		}
+		if err := tx.Delete(&redemption).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	return lines, nil
+}
+
+// supplier rejects a pending or backordered Order, the stock and coupons it used are given back
+func RejectOrder(db *gorm.DB, Order *Order, reason string, rejectedAt time.Time) (err error) {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", Order.ID).First(Order).Error; err != nil {
+			return err
+		}
+
+		if Order.OrderStatus != OrderStatusPending && Order.OrderStatus != OrderStatusBackordered {
+			return ErrOrderNotPending
+		}
+
+		lines, err := releaseOrder(tx, int(Order.ID))
+		if err != nil {
+			return err
+		}
+
+		Order.OrderStatus = OrderStatusRejected
+		Order.OrderRejectedAt = &rejectedAt
+		Order.OrderRejectReason = reason
+
+		if err := tx.Model(Order).Updates(map[string]interface{}{"order_status": Order.OrderStatus, "order_rejected_at": rejectedAt, "order_reject_reason": reason}).Error; err != nil {
+			return err
+		}
+
+		// the stock given back goes to backorders waiting for it
+		for _, line := range lines {
+			if err := AllocateBackorders(tx, line.OrderLineProductId); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
 // update Supplier
 func UpdateOrder(db *gorm.DB, Order *Order, id int) (err error) {
-	err = db.Where("id = ?", id).Updates(Order).Error
+	err = db.Omit(clause.Associations).Where("id = ?", id).Updates(Order).Error
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-// delete Supplier
+// delete Order, the stock and coupons it held are given back
 func DeleteOrder(db *gorm.DB, Order *Order, id int) (err error) {
-	db.Where("id = ?", id).Delete(Order)
-	return nil
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(Order).Error; err != nil {
+			return err
+		}
+
+		// a rejected order already gave everything back
+		var lines []OrderLine
+		if Order.OrderStatus != OrderStatusRejected {
+			released, err := releaseOrder(tx, id)
+			if err != nil {
+				return err
+			}
+			lines = released
+		}
+
+		if err := tx.Delete(Order).Error; err != nil {
+			return err
+		}
+
+		// the stock given back goes to backorders waiting for it
+		for _, line := range lines {
+			if err := AllocateBackorders(tx, line.OrderLineProductId); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
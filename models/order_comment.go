@@ -0,0 +1,96 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	OrderCommentInternal = "internal"
+	OrderCommentShared   = "shared"
+)
+
+// OrderComment is a note in the thread of an order, internal ones are only for admins
+type OrderComment struct {
+	gorm.Model
+	OrderCommentOrderId    int                    `gorm:"type:bigint unsigned;not null;index" json:"order_comment_order_id"`
+	OrderCommentAuthorId   int                    `gorm:"not null" json:"order_comment_author_id"`
+	OrderCommentAuthorRole string                 `gorm:"size:20;not null" json:"order_comment_author_role"`
+	OrderCommentVisibility string                 `gorm:"size:20;not null;default:shared;index" json:"order_comment_visibility"`
+	OrderCommentBody       string                 `gorm:"type:text;not null" json:"order_comment_body"`
+	OrderCommentEditedAt   *time.Time             `json:"order_comment_edited_at"`
+	OrderCommentRevisions  []OrderCommentRevision `gorm:"foreignKey:OrderCommentRevisionCommentId" json:"order_comment_revisions,omitempty"`
+}
+
+// OrderCommentRevision keeps the body a comment had before an edit
+type OrderCommentRevision struct {
+	gorm.Model
+	OrderCommentRevisionCommentId int    `gorm:"type:bigint unsigned;not null;index" json:"order_comment_revision_comment_id"`
+	OrderCommentRevisionEditorId  int    `gorm:"not null" json:"order_comment_revision_editor_id"`
+	OrderCommentRevisionBody      string `gorm:"type:text;not null" json:"order_comment_revision_body"`
+}
+
+func CreateOrderComment(db *gorm.DB, OrderComment *OrderComment) (err error) {
+	err = db.Create(OrderComment).Error
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// get comments of an order oldest first, internal ones only when asked for
+func GetOrderComments(db *gorm.DB, OrderComments *[]OrderComment, orderId int, internal bool) (err error) {
+	query := db.Where("order_comment_order_id = ?", orderId)
+	if !internal {
+		query = query.Where("order_comment_visibility = ?", OrderCommentShared)
+	}
+
+	err = query.Order("id asc").Find(OrderComments).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// get OrderComment by id with its earlier revisions
+func GetOrderCommentById(db *gorm.DB, OrderComment *OrderComment, id int) (err error) {
+	err = db.Preload("OrderCommentRevisions", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id asc")
+	}).Where("id = ?", id).First(OrderComment).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// change the body of the comment, the previous body is kept as a revision
+func EditOrderComment(db *gorm.DB, comment *OrderComment, body string, editorId int, at time.Time) (err error) {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", comment.ID).First(comment).Error; err != nil {
+			return err
+		}
+
+		if comment.OrderCommentBody == body {
+			return nil
+		}
+
+		revision := OrderCommentRevision{
+			OrderCommentRevisionCommentId: int(comment.ID),
+			OrderCommentRevisionEditorId:  editorId,
+			OrderCommentRevisionBody:      comment.OrderCommentBody,
+		}
+		if err := tx.Create(&revision).Error; err != nil {
+			return err
+		}
+
+		comment.OrderCommentBody = body
+		comment.OrderCommentEditedAt = &at
+		comment.OrderCommentRevisions = append(comment.OrderCommentRevisions, revision)
+
+		return tx.Model(comment).Updates(map[string]interface{}{"order_comment_body": body, "order_comment_edited_at": at}).Error
+	})
+}
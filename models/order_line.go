@@ -0,0 +1,75 @@
+package models
+
+import (
+	"be-dbo-golang/utils/money"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type OrderLine struct {
+	gorm.Model
+	OrderLineOrderId        int         `gorm:"type:bigint unsigned;not null;index" json:"order_line_order_id"`
+	OrderLineProductId      int         `gorm:"type:bigint unsigned;not null;index" json:"order_line_product_id"`
+	OrderLineProductName    string      `gorm:"size:255;not null;default:''" json:"order_line_product_name"`
+	OrderLineVariantId      int         `gorm:"not null;default:0;index" json:"order_line_variant_id"`
+	OrderLineSku            string      `gorm:"size:100;not null;default:''" json:"order_line_sku"`
+	OrderLineQty            int         `gorm:"not null" json:"order_line_qty"`
+	OrderLineUnitPrice      money.Money `gorm:"embedded;embeddedPrefix:order_line_unit_price_" json:"order_line_unit_price"`
+	OrderLineTotalAmount    money.Money `gorm:"embedded;embeddedPrefix:order_line_total_amount_" json:"order_line_total_amount"`
+	OrderLineDiscountAmount money.Money `gorm:"embedded;embeddedPrefix:order_line_discount_amount_" json:"order_line_discount_amount"`
+	OrderLineTaxPercent     float64     `gorm:"not null;default:0" json:"order_line_tax_percent"`
+	OrderLineNetAmount      money.Money `gorm:"embedded;embeddedPrefix:order_line_net_amount_" json:"order_line_net_amount"`
+	OrderLineTaxAmount      money.Money `gorm:"embedded;embeddedPrefix:order_line_tax_amount_" json:"order_line_tax_amount"`
+	OrderLineGrossAmount    money.Money `gorm:"embedded;embeddedPrefix:order_line_gross_amount_" json:"order_line_gross_amount"`
+	OrderLineShippedQty     int         `gorm:"not null;default:0" json:"order_line_shipped_qty"`
+	OrderLineBackorderedQty int         `gorm:"not null;default:0;index" json:"order_line_backordered_qty"`
+	OrderLineAvailableAt    *time.Time  `json:"order_line_available_at"`
+}
+
+// line for a quantity of the product at its current price
+func NewOrderLine(p Product, qty int) OrderLine {
+	return OrderLine{
+		OrderLineProductId:   int(p.ID),
+		OrderLineProductName: p.ProductName,
+		OrderLineQty:         qty,
+		OrderLineUnitPrice:   p.ProductPrice,
+		OrderLineTotalAmount: p.ProductPrice.Mul(int64(qty)),
+	}
+}
+
+// line for a quantity of the variant at its current price, the variant is used when one is given
+func NewVariantOrderLine(p Product, variant *ProductVariant, qty int) OrderLine {
+	line := NewOrderLine(p, qty)
+	if variant == nil {
+		return line
+	}
+
+	line.OrderLineVariantId = int(variant.ID)
+	line.OrderLineSku = variant.ProductVariantSku
+	if label := variant.Label(); label != "" {
+		line.OrderLineProductName = p.ProductName + " (" + label + ")"
+	}
+	line.OrderLineUnitPrice = variant.UnitPrice(p)
+	line.OrderLineTotalAmount = line.OrderLineUnitPrice.Mul(int64(qty))
+	return line
+}
+
+// quantity of the line that still has to be shipped
+func (l *OrderLine) RemainingQty() int {
+	return l.OrderLineQty - l.OrderLineShippedQty
+}
+
+// quantity of the line taken from stock and not shipped yet, backordered items wait for stock
+func (l *OrderLine) AllocatedQty() int {
+	return l.OrderLineQty - l.OrderLineShippedQty - l.OrderLineBackorderedQty
+}
+
+// get order lines of an order
+func GetOrderLinesByOrder(db *gorm.DB, OrderLines *[]OrderLine, orderId int) (err error) {
+	err = db.Where("order_line_order_id = ?", orderId).Order("id asc").Find(OrderLines).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
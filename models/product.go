@@ -1,29 +1,78 @@
 package models
 
 import (
+	"be-dbo-golang/utils/filter"
+	"be-dbo-golang/utils/money"
+	"be-dbo-golang/utils/pagination"
+	"time"
+
 	"gorm.io/gorm"
 )
 
 type Product struct {
 	gorm.Model
-	ProductSupplierId int     `gorm:"size:255;not null" json:"product_supplier_id"`
-	ProductName       string  `gorm:"size:255;not null" json:"product_name"`
-	ProductBrandId    int     `gorm:"size:255;not null" json:"product_brand_id"`
-	ProductStock      int     `gorm:"size:255;not null" json:"product_stock"`
-	ProductPrice      float64 `gorm:"size:255;not null" json:"product_price"`
+	ProductSupplierId  int         `gorm:"type:bigint unsigned;not null;index" json:"product_supplier_id"`
+	ProductName        string      `gorm:"size:255;not null" json:"product_name"`
+	ProductDescription string      `gorm:"type:text" json:"product_description"`
+	ProductBrandId     int         `gorm:"type:bigint unsigned;not null;index" json:"product_brand_id"`
+	ProductStock       int         `gorm:"size:255;not null" json:"product_stock"`
+	ProductPrice       money.Money `gorm:"embedded;embeddedPrefix:product_price_" json:"product_price"`
+	ProductTaxCategory string      `gorm:"size:100;not null;default:standard" json:"product_tax_category"`
+	// orders beyond the stock are taken as backorders, up to the limit when it is set
+	ProductBackorderable  bool       `gorm:"not null;default:false" json:"product_backorderable"`
+	ProductPreorderable   bool       `gorm:"not null;default:false" json:"product_preorderable"`
+	ProductBackorderLimit int        `gorm:"not null;default:0" json:"product_backorder_limit"`
+	ProductAvailableAt    *time.Time `json:"product_available_at"`
+	// a stock alert is raised when the stock falls to the reorder point, 0 turns alerts off
+	ProductReorderPoint    int              `gorm:"not null;default:0" json:"product_reorder_point"`
+	ProductReorderQty      int              `gorm:"not null;default:0" json:"product_reorder_qty"`
+	ProductCategories      []Category       `gorm:"many2many:product_categories" json:"product_categories,omitempty"`
+	ProductVariants        []ProductVariant `gorm:"foreignKey:ProductVariantProductId" json:"product_variants,omitempty"`
+	ProductImages          []ProductImage   `gorm:"foreignKey:ProductImageProductId" json:"product_images,omitempty"`
+	ProductWarehouseStocks []WarehouseStock `gorm:"foreignKey:WarehouseStockProductId" json:"product_warehouse_stocks,omitempty"`
 }
 
-func CreateProduct(db *gorm.DB, Product *Product) (err error) {
-	err = db.Create(Product).Error
+// fields the product list can be filtered on
+var ProductFilters = filter.Spec{
+	Fields: map[string]filter.Field{
+		"id":            {Column: "id", Kind: filter.Int, Ops: filter.Comparable},
+		"name":          {Column: "product_name", Kind: filter.String, Ops: filter.Text},
+		"brand_id":      {Column: "product_brand_id", Kind: filter.Int, Ops: filter.Equality},
+		"supplier_id":   {Column: "product_supplier_id", Kind: filter.Int, Ops: filter.Equality},
+		"price":         {Column: "product_price_", Kind: filter.Money, Ops: filter.Amount},
+		"stock":         {Column: "product_stock", Kind: filter.Int, Ops: filter.Comparable},
+		"tax_category":  {Column: "product_tax_category", Kind: filter.String, Ops: filter.Equality},
+		"backorderable": {Column: "product_backorderable", Kind: filter.Bool, Ops: []string{"eq"}},
+		"preorderable":  {Column: "product_preorderable", Kind: filter.Bool, Ops: []string{"eq"}},
+		"created_at":    {Column: "created_at", Kind: filter.Time, Ops: filter.Range},
+		"updated_at":    {Column: "updated_at", Kind: filter.Time, Ops: filter.Range},
+	},
+	Search: []string{"product_name", "product_description"},
+}
 
-	if err != nil {
-		return err
-	}
+// fields the product list can be sorted by
+var ProductSorts = pagination.Sortable{
+	"id":         "id",
+	"name":       "product_name",
+	"brand_id":   "product_brand_id",
+	"price":      "product_price_minor",
+	"stock":      "product_stock",
+	"created_at": "created_at",
+	"updated_at": "updated_at",
+}
 
-	return nil
+// record Product, its stock opens the stock ledger
+func CreateProduct(db *gorm.DB, Product *Product) (err error) {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(Product).Error; err != nil {
+			return err
+		}
+
+		return openStock(tx, int(Product.ID), 0, Product.ProductStock)
+	})
 }
 
-func (p *Product) GetProductsPaginate(db *gorm.DB, page, pageSize int, sortField, sortOrder string) ([]Product, int, error) {
+func (p *Product) GetProductsPaginate(db *gorm.DB, page, pageSize int, orderBy string) ([]Product, int, error) {
 	var products []Product
 	var count int64
 
@@ -36,13 +85,29 @@ func (p *Product) GetProductsPaginate(db *gorm.DB, page, pageSize int, sortField
 	totalPages := (int(count) + pageSize - 1) / pageSize
 
 	// Paginate and sort
-	if err := db.Order(sortField + " " + sortOrder).Offset((page - 1) * pageSize).Limit(pageSize).Find(&products).Error; err != nil {
+	if err := db.Order(orderBy).Offset((page - 1) * pageSize).Limit(pageSize).Find(&products).Error; err != nil {
 		return nil, 0, err
 	}
 
 	return products, totalPages, nil
 }
 
+// load the categories, variants and images with the products
+func PreloadProductDetails(db *gorm.DB) *gorm.DB {
+	return db.Preload("ProductCategories").Preload("ProductVariants", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id asc")
+	}).Preload("ProductVariants.ProductVariantOptions").Preload("ProductImages", func(db *gorm.DB) *gorm.DB {
+		return db.Order("product_image_sort_order asc, id asc")
+	}).Preload("ProductImages.ProductImageThumbnails").Preload("ProductWarehouseStocks", func(db *gorm.DB) *gorm.DB {
+		return db.Order("warehouse_stock_warehouse_id asc")
+	}).Preload("ProductWarehouseStocks.WarehouseStockWarehouse")
+}
+
+// call fn for every Product in the list order, for exports
+func (p *Product) EachProduct(db *gorm.DB, orderBy string, fn func(Product) error) error {
+	return eachRow(db.Order(orderBy), fn)
+}
+
 // get Product by id
 func GetProductById(db *gorm.DB, Product *Product, id int) (err error) {
 	err = db.Where("id = ?", id).First(Product).Error
@@ -52,9 +117,23 @@ func GetProductById(db *gorm.DB, Product *Product, id int) (err error) {
 	return nil
 }
 
-// update Supplier
+// update Product, the stock only changes through the stock ledger and the price through ChangeProductPrice
 func UpdateProduct(db *gorm.DB, Product *Product, id int) (err error) {
-	err = db.Where("id = ?", id).Updates(Product).Error
+	err = db.Where("id = ?", id).Omit("product_stock", "product_price_minor", "product_price_currency").Updates(Product).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// write the backorder settings, kept apart because Updates skips false and zero
+func UpdateProductBackorder(db *gorm.DB, Product *Product, id int) (err error) {
+	err = db.Model(Product).Where("id = ?", id).Updates(map[string]interface{}{
+		"product_backorderable":   Product.ProductBackorderable,
+		"product_preorderable":    Product.ProductPreorderable,
+		"product_backorder_limit": Product.ProductBackorderLimit,
+		"product_available_at":    Product.ProductAvailableAt,
+	}).Error
 	if err != nil {
 		return err
 	}
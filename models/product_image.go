@@ -0,0 +1,168 @@
+package models
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrProductImageNotFound = errors.New("image not found for the product")
+
+// ProductImage is an uploaded picture of a product, the file itself is kept in the storage under the key
+type ProductImage struct {
+	gorm.Model
+	ProductImageProductId   int                     `gorm:"type:bigint unsigned;not null;index" json:"product_image_product_id"`
+	ProductImageKey         string                  `gorm:"size:255;not null" json:"product_image_key"`
+	ProductImageContentType string                  `gorm:"size:50;not null" json:"product_image_content_type"`
+	ProductImageSize        int64                   `gorm:"not null" json:"product_image_size"`
+	ProductImageWidth       int                     `gorm:"not null" json:"product_image_width"`
+	ProductImageHeight      int                     `gorm:"not null" json:"product_image_height"`
+	ProductImageSortOrder   int                     `gorm:"not null;default:0" json:"product_image_sort_order"`
+	ProductImageIsPrimary   bool                    `gorm:"not null;default:false" json:"product_image_is_primary"`
+	ProductImageThumbnails  []ProductImageThumbnail `gorm:"foreignKey:ProductImageThumbnailImageId" json:"product_image_thumbnails"`
+}
+
+type ProductImageThumbnail struct {
+	gorm.Model
+	ProductImageThumbnailImageId int    `gorm:"type:bigint unsigned;not null;index" json:"product_image_thumbnail_image_id"`
+	ProductImageThumbnailSize    int    `gorm:"not null" json:"product_image_thumbnail_size"`
+	ProductImageThumbnailKey     string `gorm:"size:255;not null" json:"product_image_thumbnail_key"`
+	ProductImageThumbnailWidth   int    `gorm:"not null" json:"product_image_thumbnail_width"`
+	ProductImageThumbnailHeight  int    `gorm:"not null" json:"product_image_thumbnail_height"`
+}
+
+// storage keys of the image and its thumbnails
+func (i *ProductImage) Keys() []string {
+	keys := []string{i.ProductImageKey}
+	for _, thumbnail := range i.ProductImageThumbnails {
+		keys = append(keys, thumbnail.ProductImageThumbnailKey)
+	}
+	return keys
+}
+
+// the other images of the product stop being primary
+func unsetPrimaryImage(tx *gorm.DB, productId int, imageId uint) error {
+	return tx.Model(&ProductImage{}).Where("product_image_product_id = ? AND id <> ?", productId, imageId).Update("product_image_is_primary", false).Error
+}
+
+// record an image, the first image of a product is its primary one and new images go last
+func CreateProductImage(db *gorm.DB, image *ProductImage) (err error) {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", image.ProductImageProductId).First(&Product{}).Error; err != nil {
+			return err
+		}
+
+		var images []ProductImage
+		if err := tx.Where("product_image_product_id = ?", image.ProductImageProductId).Find(&images).Error; err != nil {
+			return err
+		}
+
+		if len(images) == 0 {
+			image.ProductImageIsPrimary = true
+		}
+		for _, other := range images {
+			if other.ProductImageSortOrder >= image.ProductImageSortOrder {
+				image.ProductImageSortOrder = other.ProductImageSortOrder + 1
+			}
+		}
+
+		if err := tx.Create(image).Error; err != nil {
+			return err
+		}
+
+		if image.ProductImageIsPrimary {
+			return unsetPrimaryImage(tx, image.ProductImageProductId, image.ID)
+		}
+		return nil
+	})
+}
+
+// get ProductImage by id with its thumbnails
+func GetProductImageById(db *gorm.DB, ProductImage *ProductImage, id int) (err error) {
+	err = db.Preload("ProductImageThumbnails").Where("id = ?", id).First(ProductImage).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// update ProductImage sort order and primary flag
+func UpdateProductImage(db *gorm.DB, image *ProductImage) (err error) {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", image.ProductImageProductId).First(&Product{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(image).Updates(map[string]interface{}{"product_image_sort_order": image.ProductImageSortOrder, "product_image_is_primary": image.ProductImageIsPrimary}).Error; err != nil {
+			return err
+		}
+
+		if image.ProductImageIsPrimary {
+			return unsetPrimaryImage(tx, image.ProductImageProductId, image.ID)
+		}
+		return nil
+	})
+}
+
+// order the images of the product as the ids are given
+func ReorderProductImages(db *gorm.DB, productId int, imageIds []int) (err error) {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", productId).First(&Product{}).Error; err != nil {
+			return err
+		}
+
+		var ids []int
+		if err := tx.Model(&ProductImage{}).Where("product_image_product_id = ?", productId).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+
+		own := map[int]bool{}
+		for _, id := range ids {
+			own[id] = true
+		}
+
+		for position, imageId := range imageIds {
+			if !own[imageId] {
+				return ErrProductImageNotFound
+			}
+
+			if err := tx.Model(&ProductImage{}).Where("id = ?", imageId).Update("product_image_sort_order", position).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// delete ProductImage and its thumbnails, the next image becomes primary when it was
+func DeleteProductImage(db *gorm.DB, image *ProductImage) (err error) {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", image.ProductImageProductId).First(&Product{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Unscoped().Where("product_image_thumbnail_image_id = ?", image.ID).Delete(&ProductImageThumbnail{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Unscoped().Delete(image).Error; err != nil {
+			return err
+		}
+
+		if !image.ProductImageIsPrimary {
+			return nil
+		}
+
+		next := ProductImage{}
+		err := tx.Where("product_image_product_id = ?", image.ProductImageProductId).Order("product_image_sort_order asc, id asc").First(&next).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(&next).Update("product_image_is_primary", true).Error
+	})
+}
@@ -0,0 +1,154 @@
+package models
+
+import (
+	"be-dbo-golang/utils/money"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	PriceChangeStatusScheduled = "scheduled"
+	PriceChangeStatusApplied   = "applied"
+	PriceChangeStatusCancelled = "cancelled"
+)
+
+var (
+	ErrPriceChangeNotScheduled = errors.New("price change is not scheduled")
+	ErrNoPriceAt               = errors.New("product had no price at that time")
+)
+
+// ProductPriceChange is a price of the product over a period. An applied change is effective until
+// the next one is applied, a scheduled change is applied by the scheduler once it is due.
+type ProductPriceChange struct {
+	gorm.Model
+	ProductPriceChangeProductId     int         `gorm:"type:bigint unsigned;not null;index:idx_price_change_product_from" json:"product_price_change_product_id"`
+	ProductPriceChangePrice         money.Money `gorm:"embedded;embeddedPrefix:product_price_change_price_" json:"product_price_change_price"`
+	ProductPriceChangeStatus        string      `gorm:"size:20;not null;index" json:"product_price_change_status"`
+	ProductPriceChangeScheduledAt   *time.Time  `json:"product_price_change_scheduled_at"`
+	ProductPriceChangeEffectiveFrom *time.Time  `gorm:"index:idx_price_change_product_from" json:"product_price_change_effective_from"`
+	ProductPriceChangeEffectiveTo   *time.Time  `json:"product_price_change_effective_to"`
+	ProductPriceChangeActorId       int         `gorm:"not null;default:0" json:"product_price_change_actor_id"`
+	ProductPriceChangeActorRole     string      `gorm:"size:20" json:"product_price_change_actor_role"`
+	ProductPriceChangeReason        string      `gorm:"size:255" json:"product_price_change_reason"`
+}
+
+// record the price of products that have no history yet, effective since they were created
+func BackfillPriceHistory(db *gorm.DB) error {
+	return db.Exec(`INSERT INTO product_price_changes (created_at, updated_at, product_price_change_product_id, product_price_change_price_minor, product_price_change_price_currency, product_price_change_status, product_price_change_effective_from, product_price_change_reason)
+		SELECT NOW(), NOW(), p.id, p.product_price_minor, p.product_price_currency, ?, p.created_at, ?
+		FROM products p
+		WHERE p.deleted_at IS NULL AND NOT EXISTS (SELECT 1 FROM product_price_changes c WHERE c.product_price_change_product_id = p.id AND c.product_price_change_status = ?)`,
+		PriceChangeStatusApplied, "initial price", PriceChangeStatusApplied).Error
+}
+
+// make the change the current price of the product from the time on, the previous price ends then
+func applyPriceChange(tx *gorm.DB, change *ProductPriceChange, at time.Time) error {
+	if err := tx.Model(&ProductPriceChange{}).
+		Where("product_price_change_product_id = ? AND product_price_change_status = ? AND product_price_change_effective_to IS NULL AND id <> ?", change.ProductPriceChangeProductId, PriceChangeStatusApplied, change.ID).
+		Update("product_price_change_effective_to", at).Error; err != nil {
+		return err
+	}
+
+	change.ProductPriceChangeStatus = PriceChangeStatusApplied
+	change.ProductPriceChangeEffectiveFrom = &at
+	if err := tx.Save(change).Error; err != nil {
+		return err
+	}
+
+	return tx.Model(&Product{}).Where("id = ?", change.ProductPriceChangeProductId).
+		Updates(map[string]interface{}{"product_price_minor": change.ProductPriceChangePrice.Minor, "product_price_currency": change.ProductPriceChangePrice.Currency}).Error
+}
+
+// set the product price now and record the change
+func ChangeProductPrice(db *gorm.DB, change *ProductPriceChange, at time.Time) (err error) {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", change.ProductPriceChangeProductId).First(&Product{}).Error; err != nil {
+			return err
+		}
+
+		return applyPriceChange(tx, change, at)
+	})
+}
+
+// plan a price for the product, it is applied once the scheduled time has come
+func ScheduleProductPrice(db *gorm.DB, change *ProductPriceChange) (err error) {
+	if err := db.Where("id = ?", change.ProductPriceChangeProductId).First(&Product{}).Error; err != nil {
+		return err
+	}
+
+	change.ProductPriceChangeStatus = PriceChangeStatusScheduled
+	return db.Create(change).Error
+}
+
+// cancel a price change that hasn't been applied yet
+func CancelProductPriceChange(db *gorm.DB, change *ProductPriceChange, id int) (err error) {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(change).Error; err != nil {
+			return err
+		}
+
+		if change.ProductPriceChangeStatus != PriceChangeStatusScheduled {
+			return ErrPriceChangeNotScheduled
+		}
+
+		change.ProductPriceChangeStatus = PriceChangeStatusCancelled
+		return tx.Model(change).Update("product_price_change_status", change.ProductPriceChangeStatus).Error
+	})
+}
+
+// price changes of the product, the latest first
+func GetProductPriceChanges(db *gorm.DB, changes *[]ProductPriceChange, productId int) (err error) {
+	return db.Where("product_price_change_product_id = ?", productId).
+		Order("COALESCE(product_price_change_effective_from, product_price_change_scheduled_at) desc, id desc").Find(changes).Error
+}
+
+// the applied price of the product at the time
+func GetProductPriceAt(db *gorm.DB, change *ProductPriceChange, productId int, at time.Time) (err error) {
+	err = db.Where("product_price_change_product_id = ? AND product_price_change_status = ? AND product_price_change_effective_from <= ? AND (product_price_change_effective_to IS NULL OR product_price_change_effective_to > ?)", productId, PriceChangeStatusApplied, at, at).
+		Order("product_price_change_effective_from desc, id desc").First(change).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNoPriceAt
+	}
+	return err
+}
+
+// apply the scheduled price changes that are due, in the order they were scheduled for
+func ApplyDuePriceChanges(db *gorm.DB, now time.Time) (err error) {
+	var ids []int
+	if err := db.Model(&ProductPriceChange{}).Where("product_price_change_status = ? AND product_price_change_scheduled_at <= ?", PriceChangeStatusScheduled, now).
+		Order("product_price_change_scheduled_at asc, id asc").Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			change := ProductPriceChange{}
+			// another instance may have applied or a user cancelled it meanwhile
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).Where("id = ? AND product_price_change_status = ?", id, PriceChangeStatusScheduled).First(&change).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return nil
+				}
+				return err
+			}
+
+			p := Product{}
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", change.ProductPriceChangeProductId).First(&p).Error; err != nil {
+				// the product is gone, the change can't apply anymore
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return tx.Model(&change).Update("product_price_change_status", PriceChangeStatusCancelled).Error
+				}
+				return err
+			}
+
+			return applyPriceChange(tx, &change, now)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
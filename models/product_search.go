@@ -0,0 +1,73 @@
+package models
+
+import (
+	"be-dbo-golang/utils/search"
+
+	"gorm.io/gorm"
+)
+
+// relevance of a match in each searched field
+var ProductSearchWeights = map[string]float64{
+	"name":        3,
+	"brand":       2,
+	"description": 1,
+}
+
+// searchable text of the product
+func ProductSearchDocument(db *gorm.DB, p Product) (search.Document, error) {
+	brand := Brand{}
+	if err := db.Where("id = ?", p.ProductBrandId).Limit(1).Find(&brand).Error; err != nil {
+		return search.Document{}, err
+	}
+
+	return productDocument(p, brand.BrandName), nil
+}
+
+func productDocument(p Product, brandName string) search.Document {
+	return search.Document{
+		ID: int(p.ID),
+		Fields: map[string]string{
+			"name":        p.ProductName,
+			"brand":       brandName,
+			"description": p.ProductDescription,
+		},
+	}
+}
+
+// add every product to the index
+func IndexProducts(db *gorm.DB, index search.Index) error {
+	var brands []Brand
+	if err := db.Find(&brands).Error; err != nil {
+		return err
+	}
+
+	brandNames := map[int]string{}
+	for _, brand := range brands {
+		brandNames[int(brand.ID)] = brand.BrandName
+	}
+
+	return eachRow(db, func(p Product) error {
+		return index.Upsert(productDocument(p, brandNames[p.ProductBrandId]))
+	})
+}
+
+// add the products of the brand to the index again, after the brand was renamed or deleted
+func IndexBrandProducts(db *gorm.DB, index search.Index, brandId int) error {
+	brand := Brand{}
+	if err := db.Where("id = ?", brandId).Limit(1).Find(&brand).Error; err != nil {
+		return err
+	}
+
+	return eachRow(db.Where("product_brand_id = ?", brandId), func(p Product) error {
+		return index.Upsert(productDocument(p, brand.BrandName))
+	})
+}
+
+// products with the ids, in no particular order
+func GetProductsByIds(db *gorm.DB, ids []int) ([]Product, error) {
+	var products []Product
+	if err := db.Where("id IN ?", ids).Find(&products).Error; err != nil {
+		return nil, err
+	}
+	return products, nil
+}
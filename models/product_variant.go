@@ -0,0 +1,181 @@
+package models
+
+import (
+	"be-dbo-golang/utils/money"
+	"errors"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrVariantRequired     = errors.New("product has variants, a variant_id is required")
+	ErrVariantNotFound     = errors.New("variant not found for the product")
+	ErrVariantOptionsTaken = errors.New("another variant of the product has the same option values")
+	ErrVariantSkuTaken     = errors.New("sku is already used")
+)
+
+// ProductVariant is a version of the product for a combination of option values, e.g. size M and color red.
+// A variant without a price of its own is sold at the product price.
+type ProductVariant struct {
+	gorm.Model
+	ProductVariantProductId int                    `gorm:"type:bigint unsigned;not null;index" json:"product_variant_product_id"`
+	ProductVariantSku       string                 `gorm:"size:100;not null;uniqueIndex" json:"product_variant_sku"`
+	ProductVariantPrice     money.Money            `gorm:"embedded;embeddedPrefix:product_variant_price_" json:"product_variant_price"`
+	ProductVariantStock     int                    `gorm:"not null;default:0" json:"product_variant_stock"`
+	ProductVariantOptions   []ProductVariantOption `gorm:"foreignKey:ProductVariantOptionVariantId" json:"product_variant_options"`
+}
+
+type ProductVariantOption struct {
+	gorm.Model
+	ProductVariantOptionVariantId int    `gorm:"type:bigint unsigned;not null;index" json:"product_variant_option_variant_id"`
+	ProductVariantOptionName      string `gorm:"size:100;not null" json:"product_variant_option_name"`
+	ProductVariantOptionValue     string `gorm:"size:100;not null" json:"product_variant_option_value"`
+}
+
+// whether the variant overrides the product price
+func (v *ProductVariant) HasPrice() bool {
+	return v.ProductVariantPrice.Currency != ""
+}
+
+// price the variant is sold at
+func (v *ProductVariant) UnitPrice(p Product) money.Money {
+	if v.HasPrice() {
+		return v.ProductVariantPrice
+	}
+	return p.ProductPrice
+}
+
+// option values joined for display, e.g. "M / Red"
+func (v *ProductVariant) Label() string {
+	values := []string{}
+	for _, option := range v.ProductVariantOptions {
+		values = append(values, option.ProductVariantOptionValue)
+	}
+	return strings.Join(values, " / ")
+}
+
+// option values in a comparable form, the same whatever the order they were given in
+func (v *ProductVariant) optionKey() string {
+	pairs := []string{}
+	for _, option := range v.ProductVariantOptions {
+		pairs = append(pairs, strings.ToLower(option.ProductVariantOptionName)+"="+strings.ToLower(option.ProductVariantOptionValue))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ";")
+}
+
+// check the sku is free and no other variant of the product has the same option values
+func checkVariant(tx *gorm.DB, variant *ProductVariant) error {
+	var taken int64
+	if err := tx.Unscoped().Model(&ProductVariant{}).Where("product_variant_sku = ? AND id <> ?", variant.ProductVariantSku, variant.ID).Count(&taken).Error; err != nil {
+		return err
+	}
+	if taken > 0 {
+		return ErrVariantSkuTaken
+	}
+
+	var variants []ProductVariant
+	if err := tx.Preload("ProductVariantOptions").Where("product_variant_product_id = ? AND id <> ?", variant.ProductVariantProductId, variant.ID).Find(&variants).Error; err != nil {
+		return err
+	}
+
+	key := variant.optionKey()
+	for _, other := range variants {
+		if other.optionKey() == key {
+			return ErrVariantOptionsTaken
+		}
+	}
+	return nil
+}
+
+func CreateProductVariant(db *gorm.DB, variant *ProductVariant) (err error) {
+	return db.Transaction(func(tx *gorm.DB) error {
+		// the product row serializes variant changes of the product
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", variant.ProductVariantProductId).First(&Product{}).Error; err != nil {
+			return err
+		}
+
+		if err := checkVariant(tx, variant); err != nil {
+			return err
+		}
+
+		if err := tx.Create(variant).Error; err != nil {
+			return err
+		}
+
+		return openStock(tx, variant.ProductVariantProductId, int(variant.ID), variant.ProductVariantStock)
+	})
+}
+
+// get ProductVariant by id with its options
+func GetProductVariantById(db *gorm.DB, ProductVariant *ProductVariant, id int) (err error) {
+	err = db.Preload("ProductVariantOptions").Where("id = ?", id).First(ProductVariant).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// update ProductVariant, the options are replaced when new ones are given. The stock only changes through the stock ledger
+func UpdateProductVariant(db *gorm.DB, variant *ProductVariant, options []ProductVariantOption) (err error) {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", variant.ProductVariantProductId).First(&Product{}).Error; err != nil {
+			return err
+		}
+
+		if options != nil {
+			variant.ProductVariantOptions = options
+		}
+		if err := checkVariant(tx, variant); err != nil {
+			return err
+		}
+
+		if options != nil {
+			if err := tx.Unscoped().Where("product_variant_option_variant_id = ?", variant.ID).Delete(&ProductVariantOption{}).Error; err != nil {
+				return err
+			}
+
+			for i := range options {
+				options[i].ProductVariantOptionVariantId = int(variant.ID)
+			}
+			if err := tx.Create(&options).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Omit(clause.Associations, "product_variant_stock").Save(variant).Error
+	})
+}
+
+// delete ProductVariant
+func DeleteProductVariant(db *gorm.DB, ProductVariant *ProductVariant, id int) (err error) {
+	db.Where("id = ?", id).Delete(ProductVariant)
+	return nil
+}
+
+// the variant of the product to order, products with variants can only be ordered by variant
+func ResolveProductVariant(db *gorm.DB, p Product, variantId int) (*ProductVariant, error) {
+	if variantId == 0 {
+		var count int64
+		if err := db.Model(&ProductVariant{}).Where("product_variant_product_id = ?", p.ID).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			return nil, ErrVariantRequired
+		}
+		return nil, nil
+	}
+
+	variant := ProductVariant{}
+	err := db.Preload("ProductVariantOptions").Where("id = ? AND product_variant_product_id = ?", variantId, p.ID).First(&variant).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrVariantNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &variant, nil
+}
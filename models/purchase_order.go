@@ -0,0 +1,335 @@
+package models
+
+import (
+	"be-dbo-golang/utils/money"
+	"be-dbo-golang/utils/pagination"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	PurchaseOrderStatusDraft             = "draft"
+	PurchaseOrderStatusSent              = "sent"
+	PurchaseOrderStatusPartiallyReceived = "partially_received"
+	PurchaseOrderStatusReceived          = "received"
+	PurchaseOrderStatusClosed            = "closed"
+)
+
+var (
+	ErrPurchaseOrderNotDraft         = errors.New("purchase order can only be changed while it is a draft")
+	ErrPurchaseOrderNotOpen          = errors.New("purchase order is not open for receipts")
+	ErrPurchaseOrderInvalidLine      = errors.New("purchase order line does not belong to the purchase order")
+	ErrPurchaseOrderQtyExceeded      = errors.New("received quantity exceeds the quantity left to receive")
+	ErrPurchaseOrderNothingToReceive = errors.New("purchase order has nothing left to receive")
+	ErrPurchaseOrderProductSupplier  = errors.New("product is not supplied by the purchase order supplier")
+)
+
+// PurchaseOrder is sent by an admin to a supplier to restock products
+type PurchaseOrder struct {
+	gorm.Model
+	PurchaseOrderSupplierId         int                 `gorm:"not null;index" json:"purchase_order_supplier_id"`
+	PurchaseOrderAdminId            int                 `gorm:"not null" json:"purchase_order_admin_id"`
+	PurchaseOrderStatus             string              `gorm:"size:50;not null;default:draft;index" json:"purchase_order_status"`
+	PurchaseOrderExpectedDeliveryAt *time.Time          `json:"purchase_order_expected_delivery_at"`
+	PurchaseOrderSentAt             *time.Time          `json:"purchase_order_sent_at"`
+	PurchaseOrderClosedAt           *time.Time          `json:"purchase_order_closed_at"`
+	PurchaseOrderNote               string              `gorm:"size:255" json:"purchase_order_note"`
+	PurchaseOrderLines              []PurchaseOrderLine `gorm:"foreignKey:PurchaseOrderLineOrderId" json:"purchase_order_lines"`
+}
+
+// fields the purchase order list can be sorted by
+var PurchaseOrderSorts = pagination.Sortable{
+	"id":                   "id",
+	"supplier_id":          "purchase_order_supplier_id",
+	"status":               "purchase_order_status",
+	"expected_delivery_at": "purchase_order_expected_delivery_at",
+	"sent_at":              "purchase_order_sent_at",
+	"created_at":           "created_at",
+}
+
+type PurchaseOrderLine struct {
+	gorm.Model
+	PurchaseOrderLineOrderId     int         `gorm:"type:bigint unsigned;not null;index" json:"purchase_order_line_order_id"`
+	PurchaseOrderLineProductId   int         `gorm:"not null;index" json:"purchase_order_line_product_id"`
+	PurchaseOrderLineQty         int         `gorm:"not null" json:"purchase_order_line_qty"`
+	PurchaseOrderLineReceivedQty int         `gorm:"not null;default:0" json:"purchase_order_line_received_qty"`
+	PurchaseOrderLineUnitCost    money.Money `gorm:"embedded;embeddedPrefix:purchase_order_line_unit_cost_" json:"purchase_order_line_unit_cost"`
+}
+
+// quantity of the line that still has to be received
+func (l *PurchaseOrderLine) RemainingQty() int {
+	return l.PurchaseOrderLineQty - l.PurchaseOrderLineReceivedQty
+}
+
+// GoodsReceipt records goods received against a purchase order
+type GoodsReceipt struct {
+	gorm.Model
+	GoodsReceiptPurchaseOrderId int                `gorm:"not null;index" json:"goods_receipt_purchase_order_id"`
+	GoodsReceiptAdminId         int                `gorm:"not null" json:"goods_receipt_admin_id"`
+	GoodsReceiptReceivedAt      time.Time          `gorm:"not null" json:"goods_receipt_received_at"`
+	GoodsReceiptWarehouseId     int                `gorm:"not null;default:0" json:"goods_receipt_warehouse_id"`
+	GoodsReceiptNote            string             `gorm:"size:255" json:"goods_receipt_note"`
+	GoodsReceiptItems           []GoodsReceiptItem `gorm:"foreignKey:GoodsReceiptItemReceiptId" json:"goods_receipt_items"`
+}
+
+type GoodsReceiptItem struct {
+	gorm.Model
+	GoodsReceiptItemReceiptId int `gorm:"type:bigint unsigned;not null;index" json:"goods_receipt_item_receipt_id"`
+	GoodsReceiptItemLineId    int `gorm:"not null;index" json:"goods_receipt_item_line_id"`
+	GoodsReceiptItemProductId int `gorm:"not null" json:"goods_receipt_item_product_id"`
+	GoodsReceiptItemQty       int `gorm:"not null" json:"goods_receipt_item_qty"`
+}
+
+// check every line product is supplied by the supplier
+func checkPurchaseOrderProducts(db *gorm.DB, supplierId int, lines []PurchaseOrderLine) error {
+	for _, line := range lines {
+		p := Product{}
+		if err := db.Where("id = ?", line.PurchaseOrderLineProductId).First(&p).Error; err != nil {
+			return err
+		}
+		if p.ProductSupplierId != supplierId {
+			return ErrPurchaseOrderProductSupplier
+		}
+	}
+	return nil
+}
+
+// Record purchase order together with its lines
+func CreatePurchaseOrder(db *gorm.DB, PurchaseOrder *PurchaseOrder) (err error) {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := checkPurchaseOrderProducts(tx, PurchaseOrder.PurchaseOrderSupplierId, PurchaseOrder.PurchaseOrderLines); err != nil {
+			return err
+		}
+
+		return tx.Create(PurchaseOrder).Error
+	})
+}
+
+func (po *PurchaseOrder) GetPurchaseOrdersPaginate(db *gorm.DB, supplierId int, statuses []string, page, pageSize int, orderBy string) ([]PurchaseOrder, int, error) {
+	var purchaseOrders []PurchaseOrder
+	var count int64
+
+	filter := func(db *gorm.DB) *gorm.DB {
+		if supplierId > 0 {
+			db = db.Where("purchase_order_supplier_id = ?", supplierId)
+		}
+		if len(statuses) > 0 {
+			db = db.Where("purchase_order_status IN ?", statuses)
+		}
+		return db
+	}
+
+	// Count total records
+	if err := filter(db.Model(&PurchaseOrder{})).Count(&count).Error; err != nil {
+		return nil, 0, err
+	}
+
+	// Calculate total pages
+	totalPages := (int(count) + pageSize - 1) / pageSize
+
+	// Paginate and sort
+	if err := filter(db).Preload("PurchaseOrderLines").Order(orderBy).Offset((page - 1) * pageSize).Limit(pageSize).Find(&purchaseOrders).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return purchaseOrders, totalPages, nil
+}
+
+// get PurchaseOrder by id
+func GetPurchaseOrderById(db *gorm.DB, PurchaseOrder *PurchaseOrder, id int) (err error) {
+	err = db.Preload("PurchaseOrderLines").Where("id = ?", id).First(PurchaseOrder).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// update a draft PurchaseOrder, the lines are replaced when new ones are given
+func UpdatePurchaseOrder(db *gorm.DB, purchaseOrder *PurchaseOrder, lines []PurchaseOrderLine) (err error) {
+	return db.Transaction(func(tx *gorm.DB) error {
+		current := PurchaseOrder{}
+
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", purchaseOrder.ID).First(&current).Error; err != nil {
+			return err
+		}
+
+		if current.PurchaseOrderStatus != PurchaseOrderStatusDraft {
+			return ErrPurchaseOrderNotDraft
+		}
+
+		if lines != nil {
+			if err := checkPurchaseOrderProducts(tx, purchaseOrder.PurchaseOrderSupplierId, lines); err != nil {
+				return err
+			}
+
+			if err := tx.Unscoped().Where("purchase_order_line_order_id = ?", purchaseOrder.ID).Delete(&PurchaseOrderLine{}).Error; err != nil {
+				return err
+			}
+
+			for i := range lines {
+				lines[i].PurchaseOrderLineOrderId = int(purchaseOrder.ID)
+			}
+			if err := tx.Create(&lines).Error; err != nil {
+				return err
+			}
+			purchaseOrder.PurchaseOrderLines = lines
+		}
+
+		return tx.Omit(clause.Associations).Save(purchaseOrder).Error
+	})
+}
+
+// send a draft PurchaseOrder to its supplier
+func SendPurchaseOrder(db *gorm.DB, purchaseOrder *PurchaseOrder, sentAt time.Time) (err error) {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", purchaseOrder.ID).First(purchaseOrder).Error; err != nil {
+			return err
+		}
+
+		if purchaseOrder.PurchaseOrderStatus != PurchaseOrderStatusDraft {
+			return ErrPurchaseOrderNotDraft
+		}
+
+		purchaseOrder.PurchaseOrderStatus = PurchaseOrderStatusSent
+		purchaseOrder.PurchaseOrderSentAt = &sentAt
+
+		return tx.Model(purchaseOrder).Updates(map[string]interface{}{"purchase_order_status": purchaseOrder.PurchaseOrderStatus, "purchase_order_sent_at": sentAt}).Error
+	})
+}
+
+// close a PurchaseOrder, nothing more is received against it
+func ClosePurchaseOrder(db *gorm.DB, purchaseOrder *PurchaseOrder, closedAt time.Time) (err error) {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", purchaseOrder.ID).First(purchaseOrder).Error; err != nil {
+			return err
+		}
+
+		if purchaseOrder.PurchaseOrderStatus == PurchaseOrderStatusClosed {
+			return ErrPurchaseOrderNotOpen
+		}
+
+		purchaseOrder.PurchaseOrderStatus = PurchaseOrderStatusClosed
+		purchaseOrder.PurchaseOrderClosedAt = &closedAt
+
+		return tx.Model(purchaseOrder).Updates(map[string]interface{}{"purchase_order_status": purchaseOrder.PurchaseOrderStatus, "purchase_order_closed_at": closedAt}).Error
+	})
+}
+
+// delete a draft PurchaseOrder
+func DeletePurchaseOrder(db *gorm.DB, PurchaseOrder *PurchaseOrder, id int) (err error) {
+	db.Where("id = ? AND purchase_order_status = ?", id, PurchaseOrderStatusDraft).Delete(PurchaseOrder)
+	return nil
+}
+
+// Record goods receipt and add the received quantities to the product stock,
+// receives every remaining line when no items are given
+func ReceivePurchaseOrder(db *gorm.DB, receipt *GoodsReceipt) (err error) {
+	return db.Transaction(func(tx *gorm.DB) error {
+		purchaseOrder := PurchaseOrder{}
+
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("PurchaseOrderLines").Where("id = ?", receipt.GoodsReceiptPurchaseOrderId).First(&purchaseOrder).Error; err != nil {
+			return err
+		}
+
+		if purchaseOrder.PurchaseOrderStatus != PurchaseOrderStatusSent && purchaseOrder.PurchaseOrderStatus != PurchaseOrderStatusPartiallyReceived {
+			return ErrPurchaseOrderNotOpen
+		}
+
+		lines := map[int]*PurchaseOrderLine{}
+		for i := range purchaseOrder.PurchaseOrderLines {
+			lines[int(purchaseOrder.PurchaseOrderLines[i].ID)] = &purchaseOrder.PurchaseOrderLines[i]
+		}
+
+		if len(receipt.GoodsReceiptItems) == 0 {
+			for _, line := range purchaseOrder.PurchaseOrderLines {
+				if line.RemainingQty() > 0 {
+					receipt.GoodsReceiptItems = append(receipt.GoodsReceiptItems, GoodsReceiptItem{
+						GoodsReceiptItemLineId: int(line.ID),
+						GoodsReceiptItemQty:    line.RemainingQty(),
+					})
+				}
+			}
+
+			if len(receipt.GoodsReceiptItems) == 0 {
+				return ErrPurchaseOrderNothingToReceive
+			}
+		}
+
+		// goods are put in the default warehouse unless another one is given
+		if receipt.GoodsReceiptWarehouseId == 0 {
+			warehouseId, err := defaultWarehouseId(tx)
+			if err != nil {
+				return err
+			}
+			receipt.GoodsReceiptWarehouseId = warehouseId
+		} else if err := tx.Where("id = ?", receipt.GoodsReceiptWarehouseId).First(&Warehouse{}).Error; err != nil {
+			return err
+		}
+
+		for i := range receipt.GoodsReceiptItems {
+			item := &receipt.GoodsReceiptItems[i]
+
+			line, ok := lines[item.GoodsReceiptItemLineId]
+			if !ok {
+				return ErrPurchaseOrderInvalidLine
+			}
+
+			if item.GoodsReceiptItemQty <= 0 || item.GoodsReceiptItemQty > line.RemainingQty() {
+				return ErrPurchaseOrderQtyExceeded
+			}
+
+			item.GoodsReceiptItemProductId = line.PurchaseOrderLineProductId
+			line.PurchaseOrderLineReceivedQty += item.GoodsReceiptItemQty
+
+			if err := tx.Model(line).Update("purchase_order_line_received_qty", line.PurchaseOrderLineReceivedQty).Error; err != nil {
+				return err
+			}
+
+			if err := moveStock(tx, &StockMovement{
+				StockMovementProductId:     line.PurchaseOrderLineProductId,
+				StockMovementWarehouseId:   receipt.GoodsReceiptWarehouseId,
+				StockMovementDelta:         item.GoodsReceiptItemQty,
+				StockMovementReason:        StockReasonReceipt,
+				StockMovementReferenceType: StockReferencePurchaseOrderLine,
+				StockMovementReferenceId:   int(line.ID),
+			}); err != nil {
+				return err
+			}
+		}
+
+		if receipt.GoodsReceiptReceivedAt.IsZero() {
+			receipt.GoodsReceiptReceivedAt = time.Now()
+		}
+
+		if err := tx.Create(receipt).Error; err != nil {
+			return err
+		}
+
+		for _, item := range receipt.GoodsReceiptItems {
+			if err := AllocateBackorders(tx, item.GoodsReceiptItemProductId); err != nil {
+				return err
+			}
+		}
+
+		status := PurchaseOrderStatusReceived
+		for _, line := range lines {
+			if line.RemainingQty() > 0 {
+				status = PurchaseOrderStatusPartiallyReceived
+			}
+		}
+
+		return tx.Model(&purchaseOrder).Update("purchase_order_status", status).Error
+	})
+}
+
+// get goods receipts of a purchase order
+func GetGoodsReceiptsByPurchaseOrder(db *gorm.DB, GoodsReceipts *[]GoodsReceipt, purchaseOrderId int) (err error) {
+	err = db.Preload("GoodsReceiptItems").Where("goods_receipt_purchase_order_id = ?", purchaseOrderId).Order("id asc").Find(GoodsReceipts).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
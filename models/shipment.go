@@ -0,0 +1,160 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrShipmentNothingToShip = errors.New("order has nothing left to ship")
+	ErrShipmentInvalidLine   = errors.New("order line does not belong to the order")
+	ErrShipmentQtyExceeded   = errors.New("shipped quantity exceeds the quantity left to ship")
+)
+
+type Shipment struct {
+	gorm.Model
+	ShipmentOrderId        int            `gorm:"not null;index" json:"shipment_order_id"`
+	ShipmentCarrier        string         `gorm:"size:255;not null" json:"shipment_carrier"`
+	ShipmentTrackingNumber string         `gorm:"size:255;not null" json:"shipment_tracking_number"`
+	ShipmentShippedAt      *time.Time     `json:"shipment_shipped_at"`
+	ShipmentDeliveredAt    *time.Time     `json:"shipment_delivered_at"`
+	ShipmentItems          []ShipmentItem `gorm:"foreignKey:ShipmentItemShipmentId" json:"shipment_items"`
+}
+
+type ShipmentItem struct {
+	gorm.Model
+	ShipmentItemShipmentId  int `gorm:"type:bigint unsigned;not null;index" json:"shipment_item_shipment_id"`
+	ShipmentItemOrderLineId int `gorm:"not null;index" json:"shipment_item_order_line_id"`
+	ShipmentItemQty         int `gorm:"not null" json:"shipment_item_qty"`
+}
+
+// Record shipment, ships everything that is in stock when no items are given
+func CreateShipment(db *gorm.DB, Shipment *Shipment) (err error) {
+	return db.Transaction(func(tx *gorm.DB) error {
+		order := Order{}
+
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("OrderLines").Where("id = ?", Shipment.ShipmentOrderId).First(&order).Error; err != nil {
+			return err
+		}
+
+		if order.OrderStatus == OrderStatusRejected {
+			return ErrOrderRejected
+		}
+
+		lines := map[int]*OrderLine{}
+		for i := range order.OrderLines {
+			lines[int(order.OrderLines[i].ID)] = &order.OrderLines[i]
+		}
+
+		if len(Shipment.ShipmentItems) == 0 {
+			for _, line := range order.OrderLines {
+				if line.AllocatedQty() > 0 {
+					Shipment.ShipmentItems = append(Shipment.ShipmentItems, ShipmentItem{
+						ShipmentItemOrderLineId: int(line.ID),
+						ShipmentItemQty:         line.AllocatedQty(),
+					})
+				}
+			}
+
+			if len(Shipment.ShipmentItems) == 0 {
+				return ErrShipmentNothingToShip
+			}
+		}
+
+		for _, item := range Shipment.ShipmentItems {
+			line, ok := lines[item.ShipmentItemOrderLineId]
+			if !ok {
+				return ErrShipmentInvalidLine
+			}
+
+			if item.ShipmentItemQty <= 0 || item.ShipmentItemQty > line.AllocatedQty() {
+				return ErrShipmentQtyExceeded
+			}
+
+			line.OrderLineShippedQty += item.ShipmentItemQty
+
+			if err := tx.Model(line).Update("order_line_shipped_qty", line.OrderLineShippedQty).Error; err != nil {
+				return err
+			}
+		}
+
+		if Shipment.ShipmentShippedAt == nil {
+			now := time.Now()
+			Shipment.ShipmentShippedAt = &now
+		}
+
+		if err := tx.Create(Shipment).Error; err != nil {
+			return err
+		}
+
+		status := OrderStatusShipped
+		for _, line := range lines {
+			if line.RemainingQty() > 0 {
+				status = OrderStatusPartiallyShipped
+			}
+		}
+
+		return tx.Model(&order).Update("order_status", status).Error
+	})
+}
+
+// get Shipment by id
+func GetShipmentById(db *gorm.DB, Shipment *Shipment, id int) (err error) {
+	err = db.Preload("ShipmentItems").Where("id = ?", id).First(Shipment).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// get shipments of an order
+func GetShipmentsByOrder(db *gorm.DB, Shipments *[]Shipment, orderId int) (err error) {
+	err = db.Preload("ShipmentItems").Where("shipment_order_id = ?", orderId).Order("id asc").Find(Shipments).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// update Shipment carrier and tracking
+func UpdateShipment(db *gorm.DB, Shipment *Shipment, id int) (err error) {
+	err = db.Omit(clause.Associations).Where("id = ?", id).Updates(Shipment).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// mark Shipment delivered, the order is delivered once everything shipped has arrived
+func DeliverShipment(db *gorm.DB, shipment *Shipment, deliveredAt time.Time) (err error) {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(shipment).Update("shipment_delivered_at", deliveredAt).Error; err != nil {
+			return err
+		}
+		shipment.ShipmentDeliveredAt = &deliveredAt
+
+		order := Order{}
+
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", shipment.ShipmentOrderId).First(&order).Error; err != nil {
+			return err
+		}
+
+		if order.OrderStatus != OrderStatusShipped {
+			return nil
+		}
+
+		var pending int64
+		if err := tx.Model(&Shipment{}).Where("shipment_order_id = ? AND shipment_delivered_at IS NULL", order.ID).Count(&pending).Error; err != nil {
+			return err
+		}
+
+		if pending > 0 {
+			return nil
+		}
+
+		return tx.Model(&order).Update("order_status", OrderStatusDelivered).Error
+	})
+}
@@ -0,0 +1,310 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInsufficientStock  = errors.New("not enough stock for the requested quantity")
+	ErrStockLedgerTooHigh = errors.New("stock ledger holds more than the order line has allocated")
+)
+
+// whether orders can go beyond the stock of the product
+func (p *Product) allowsBackorder() bool {
+	return p.ProductBackorderable || p.ProductPreorderable
+}
+
+// quantity that can't be taken from the stock of the product or its variant, an error when the product
+// can't be backordered for it. lineId is the order line being allocated again, its own backorder isn't counted
+// against the limit, 0 for a new one.
+func (p *Product) stockShortage(db *gorm.DB, stock, qty, lineId int) (int, error) {
+	if qty <= stock {
+		return 0, nil
+	}
+
+	shortage := qty - stock
+	if stock < 0 {
+		shortage = qty
+	}
+
+	if !p.allowsBackorder() {
+		return 0, fmt.Errorf("%w: product %d", ErrInsufficientStock, p.ID)
+	}
+
+	if p.ProductBackorderLimit > 0 {
+		var backordered int64
+		if err := db.Model(&OrderLine{}).
+			Joins("JOIN orders ON orders.id = order_lines.order_line_order_id AND orders.deleted_at IS NULL AND orders.order_status <> ?", OrderStatusRejected).
+			Where("order_lines.order_line_product_id = ? AND order_lines.id <> ?", p.ID, lineId).Select("COALESCE(SUM(order_lines.order_line_backordered_qty), 0)").Scan(&backordered).Error; err != nil {
+			return 0, err
+		}
+
+		if int(backordered)+shortage > p.ProductBackorderLimit {
+			return 0, fmt.Errorf("%w: product %d", ErrInsufficientStock, p.ID)
+		}
+	}
+
+	return shortage, nil
+}
+
+// check the product, or its variant when one is given, can take an order of the quantity, from stock or as a backorder
+func CheckProductStock(db *gorm.DB, productId, variantId, qty int) (err error) {
+	p := Product{}
+
+	if err := db.Where("id = ?", productId).First(&p).Error; err != nil {
+		return err
+	}
+
+	variant, err := ResolveProductVariant(db, p, variantId)
+	if err != nil {
+		return err
+	}
+
+	stock := p.ProductStock
+	if variant != nil {
+		stock = variant.ProductVariantStock
+	}
+
+	_, err = p.stockShortage(db, stock, qty, 0)
+	return err
+}
+
+// take the unshipped quantity of the line from the warehouses of its product or variant, picked by the allocation
+// strategy for the address, what is missing is backordered. The sales are returned to be written to the ledger
+// once the line has an id.
+func reserveStock(tx *gorm.DB, line *OrderLine, to Address) ([]StockMovement, error) {
+	p := Product{}
+
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", line.OrderLineProductId).First(&p).Error; err != nil {
+		return nil, err
+	}
+
+	if line.OrderLineVariantId > 0 {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ? AND product_variant_product_id = ?", line.OrderLineVariantId, p.ID).First(&ProductVariant{}).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	stocks, err := allocationOrder(tx, line.OrderLineProductId, line.OrderLineVariantId, to)
+	if err != nil {
+		return nil, err
+	}
+
+	stock := 0
+	for _, s := range stocks {
+		stock += s.WarehouseStockQty
+	}
+
+	qty := line.OrderLineQty - line.OrderLineShippedQty
+
+	shortage, err := p.stockShortage(tx, stock, qty, int(line.ID))
+	if err != nil {
+		return nil, err
+	}
+
+	line.OrderLineBackorderedQty = shortage
+	line.OrderLineAvailableAt = nil
+	if shortage > 0 {
+		line.OrderLineAvailableAt = p.ProductAvailableAt
+	}
+
+	return drawStock(tx, stocks, StockMovement{
+		StockMovementProductId:     line.OrderLineProductId,
+		StockMovementVariantId:     line.OrderLineVariantId,
+		StockMovementReason:        StockReasonSale,
+		StockMovementReferenceType: StockReferenceOrderLine,
+		StockMovementReferenceId:   int(line.ID),
+	}, qty-shortage)
+}
+
+// write the sales of the lines to the ledger, in the order of the lines
+func recordSales(tx *gorm.DB, lines []OrderLine, sales [][]StockMovement) error {
+	for i := range sales {
+		for j := range sales[i] {
+			sales[i][j].StockMovementReferenceId = int(lines[i].ID)
+			if err := tx.Create(&sales[i][j]).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// give the stock held by the line back to the warehouses it was taken from
+func releaseStock(tx *gorm.DB, line OrderLine) error {
+	type held struct {
+		WarehouseId int
+		Qty         int
+	}
+
+	var warehouses []held
+	if err := tx.Model(&StockMovement{}).
+		Select("stock_movement_warehouse_id AS warehouse_id, -SUM(stock_movement_delta) AS qty").
+		Where("stock_movement_reference_type = ? AND stock_movement_reference_id = ?", StockReferenceOrderLine, line.ID).
+		Group("stock_movement_warehouse_id").Having("-SUM(stock_movement_delta) > 0").Order("stock_movement_warehouse_id asc").
+		Scan(&warehouses).Error; err != nil {
+		return err
+	}
+
+	// shipped stock stays out, what the ledger still holds for the line can't be more than it has allocated
+	qty := line.AllocatedQty()
+
+	ledger := 0
+	for _, warehouse := range warehouses {
+		ledger += warehouse.Qty
+	}
+	if ledger-line.OrderLineShippedQty > qty {
+		return fmt.Errorf("%w: order line %d holds %d, allocated %d", ErrStockLedgerTooHigh, line.ID, ledger-line.OrderLineShippedQty, qty)
+	}
+
+	// lines from before the ledger give the rest of their stock back to the default warehouse
+	if ledger < qty {
+		warehouseId, err := defaultWarehouseId(tx)
+		if err != nil {
+			return err
+		}
+		warehouses = append(warehouses, held{WarehouseId: warehouseId, Qty: qty - ledger})
+	}
+
+	for _, warehouse := range warehouses {
+		if qty <= 0 {
+			break
+		}
+
+		back := min(qty, warehouse.Qty)
+		qty -= back
+
+		if err := moveStock(tx, &StockMovement{
+			StockMovementProductId:     line.OrderLineProductId,
+			StockMovementVariantId:     line.OrderLineVariantId,
+			StockMovementWarehouseId:   warehouse.WarehouseId,
+			StockMovementDelta:         back,
+			StockMovementReason:        StockReasonReturn,
+			StockMovementReferenceType: StockReferenceOrderLine,
+			StockMovementReferenceId:   int(line.ID),
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// status of an order once its lines were allocated
+func backorderStatus(status string, lines []OrderLine) string {
+	for _, line := range lines {
+		if line.OrderLineBackorderedQty > 0 {
+			if status == OrderStatusPending {
+				return OrderStatusBackordered
+			}
+			return status
+		}
+	}
+
+	if status == OrderStatusBackordered {
+		return OrderStatusPending
+	}
+	return status
+}
+
+// hand the stock of the product and its variants to waiting backorders, oldest order lines first
+func AllocateBackorders(db *gorm.DB, productId int) (err error) {
+	return db.Transaction(func(tx *gorm.DB) error {
+		p := Product{}
+
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", productId).First(&p).Error; err != nil {
+			return err
+		}
+
+		var variants []ProductVariant
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("product_variant_product_id = ?", productId).Find(&variants).Error; err != nil {
+			return err
+		}
+
+		// whether any stock is left for the product or its variants
+		available := p.ProductStock > 0
+		for _, variant := range variants {
+			if variant.ProductVariantStock > 0 {
+				available = true
+			}
+		}
+		if !available {
+			return nil
+		}
+
+		var lines []OrderLine
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Joins("JOIN orders ON orders.id = order_lines.order_line_order_id AND orders.deleted_at IS NULL").
+			Where("order_lines.order_line_product_id = ? AND order_lines.order_line_backordered_qty > 0 AND orders.order_status <> ?", productId, OrderStatusRejected).
+			Order("order_lines.id asc").Find(&lines).Error; err != nil {
+			return err
+		}
+
+		orderIds := []int{}
+		orders := map[int]Order{}
+
+		for _, line := range lines {
+			order, ok := orders[line.OrderLineOrderId]
+			if !ok {
+				if err := tx.Where("id = ?", line.OrderLineOrderId).First(&order).Error; err != nil {
+					return err
+				}
+				orders[line.OrderLineOrderId] = order
+			}
+
+			stocks, err := allocationOrder(tx, productId, line.OrderLineVariantId, order.OrderShippingAddress)
+			if err != nil {
+				return err
+			}
+
+			stock := 0
+			for _, s := range stocks {
+				stock += s.WarehouseStockQty
+			}
+			if stock <= 0 {
+				continue
+			}
+
+			qty := min(line.OrderLineBackorderedQty, stock)
+
+			if err := tx.Model(&line).Update("order_line_backordered_qty", line.OrderLineBackorderedQty-qty).Error; err != nil {
+				return err
+			}
+
+			sales, err := drawStock(tx, stocks, StockMovement{
+				StockMovementProductId:     productId,
+				StockMovementVariantId:     line.OrderLineVariantId,
+				StockMovementReason:        StockReasonSale,
+				StockMovementReferenceType: StockReferenceOrderLine,
+				StockMovementReferenceId:   int(line.ID),
+			}, qty)
+			if err != nil {
+				return err
+			}
+			for i := range sales {
+				if err := tx.Create(&sales[i]).Error; err != nil {
+					return err
+				}
+			}
+			orderIds = append(orderIds, line.OrderLineOrderId)
+		}
+
+		for _, orderId := range orderIds {
+			var waiting int64
+			if err := tx.Model(&OrderLine{}).Where("order_line_order_id = ? AND order_line_backordered_qty > 0", orderId).Count(&waiting).Error; err != nil {
+				return err
+			}
+
+			if waiting == 0 {
+				if err := tx.Model(&Order{}).Where("id = ? AND order_status = ?", orderId, OrderStatusBackordered).Update("order_status", OrderStatusPending).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,219 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	StockAlertStatusOpen     = "open"
+	StockAlertStatusResolved = "resolved"
+
+	// failed deliveries are retried after a delay doubling from the first one up to the longest one, an alert is
+	// given up on after the last attempt so it doesn't hold back the newer ones
+	stockAlertFirstRetry  = time.Minute
+	stockAlertLongestWait = 6 * time.Hour
+	stockAlertMaxAttempts = 10
+)
+
+// StockAlert is raised when the stock of a product, or of one of its variants, falls to the reorder point of the
+// product. It stays open until the stock is above the reorder point again, so a product only alerts once per dip.
+type StockAlert struct {
+	gorm.Model
+	StockAlertProductId    int        `gorm:"type:bigint unsigned;not null;index:idx_stock_alert_item" json:"stock_alert_product_id"`
+	StockAlertVariantId    int        `gorm:"not null;default:0;index:idx_stock_alert_item" json:"stock_alert_variant_id"`
+	StockAlertStock        int        `gorm:"not null" json:"stock_alert_stock"`
+	StockAlertReorderPoint int        `gorm:"not null" json:"stock_alert_reorder_point"`
+	StockAlertReorderQty   int        `gorm:"not null" json:"stock_alert_reorder_qty"`
+	StockAlertStatus       string     `gorm:"size:20;not null;default:open;index" json:"stock_alert_status"`
+	StockAlertDeliveredTo  string     `gorm:"size:255" json:"stock_alert_delivered_to"`
+	StockAlertNotifiedAt   *time.Time `gorm:"index" json:"stock_alert_notified_at"`
+	StockAlertAttempts     int        `gorm:"not null;default:0" json:"stock_alert_attempts"`
+	StockAlertRetryAt      *time.Time `gorm:"index" json:"stock_alert_retry_at"`
+	StockAlertGaveUpAt     *time.Time `gorm:"index" json:"stock_alert_gave_up_at"`
+	StockAlertResolvedAt   *time.Time `json:"stock_alert_resolved_at"`
+}
+
+// LowStockItem is a product, or a variant of it, whose stock is at or below the reorder point of the product
+type LowStockItem struct {
+	ProductId    int    `json:"product_id"`
+	VariantId    int    `json:"variant_id"`
+	ProductName  string `json:"product_name"`
+	VariantSku   string `json:"variant_sku"`
+	SupplierId   int    `json:"supplier_id"`
+	Stock        int    `json:"stock"`
+	ReorderPoint int    `json:"reorder_point"`
+	ReorderQty   int    `json:"reorder_qty"`
+}
+
+// raise an alert when the stock of the product or variant is at or below the reorder point and none is open yet,
+// resolve the open one once the stock is above it
+func checkStockAlert(tx *gorm.DB, productId, variantId, stock int) error {
+	p := Product{}
+	if err := tx.Select("id", "product_reorder_point", "product_reorder_qty").Where("id = ?", productId).First(&p).Error; err != nil {
+		return err
+	}
+
+	open := StockAlert{}
+	err := tx.Where("stock_alert_product_id = ? AND stock_alert_variant_id = ? AND stock_alert_status = ?", productId, variantId, StockAlertStatusOpen).First(&open).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	alerted := err == nil
+
+	low := p.ProductReorderPoint > 0 && stock <= p.ProductReorderPoint
+
+	if low && !alerted {
+		return tx.Create(&StockAlert{
+			StockAlertProductId:    productId,
+			StockAlertVariantId:    variantId,
+			StockAlertStock:        stock,
+			StockAlertReorderPoint: p.ProductReorderPoint,
+			StockAlertReorderQty:   p.ProductReorderQty,
+			StockAlertStatus:       StockAlertStatusOpen,
+		}).Error
+	}
+
+	if !low && alerted {
+		return tx.Model(&open).Updates(map[string]interface{}{"stock_alert_status": StockAlertStatusResolved, "stock_alert_resolved_at": time.Now()}).Error
+	}
+	return nil
+}
+
+// check the stock of the product, or of each of its variants when it has some, against its reorder point
+func checkStockAlerts(tx *gorm.DB, p Product) error {
+	var variants []ProductVariant
+	if err := tx.Where("product_variant_product_id = ?", p.ID).Find(&variants).Error; err != nil {
+		return err
+	}
+
+	if len(variants) == 0 {
+		return checkStockAlert(tx, int(p.ID), 0, p.ProductStock)
+	}
+
+	for _, variant := range variants {
+		if err := checkStockAlert(tx, int(p.ID), int(variant.ID), variant.ProductVariantStock); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write the reorder settings and check the stock against them, kept apart because Updates skips zero
+func UpdateProductReorder(db *gorm.DB, Product *Product, id int) (err error) {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(Product).Where("id = ?", id).Updates(map[string]interface{}{
+			"product_reorder_point": Product.ProductReorderPoint,
+			"product_reorder_qty":   Product.ProductReorderQty,
+		}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("id = ?", id).First(Product).Error; err != nil {
+			return err
+		}
+		return checkStockAlerts(tx, *Product)
+	})
+}
+
+// alerts that weren't delivered yet and are due for an attempt, those never tried before first
+func GetUndeliveredStockAlerts(db *gorm.DB, alerts *[]StockAlert, now time.Time, limit int) (err error) {
+	return db.Where("stock_alert_notified_at IS NULL AND stock_alert_gave_up_at IS NULL").
+		Where("stock_alert_retry_at IS NULL OR stock_alert_retry_at <= ?", now).
+		Order("stock_alert_attempts asc, id asc").Limit(limit).Find(alerts).Error
+}
+
+// delay before the next attempt after the given number of failed ones
+func stockAlertRetryDelay(attempts int) time.Duration {
+	delay := stockAlertFirstRetry
+	for i := 1; i < attempts && delay < stockAlertLongestWait; i++ {
+		delay *= 2
+	}
+	return min(delay, stockAlertLongestWait)
+}
+
+// count a failed attempt and schedule the next one, or give up after the last
+func (alert *StockAlert) failed(now time.Time) {
+	alert.StockAlertAttempts++
+
+	if alert.StockAlertAttempts >= stockAlertMaxAttempts {
+		alert.StockAlertRetryAt = nil
+		alert.StockAlertGaveUpAt = &now
+		return
+	}
+
+	retryAt := now.Add(stockAlertRetryDelay(alert.StockAlertAttempts))
+	alert.StockAlertRetryAt = &retryAt
+}
+
+func MarkStockAlertFailed(db *gorm.DB, alert *StockAlert, now time.Time) (err error) {
+	alert.failed(now)
+	return db.Model(alert).Updates(map[string]interface{}{
+		"stock_alert_attempts":   alert.StockAlertAttempts,
+		"stock_alert_retry_at":   alert.StockAlertRetryAt,
+		"stock_alert_gave_up_at": alert.StockAlertGaveUpAt,
+	}).Error
+}
+
+// notifiers the alert was delivered to, comma separated
+func (alert StockAlert) DeliveredTo() []string {
+	if alert.StockAlertDeliveredTo == "" {
+		return nil
+	}
+	return strings.Split(alert.StockAlertDeliveredTo, ",")
+}
+
+// record the notifiers the alert was delivered to, it is only tried again on the others
+func MarkStockAlertDelivered(db *gorm.DB, alert *StockAlert, delivered []string) (err error) {
+	alert.StockAlertDeliveredTo = strings.Join(delivered, ",")
+	return db.Model(alert).Update("stock_alert_delivered_to", alert.StockAlertDeliveredTo).Error
+}
+
+// the alert reached every notifier
+func MarkStockAlertNotified(db *gorm.DB, alert *StockAlert, at time.Time) (err error) {
+	alert.StockAlertNotifiedAt = &at
+	return db.Model(alert).Update("stock_alert_notified_at", at).Error
+}
+
+// products, or their variants, at or below their reorder point, only those of the supplier when supplierId isn't 0
+func GetLowStockPaginate(db *gorm.DB, supplierId int, page, pageSize int) ([]LowStockItem, int, error) {
+	var items []LowStockItem
+	var count int64
+
+	products := db.Model(&Product{}).
+		Select("products.id AS product_id, 0 AS variant_id, products.product_name, '' AS variant_sku, products.product_supplier_id AS supplier_id, products.product_stock AS stock, products.product_reorder_point AS reorder_point, products.product_reorder_qty AS reorder_qty").
+		Where("products.product_reorder_point > 0 AND products.product_stock <= products.product_reorder_point").
+		Where("NOT EXISTS (SELECT 1 FROM product_variants v WHERE v.product_variant_product_id = products.id AND v.deleted_at IS NULL)")
+
+	variants := db.Model(&ProductVariant{}).
+		Joins("JOIN products ON products.id = product_variants.product_variant_product_id AND products.deleted_at IS NULL").
+		Select("products.id AS product_id, product_variants.id AS variant_id, products.product_name, product_variants.product_variant_sku AS variant_sku, products.product_supplier_id AS supplier_id, product_variants.product_variant_stock AS stock, products.product_reorder_point AS reorder_point, products.product_reorder_qty AS reorder_qty").
+		Where("products.product_reorder_point > 0 AND product_variants.product_variant_stock <= products.product_reorder_point")
+
+	if supplierId > 0 {
+		products = products.Where("products.product_supplier_id = ?", supplierId)
+		variants = variants.Where("products.product_supplier_id = ?", supplierId)
+	}
+
+	low := func() *gorm.DB {
+		return db.Table("(?) AS low_stock", db.Raw("? UNION ALL ?", products, variants))
+	}
+
+	// Count total records
+	if err := low().Count(&count).Error; err != nil {
+		return nil, 0, err
+	}
+
+	// Calculate total pages
+	totalPages := (int(count) + pageSize - 1) / pageSize
+
+	// Paginate and sort, the emptiest first
+	if err := low().Order("stock asc, product_id asc, variant_id asc").Offset((page - 1) * pageSize).Limit(pageSize).Scan(&items).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return items, totalPages, nil
+}
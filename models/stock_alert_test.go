@@ -0,0 +1,97 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStockAlertRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{9, 256 * time.Minute},
+		{10, 6 * time.Hour},
+		{50, 6 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		if got := stockAlertRetryDelay(tt.attempts); got != tt.want {
+			t.Errorf("stockAlertRetryDelay(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestStockAlertFailed(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	alert := StockAlert{}
+	for attempt := 1; attempt < stockAlertMaxAttempts; attempt++ {
+		alert.failed(now)
+		if alert.StockAlertAttempts != attempt || alert.StockAlertGaveUpAt != nil {
+			t.Fatalf("after %d failures: attempts = %d, gave up at %v", attempt, alert.StockAlertAttempts, alert.StockAlertGaveUpAt)
+		}
+		if want := now.Add(stockAlertRetryDelay(attempt)); alert.StockAlertRetryAt == nil || !alert.StockAlertRetryAt.Equal(want) {
+			t.Fatalf("after %d failures: retry at %v, want %v", attempt, alert.StockAlertRetryAt, want)
+		}
+	}
+
+	alert.failed(now)
+	if alert.StockAlertGaveUpAt == nil || alert.StockAlertRetryAt != nil {
+		t.Errorf("after %d failures: gave up at %v, retry at %v", stockAlertMaxAttempts, alert.StockAlertGaveUpAt, alert.StockAlertRetryAt)
+	}
+}
+
+// more stuck alerts than a batch holds mustn't keep a new alert from being delivered
+func TestStuckStockAlertsDontHoldBackNewOnes(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	const batch = 100
+
+	stuck := make([]StockAlert, batch+50)
+	for i := range stuck {
+		stuck[i].ID = uint(i + 1)
+		stuck[i].failed(now)
+	}
+
+	// on the next tick none of the stuck alerts is due anymore
+	next := now.Add(time.Minute - time.Second)
+	for _, alert := range stuck {
+		if !alert.StockAlertRetryAt.After(next) {
+			t.Fatalf("stuck alert %d is retried at %v, before the next tick", alert.ID, alert.StockAlertRetryAt)
+		}
+	}
+
+	db, fake := newFakeDb(t, nil)
+
+	var alerts []StockAlert
+	if err := GetUndeliveredStockAlerts(db, &alerts, next, batch); err != nil {
+		t.Fatal(err)
+	}
+
+	last := fake.last()
+	sql := last.SQL
+	for _, want := range []string{
+		"stock_alert_notified_at IS NULL AND stock_alert_gave_up_at IS NULL",
+		"(stock_alert_retry_at IS NULL OR stock_alert_retry_at <= ?)",
+		"ORDER BY stock_alert_attempts asc, id asc",
+		"LIMIT ?",
+	} {
+		if !strings.Contains(sql, want) {
+			t.Errorf("query %q doesn't contain %q", sql, want)
+		}
+	}
+
+	found := false
+	for _, v := range last.Args {
+		if at, ok := v.(time.Time); ok && at.Equal(next) {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("query vars %v don't hold the time %v", last.Args, next)
+	}
+}
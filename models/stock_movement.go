@@ -0,0 +1,313 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// why the stock moved
+const (
+	StockReasonSale       = "sale"
+	StockReasonReturn     = "return"
+	StockReasonReceipt    = "receipt"
+	StockReasonAdjustment = "adjustment"
+	StockReasonStockTake  = "stock_take"
+	StockReasonTransfer   = "transfer"
+)
+
+// what a movement refers to
+const (
+	StockReferenceOrderLine         = "order_line"
+	StockReferencePurchaseOrderLine = "purchase_order_line"
+	StockReferenceWarehouseTransfer = "warehouse_transfer"
+)
+
+var ErrStockNegative = errors.New("stock can't go below zero")
+
+// StockMovement is an entry of the stock ledger, movements are never changed once written. The stock of the
+// product or its variant is kept equal to the balance of its latest movement, and its stock in the warehouse
+// of the movement to the warehouse balance.
+type StockMovement struct {
+	ID                            uint      `gorm:"primarykey" json:"id"`
+	CreatedAt                     time.Time `gorm:"index" json:"created_at"`
+	StockMovementProductId        int       `gorm:"type:bigint unsigned;not null;index:idx_stock_movement_item" json:"stock_movement_product_id"`
+	StockMovementVariantId        int       `gorm:"not null;default:0;index:idx_stock_movement_item" json:"stock_movement_variant_id"`
+	StockMovementWarehouseId      int       `gorm:"not null;default:0;index" json:"stock_movement_warehouse_id"`
+	StockMovementDelta            int       `gorm:"not null" json:"stock_movement_delta"`
+	StockMovementBalance          int       `gorm:"not null" json:"stock_movement_balance"`
+	StockMovementWarehouseBalance int       `gorm:"not null;default:0" json:"stock_movement_warehouse_balance"`
+	StockMovementReason           string    `gorm:"size:20;not null;index" json:"stock_movement_reason"`
+	StockMovementReferenceType    string    `gorm:"size:50" json:"stock_movement_reference_type"`
+	StockMovementReferenceId      int       `gorm:"not null;default:0" json:"stock_movement_reference_id"`
+	StockMovementActorId          int       `gorm:"not null;default:0" json:"stock_movement_actor_id"`
+	StockMovementActorRole        string    `gorm:"size:20" json:"stock_movement_actor_role"`
+	StockMovementNote             string    `gorm:"size:255" json:"stock_movement_note"`
+}
+
+// stock held on the product itself, or on the variant when the movement has one
+func (m *StockMovement) stockOf(tx *gorm.DB) *gorm.DB {
+	if m.StockMovementVariantId > 0 {
+		return tx.Model(&ProductVariant{}).Where("id = ? AND product_variant_product_id = ?", m.StockMovementVariantId, m.StockMovementProductId)
+	}
+	return tx.Model(&Product{}).Where("id = ?", m.StockMovementProductId)
+}
+
+func (m *StockMovement) stockColumn() string {
+	if m.StockMovementVariantId > 0 {
+		return "product_variant_stock"
+	}
+	return "product_stock"
+}
+
+// current stock of the product or variant of the movement, locked until the transaction ends
+func (m *StockMovement) currentStock(tx *gorm.DB) (int, error) {
+	var stocks []int
+	if err := m.stockOf(tx).Clauses(clause.Locking{Strength: "UPDATE"}).Pluck(m.stockColumn(), &stocks).Error; err != nil {
+		return 0, err
+	}
+	if len(stocks) == 0 {
+		return 0, gorm.ErrRecordNotFound
+	}
+	return stocks[0], nil
+}
+
+// stock of the product or variant of the movement in its warehouse, locked until the transaction ends
+func (m *StockMovement) currentWarehouseStock(tx *gorm.DB) (int, error) {
+	var stocks []int
+	if err := tx.Model(&WarehouseStock{}).Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("warehouse_stock_warehouse_id = ? AND warehouse_stock_product_id = ? AND warehouse_stock_variant_id = ?", m.StockMovementWarehouseId, m.StockMovementProductId, m.StockMovementVariantId).
+		Pluck("warehouse_stock_qty", &stocks).Error; err != nil {
+		return 0, err
+	}
+	if len(stocks) == 0 {
+		return 0, nil
+	}
+	return stocks[0], nil
+}
+
+// the default warehouse when the movement has none
+func (m *StockMovement) resolveWarehouse(tx *gorm.DB) error {
+	if m.StockMovementWarehouseId > 0 {
+		return nil
+	}
+
+	warehouseId, err := defaultWarehouseId(tx)
+	if err != nil {
+		return err
+	}
+	m.StockMovementWarehouseId = warehouseId
+	return nil
+}
+
+// change the stock by the delta of the movement and keep the balances it leaves, the movement still has to be created.
+// A transfer only moves stock between warehouses, the stock of the product or variant stays the same.
+func applyStockMovement(tx *gorm.DB, m *StockMovement) error {
+	if err := m.resolveWarehouse(tx); err != nil {
+		return err
+	}
+
+	stock := WarehouseStock{
+		WarehouseStockWarehouseId: m.StockMovementWarehouseId,
+		WarehouseStockProductId:   m.StockMovementProductId,
+		WarehouseStockVariantId:   m.StockMovementVariantId,
+		WarehouseStockQty:         m.StockMovementDelta,
+	}
+	if err := tx.Clauses(clause.OnConflict{
+		DoUpdates: clause.Assignments(map[string]interface{}{"warehouse_stock_qty": gorm.Expr("warehouse_stock_qty + ?", m.StockMovementDelta)}),
+	}).Omit(clause.Associations).Create(&stock).Error; err != nil {
+		return err
+	}
+
+	warehouseBalance, err := m.currentWarehouseStock(tx)
+	if err != nil {
+		return err
+	}
+	m.StockMovementWarehouseBalance = warehouseBalance
+
+	if m.StockMovementReason != StockReasonTransfer {
+		column := m.stockColumn()
+		if err := m.stockOf(tx).Update(column, gorm.Expr(column+" + ?", m.StockMovementDelta)).Error; err != nil {
+			return err
+		}
+	}
+
+	balance, err := m.currentStock(tx)
+	if err != nil {
+		return err
+	}
+	m.StockMovementBalance = balance
+
+	if m.StockMovementReason == StockReasonTransfer {
+		return nil
+	}
+	return checkStockAlert(tx, m.StockMovementProductId, m.StockMovementVariantId, balance)
+}
+
+// change the stock and write the movement to the ledger, nothing is written when the stock doesn't change
+func moveStock(tx *gorm.DB, m *StockMovement) error {
+	if m.StockMovementDelta == 0 {
+		return nil
+	}
+
+	if err := applyStockMovement(tx, m); err != nil {
+		return err
+	}
+	return tx.Create(m).Error
+}
+
+// record the stock a product or variant was created with, it is put in the default warehouse and checked against
+// the reorder point
+func openStock(tx *gorm.DB, productId, variantId, qty int) error {
+	if qty == 0 {
+		return checkStockAlert(tx, productId, variantId, qty)
+	}
+
+	m := StockMovement{
+		StockMovementProductId:        productId,
+		StockMovementVariantId:        variantId,
+		StockMovementDelta:            qty,
+		StockMovementBalance:          qty,
+		StockMovementWarehouseBalance: qty,
+		StockMovementReason:           StockReasonAdjustment,
+		StockMovementNote:             "opening stock",
+	}
+	if err := m.resolveWarehouse(tx); err != nil {
+		return err
+	}
+
+	if err := tx.Create(&WarehouseStock{
+		WarehouseStockWarehouseId: m.StockMovementWarehouseId,
+		WarehouseStockProductId:   productId,
+		WarehouseStockVariantId:   variantId,
+		WarehouseStockQty:         qty,
+	}).Error; err != nil {
+		return err
+	}
+	if err := tx.Create(&m).Error; err != nil {
+		return err
+	}
+	return checkStockAlert(tx, productId, variantId, qty)
+}
+
+// start the ledger of products and variants that had stock before it existed
+func BackfillStockMovements(db *gorm.DB) error {
+	if err := db.Exec(`INSERT INTO stock_movements (created_at, stock_movement_product_id, stock_movement_variant_id, stock_movement_delta, stock_movement_balance, stock_movement_reason, stock_movement_note)
+		SELECT NOW(), p.id, 0, p.product_stock, p.product_stock, ?, ?
+		FROM products p
+		WHERE p.deleted_at IS NULL AND p.product_stock <> 0 AND NOT EXISTS (SELECT 1 FROM stock_movements m WHERE m.stock_movement_product_id = p.id AND m.stock_movement_variant_id = 0)`,
+		StockReasonAdjustment, "opening balance").Error; err != nil {
+		return err
+	}
+
+	return db.Exec(`INSERT INTO stock_movements (created_at, stock_movement_product_id, stock_movement_variant_id, stock_movement_delta, stock_movement_balance, stock_movement_reason, stock_movement_note)
+		SELECT NOW(), v.product_variant_product_id, v.id, v.product_variant_stock, v.product_variant_stock, ?, ?
+		FROM product_variants v
+		WHERE v.deleted_at IS NULL AND v.product_variant_stock <> 0 AND NOT EXISTS (SELECT 1 FROM stock_movements m WHERE m.stock_movement_variant_id = v.id)`,
+		StockReasonAdjustment, "opening balance").Error
+}
+
+// add the delta of the movement to the stock in its warehouse, the stock there can't end below zero
+func AdjustStock(db *gorm.DB, m *StockMovement) (err error) {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if _, err := m.currentStock(tx); err != nil {
+			return err
+		}
+
+		if err := m.resolveWarehouse(tx); err != nil {
+			return err
+		}
+
+		current, err := m.currentWarehouseStock(tx)
+		if err != nil {
+			return err
+		}
+
+		if current+m.StockMovementDelta < 0 {
+			return ErrStockNegative
+		}
+
+		return moveStock(tx, m)
+	})
+}
+
+// set the stock in the warehouse of the movement to the counted quantity, the difference is recorded as a stock take
+func CountStock(db *gorm.DB, m *StockMovement, counted int) (err error) {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if _, err := m.currentStock(tx); err != nil {
+			return err
+		}
+
+		if err := m.resolveWarehouse(tx); err != nil {
+			return err
+		}
+
+		current, err := m.currentWarehouseStock(tx)
+		if err != nil {
+			return err
+		}
+
+		m.StockMovementReason = StockReasonStockTake
+		m.StockMovementDelta = counted - current
+		return moveStock(tx, m)
+	})
+}
+
+// movements of the product, of one of its variants when variantId isn't 0 and in one warehouse when warehouseId
+// isn't 0, the latest first
+func (m *StockMovement) GetStockMovementsPaginate(db *gorm.DB, productId, variantId, warehouseId int, page, pageSize int) ([]StockMovement, int, error) {
+	var movements []StockMovement
+	var count int64
+
+	filter := func(db *gorm.DB) *gorm.DB {
+		db = db.Where("stock_movement_product_id = ?", productId)
+		if variantId > 0 {
+			db = db.Where("stock_movement_variant_id = ?", variantId)
+		}
+		if warehouseId > 0 {
+			db = db.Where("stock_movement_warehouse_id = ?", warehouseId)
+		}
+		return db
+	}
+
+	// Count total records
+	if err := filter(db.Model(&StockMovement{})).Count(&count).Error; err != nil {
+		return nil, 0, err
+	}
+
+	// Calculate total pages
+	totalPages := (int(count) + pageSize - 1) / pageSize
+
+	// Paginate and sort
+	if err := filter(db).Order("id desc").Offset((page - 1) * pageSize).Limit(pageSize).Find(&movements).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return movements, totalPages, nil
+}
+
+// stock of the product, or of its variant when variantId isn't 0, at the time. The stock is the one in the
+// warehouse when warehouseId isn't 0
+func GetStockAt(db *gorm.DB, productId, variantId, warehouseId int, at time.Time) (int, error) {
+	m := StockMovement{}
+
+	query := db.Where("stock_movement_product_id = ? AND stock_movement_variant_id = ? AND created_at <= ?", productId, variantId, at)
+	if warehouseId > 0 {
+		query = query.Where("stock_movement_warehouse_id = ?", warehouseId)
+	}
+
+	err := query.Order("id desc").First(&m).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if warehouseId > 0 {
+		return m.StockMovementWarehouseBalance, nil
+	}
+	return m.StockMovementBalance, nil
+}
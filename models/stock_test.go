@@ -0,0 +1,113 @@
+package models
+
+import (
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// fake database summing the backorders of the product to the given quantity
+func backorderedDb(t *testing.T, backordered int64) (*gorm.DB, *fakeDb) {
+	return newFakeDb(t, func(query string) ([]string, [][]driver.Value) {
+		return []string{"backordered"}, [][]driver.Value{{backordered}}
+	})
+}
+
+func TestStockShortage(t *testing.T) {
+	tests := []struct {
+		name        string
+		product     Product
+		stock       int
+		qty         int
+		backordered int64
+		want        int
+		err         error
+	}{
+		{"in stock", Product{}, 5, 5, 0, 0, nil},
+		{"short, no backorder", Product{}, 3, 5, 0, 0, ErrInsufficientStock},
+		{"backordered", Product{ProductBackorderable: true}, 3, 5, 0, 2, nil},
+		{"preordered", Product{ProductPreorderable: true}, 0, 5, 0, 5, nil},
+		{"negative stock", Product{ProductBackorderable: true}, -2, 5, 0, 5, nil},
+		{"up to the limit", Product{ProductBackorderable: true, ProductBackorderLimit: 5}, 0, 2, 3, 2, nil},
+		{"over the limit", Product{ProductBackorderable: true, ProductBackorderLimit: 5}, 0, 3, 3, 0, ErrInsufficientStock},
+	}
+
+	for _, tt := range tests {
+		db, _ := backorderedDb(t, tt.backordered)
+
+		got, err := tt.product.stockShortage(db, tt.stock, tt.qty, 0)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, tt.err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: shortage = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+// an order line already backordered up to the limit is allocated again without counting its own backorder
+func TestStockShortageLineAtBackorderLimit(t *testing.T) {
+	p := Product{ProductBackorderable: true, ProductBackorderLimit: 5}
+	p.ID = 3
+
+	// the other lines hold nothing, the line itself holds the 5 the limit allows
+	db, fake := newFakeDb(t, func(query string) ([]string, [][]driver.Value) {
+		if strings.Contains(query, "order_lines.id <> ?") {
+			return []string{"backordered"}, [][]driver.Value{{int64(0)}}
+		}
+		return []string{"backordered"}, [][]driver.Value{{int64(5)}}
+	})
+
+	const lineId = 7
+	shortage, err := p.stockShortage(db, 0, 5, lineId)
+	if err != nil {
+		t.Fatalf("line at the backorder limit: %v", err)
+	}
+	if shortage != 5 {
+		t.Errorf("shortage = %d, want 5", shortage)
+	}
+
+	last := fake.last()
+	if !strings.Contains(last.SQL, "order_lines.order_line_product_id = ? AND order_lines.id <> ?") {
+		t.Errorf("backorder sum %q doesn't leave out the line", last.SQL)
+	}
+
+	found := false
+	for _, v := range last.Args {
+		if v == int64(lineId) {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("backorder sum vars %v don't hold the line id %d", last.Args, lineId)
+	}
+}
+
+// a ledger holding more for the line than it has allocated is an error, not clamped
+func TestReleaseStockLedgerTooHigh(t *testing.T) {
+	db, _ := newFakeDb(t, func(query string) ([]string, [][]driver.Value) {
+		return []string{"warehouse_id", "qty"}, [][]driver.Value{{int64(1), int64(4)}, {int64(2), int64(1)}}
+	})
+
+	tests := []struct {
+		name    string
+		line    OrderLine
+		tooHigh bool
+	}{
+		{"allocated less", OrderLine{OrderLineQty: 3}, true},
+		{"backordered part", OrderLine{OrderLineQty: 5, OrderLineBackorderedQty: 1}, true},
+		{"all allocated", OrderLine{OrderLineQty: 5}, false},
+		{"shipped part", OrderLine{OrderLineQty: 5, OrderLineShippedQty: 2}, false},
+	}
+
+	for _, tt := range tests {
+		tt.line.ID = 9
+		if err := releaseStock(db, tt.line); errors.Is(err, ErrStockLedgerTooHigh) != tt.tooHigh {
+			t.Errorf("%s: error = %v", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package models
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	SubscriptionStatusActive    = "active"
+	SubscriptionStatusPaused    = "paused"
+	SubscriptionStatusCancelled = "cancelled"
+
+	SubscriptionIntervalDay   = "day"
+	SubscriptionIntervalWeek  = "week"
+	SubscriptionIntervalMonth = "month"
+
+	SubscriptionRunCreated = "created"
+	SubscriptionRunFailed  = "failed"
+	SubscriptionRunSkipped = "skipped"
+)
+
+var (
+	ErrSubscriptionNotActive = errors.New("subscription is not active")
+	ErrSubscriptionNotPaused = errors.New("subscription is not paused")
+	ErrSubscriptionCancelled = errors.New("subscription is cancelled")
+)
+
+// Subscription places the same order for a customer at every interval
+type Subscription struct {
+	gorm.Model
+	SubscriptionCustomerId      int                `gorm:"type:bigint unsigned;not null;index" json:"subscription_customer_id"`
+	SubscriptionSupplierId      int                `gorm:"type:bigint unsigned;not null;index" json:"subscription_supplier_id"`
+	SubscriptionStatus          string             `gorm:"size:50;not null;default:active;index" json:"subscription_status"`
+	SubscriptionIntervalUnit    string             `gorm:"size:20;not null" json:"subscription_interval_unit"`
+	SubscriptionIntervalCount   int                `gorm:"not null;default:1" json:"subscription_interval_count"`
+	SubscriptionNextRunAt       time.Time          `gorm:"not null;index" json:"subscription_next_run_at"`
+	SubscriptionLastRunAt       *time.Time         `json:"subscription_last_run_at"`
+	SubscriptionCouponCode      string             `gorm:"size:64" json:"subscription_coupon_code"`
+	SubscriptionShippingAddress Address            `gorm:"embedded;embeddedPrefix:subscription_shipping_" json:"subscription_shipping_address"`
+	SubscriptionItems           []SubscriptionItem `gorm:"foreignKey:SubscriptionItemSubscriptionId" json:"subscription_items"`
+}
+
+type SubscriptionItem struct {
+	gorm.Model
+	SubscriptionItemSubscriptionId int `gorm:"type:bigint unsigned;not null;index" json:"subscription_item_subscription_id"`
+	SubscriptionItemProductId      int `gorm:"not null" json:"subscription_item_product_id"`
+	SubscriptionItemVariantId      int `gorm:"not null;default:0" json:"subscription_item_variant_id"`
+	SubscriptionItemQty            int `gorm:"not null" json:"subscription_item_qty"`
+}
+
+// SubscriptionRun records every generation, failed ones keep the reason
+type SubscriptionRun struct {
+	gorm.Model
+	SubscriptionRunSubscriptionId int       `gorm:"not null;index" json:"subscription_run_subscription_id"`
+	SubscriptionRunScheduledAt    time.Time `gorm:"not null" json:"subscription_run_scheduled_at"`
+	SubscriptionRunStatus         string    `gorm:"size:20;not null" json:"subscription_run_status"`
+	SubscriptionRunOrderId        int       `gorm:"not null;default:0" json:"subscription_run_order_id"`
+	SubscriptionRunError          string    `gorm:"size:255" json:"subscription_run_error"`
+}
+
+// time of the run after the given one
+func (s *Subscription) nextRun(after time.Time) time.Time {
+	count := s.SubscriptionIntervalCount
+	if count <= 0 {
+		count = 1
+	}
+
+	switch s.SubscriptionIntervalUnit {
+	case SubscriptionIntervalDay:
+		return after.AddDate(0, 0, count)
+	case SubscriptionIntervalMonth:
+		return after.AddDate(0, count, 0)
+	}
+	return after.AddDate(0, 0, 7*count)
+}
+
+func CreateSubscription(db *gorm.DB, Subscription *Subscription) (err error) {
+	err = db.Create(Subscription).Error
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// get subscriptions of a customer
+func GetSubscriptionsByCustomer(db *gorm.DB, Subscriptions *[]Subscription, customerId int) (err error) {
+	err = db.Preload("SubscriptionItems").Where("subscription_customer_id = ?", customerId).Order("id asc").Find(Subscriptions).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// get subscription by id, only when it belongs to the customer
+func GetSubscriptionById(db *gorm.DB, Subscription *Subscription, id, customerId int) (err error) {
+	err = db.Preload("SubscriptionItems").Where("id = ? AND subscription_customer_id = ?", id, customerId).First(Subscription).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// update the given columns of the Subscription schedule and address, the items are replaced when new ones are
+// given. The row is locked first so a status change or a run in between isn't overwritten.
+func UpdateSubscription(db *gorm.DB, subscription *Subscription, columns []string, items []SubscriptionItem) (err error) {
+	return db.Transaction(func(tx *gorm.DB) error {
+		stored := Subscription{}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", subscription.ID).First(&stored).Error; err != nil {
+			return err
+		}
+
+		if stored.SubscriptionStatus == SubscriptionStatusCancelled {
+			return ErrSubscriptionCancelled
+		}
+
+		if items != nil {
+			if err := tx.Unscoped().Where("subscription_item_subscription_id = ?", subscription.ID).Delete(&SubscriptionItem{}).Error; err != nil {
+				return err
+			}
+
+			for i := range items {
+				items[i].SubscriptionItemSubscriptionId = int(subscription.ID)
+			}
+			if err := tx.Create(&items).Error; err != nil {
+				return err
+			}
+		}
+
+		if len(columns) > 0 {
+			if err := tx.Model(&stored).Select(columns).Updates(subscription).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Preload("SubscriptionItems").Where("id = ?", subscription.ID).First(subscription).Error
+	})
+}
+
+// change the status of the subscription when it is in one of the statuses
+func setSubscriptionStatus(db *gorm.DB, subscription *Subscription, status string, from string, fromErr error) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", subscription.ID).First(subscription).Error; err != nil {
+			return err
+		}
+
+		if subscription.SubscriptionStatus == SubscriptionStatusCancelled {
+			return ErrSubscriptionCancelled
+		}
+		if from != "" && subscription.SubscriptionStatus != from {
+			return fromErr
+		}
+
+		subscription.SubscriptionStatus = status
+
+		// a resumed subscription doesn't catch up on the runs it missed
+		if status == SubscriptionStatusActive {
+			now := time.Now()
+			for !subscription.SubscriptionNextRunAt.After(now) {
+				subscription.SubscriptionNextRunAt = subscription.nextRun(subscription.SubscriptionNextRunAt)
+			}
+		}
+
+		return tx.Model(subscription).Updates(map[string]interface{}{"subscription_status": status, "subscription_next_run_at": subscription.SubscriptionNextRunAt}).Error
+	})
+}
+
+func PauseSubscription(db *gorm.DB, subscription *Subscription) (err error) {
+	return setSubscriptionStatus(db, subscription, SubscriptionStatusPaused, SubscriptionStatusActive, ErrSubscriptionNotActive)
+}
+
+func ResumeSubscription(db *gorm.DB, subscription *Subscription) (err error) {
+	return setSubscriptionStatus(db, subscription, SubscriptionStatusActive, SubscriptionStatusPaused, ErrSubscriptionNotPaused)
+}
+
+func CancelSubscription(db *gorm.DB, subscription *Subscription) (err error) {
+	return setSubscriptionStatus(db, subscription, SubscriptionStatusCancelled, "", nil)
+}
+
+// skip the next run, it is recorded as skipped
+func SkipSubscription(db *gorm.DB, subscription *Subscription) (err error) {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", subscription.ID).First(subscription).Error; err != nil {
+			return err
+		}
+
+		if subscription.SubscriptionStatus != SubscriptionStatusActive {
+			return ErrSubscriptionNotActive
+		}
+
+		run := SubscriptionRun{
+			SubscriptionRunSubscriptionId: int(subscription.ID),
+			SubscriptionRunScheduledAt:    subscription.SubscriptionNextRunAt,
+			SubscriptionRunStatus:         SubscriptionRunSkipped,
+		}
+		if err := tx.Create(&run).Error; err != nil {
+			return err
+		}
+
+		subscription.SubscriptionNextRunAt = subscription.nextRun(subscription.SubscriptionNextRunAt)
+
+		return tx.Model(subscription).Update("subscription_next_run_at", subscription.SubscriptionNextRunAt).Error
+	})
+}
+
+// get runs of a subscription, latest first
+func GetSubscriptionRuns(db *gorm.DB, SubscriptionRuns *[]SubscriptionRun, subscriptionId int) (err error) {
+	err = db.Where("subscription_run_subscription_id = ?", subscriptionId).Order("id desc").Find(SubscriptionRuns).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// place the order of the subscription through the order pipeline
+func placeSubscriptionOrder(tx *gorm.DB, subscription *Subscription) (Order, error) {
+	o := Order{
+		OrderCustomerId:      subscription.SubscriptionCustomerId,
+		OrderSupplierId:      subscription.SubscriptionSupplierId,
+		OrderStatus:          OrderStatusPending,
+		OrderShippingAddress: subscription.SubscriptionShippingAddress,
+	}
+
+	for _, item := range subscription.SubscriptionItems {
+		p := Product{}
+		if err := tx.Where("id = ?", item.SubscriptionItemProductId).First(&p).Error; err != nil {
+			return o, err
+		}
+
+		variant, err := ResolveProductVariant(tx, p, item.SubscriptionItemVariantId)
+		if err != nil {
+			return o, err
+		}
+
+		o.OrderQty += item.SubscriptionItemQty
+		o.OrderLines = append(o.OrderLines, NewVariantOrderLine(p, variant, item.SubscriptionItemQty))
+	}
+
+	if len(o.OrderLines) == 0 {
+		return o, errors.New("subscription has no items")
+	}
+	o.OrderProductId = o.OrderLines[0].OrderLineProductId
+
+	err := PlaceOrder(tx, &o, subscription.SubscriptionCouponCode)
+	return o, err
+}
+
+// generate the order of a due subscription, a failed generation is recorded and the schedule moves on
+func runSubscription(db *gorm.DB, id int, now time.Time) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		subscription := Subscription{}
+
+		// another instance running the scheduler skips what is already being generated
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).Preload("SubscriptionItems").
+			Where("id = ? AND subscription_status = ? AND subscription_next_run_at <= ?", id, SubscriptionStatusActive, now).First(&subscription).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		run := SubscriptionRun{
+			SubscriptionRunSubscriptionId: int(subscription.ID),
+			SubscriptionRunScheduledAt:    subscription.SubscriptionNextRunAt,
+			SubscriptionRunStatus:         SubscriptionRunCreated,
+		}
+
+		o, err := placeSubscriptionOrder(tx, &subscription)
+		if err != nil {
+			run.SubscriptionRunStatus = SubscriptionRunFailed
+			run.SubscriptionRunError = err.Error()
+			if len(run.SubscriptionRunError) > 255 {
+				run.SubscriptionRunError = run.SubscriptionRunError[:255]
+			}
+		} else {
+			run.SubscriptionRunOrderId = int(o.ID)
+		}
+
+		if err := tx.Create(&run).Error; err != nil {
+			return err
+		}
+
+		// runs missed while the scheduler was down are not generated twice
+		for !subscription.SubscriptionNextRunAt.After(now) {
+			subscription.SubscriptionNextRunAt = subscription.nextRun(subscription.SubscriptionNextRunAt)
+		}
+
+		return tx.Model(&subscription).Updates(map[string]interface{}{"subscription_next_run_at": subscription.SubscriptionNextRunAt, "subscription_last_run_at": now}).Error
+	})
+}
+
+// generate the orders of every active subscription whose next run has come
+func RunDueSubscriptions(db *gorm.DB, now time.Time) (err error) {
+	var ids []int
+	if err := db.Model(&Subscription{}).Where("subscription_status = ? AND subscription_next_run_at <= ?", SubscriptionStatusActive, now).Order("subscription_next_run_at asc").Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		// one failing subscription doesn't hold back the others, it is tried again on the next run
+		if err := runSubscription(db, id, now); err != nil {
+			log.Printf("subscription %d: %v", id, err)
+		}
+	}
+
+	return nil
+}
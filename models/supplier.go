@@ -1,18 +1,45 @@
 package models
 
 import (
+	"be-dbo-golang/utils/filter"
+	"be-dbo-golang/utils/pagination"
+
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
 type Supplier struct {
 	gorm.Model
-	SupplierName     string `gorm:"size:255;not null" json:"supplier_name"`
-	SupplierUsername string `gorm:"size:255;not null;unique" json:"supplier_username"`
-	SupplierEmail    string `gorm:"size:255;not null;unique" json:"supplier_email"`
-	SupplierPhone    string `gorm:"size:255;not null" json:"supplier_phone"`
-	SupplierPassword string `gorm:"size:255;not null" json:"supplier_password"`
-	SupplierAddress  string `json:"supplier_address"`
+	SupplierName             string `gorm:"size:255;not null" json:"supplier_name"`
+	SupplierUsername         string `gorm:"size:255;not null;unique" json:"supplier_username"`
+	SupplierEmail            string `gorm:"size:255;not null;unique" json:"supplier_email"`
+	SupplierPhone            string `gorm:"size:255;not null" json:"supplier_phone"`
+	SupplierPassword         string `gorm:"size:255;not null" json:"supplier_password"`
+	SupplierAddress          string `json:"supplier_address"`
+	SupplierPricesIncludeTax bool   `gorm:"not null;default:false" json:"supplier_prices_include_tax"`
+}
+
+// fields the supplier list can be filtered on
+var SupplierFilters = filter.Spec{
+	Fields: map[string]filter.Field{
+		"id":                 {Column: "id", Kind: filter.Int, Ops: filter.Comparable},
+		"name":               {Column: "supplier_name", Kind: filter.String, Ops: filter.Text},
+		"username":           {Column: "supplier_username", Kind: filter.String, Ops: filter.Text},
+		"email":              {Column: "supplier_email", Kind: filter.String, Ops: filter.Text},
+		"phone":              {Column: "supplier_phone", Kind: filter.String, Ops: filter.Text},
+		"prices_include_tax": {Column: "supplier_prices_include_tax", Kind: filter.Bool, Ops: []string{"eq"}},
+		"created_at":         {Column: "created_at", Kind: filter.Time, Ops: filter.Range},
+	},
+	Search: []string{"supplier_name", "supplier_username", "supplier_email", "supplier_phone"},
+}
+
+// fields the supplier list can be sorted by
+var SupplierSorts = pagination.Sortable{
+	"id":         "id",
+	"name":       "supplier_name",
+	"username":   "supplier_username",
+	"email":      "supplier_email",
+	"created_at": "created_at",
 }
 
 func CreateSupplier(db *gorm.DB, Supplier *Supplier) (err error) {
@@ -25,7 +52,7 @@ func CreateSupplier(db *gorm.DB, Supplier *Supplier) (err error) {
 	return nil
 }
 
-func (c *Supplier) GetSuppliersPaginate(db *gorm.DB, page, pageSize int, sortField, sortOrder string) ([]Supplier, int, error) {
+func (c *Supplier) GetSuppliersPaginate(db *gorm.DB, page, pageSize int, orderBy string) ([]Supplier, int, error) {
 	var customers []Supplier
 	var count int64
 
@@ -38,7 +65,7 @@ func (c *Supplier) GetSuppliersPaginate(db *gorm.DB, page, pageSize int, sortFie
 	totalPages := (int(count) + pageSize - 1) / pageSize
 
 	// Paginate and sort
-	if err := db.Order(sortField + " " + sortOrder).Offset((page - 1) * pageSize).Limit(pageSize).Find(&customers).Error; err != nil {
+	if err := db.Order(orderBy).Offset((page - 1) * pageSize).Limit(pageSize).Find(&customers).Error; err != nil {
 		return nil, 0, err
 	}
 
@@ -71,6 +98,15 @@ func UpdateSupplier(db *gorm.DB, Supplier *Supplier, id int) (err error) {
 	return nil
 }
 
+// switch the pricing mode, kept apart because Updates skips false
+func UpdateSupplierPricesIncludeTax(db *gorm.DB, Supplier *Supplier, id int) (err error) {
+	err = db.Model(Supplier).Where("id = ?", id).Update("supplier_prices_include_tax", Supplier.SupplierPricesIncludeTax).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 // delete Supplier
 func DeleteSupplier(db *gorm.DB, Supplier *Supplier, id int) (err error) {
 	db.Where("id = ?", id).Delete(Supplier)
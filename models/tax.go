@@ -0,0 +1,126 @@
+package models
+
+import (
+	"be-dbo-golang/utils/pagination"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const DefaultTaxCategory = "standard"
+
+// TaxRate applies to a single product or to every product of a tax category
+type TaxRate struct {
+	gorm.Model
+	TaxRateName          string     `gorm:"size:255;not null" json:"tax_rate_name"`
+	TaxRateCategory      string     `gorm:"size:100;index" json:"tax_rate_category"`
+	TaxRateProductId     int        `gorm:"not null;default:0;index" json:"tax_rate_product_id"`
+	TaxRatePercent       float64    `gorm:"not null" json:"tax_rate_percent"`
+	TaxRateEffectiveFrom time.Time  `gorm:"not null" json:"tax_rate_effective_from"`
+	TaxRateEffectiveTo   *time.Time `json:"tax_rate_effective_to"`
+}
+
+// fields the tax rate list can be sorted by
+var TaxRateSorts = pagination.Sortable{
+	"id":             "id",
+	"name":           "tax_rate_name",
+	"category":       "tax_rate_category",
+	"percent":        "tax_rate_percent",
+	"effective_from": "tax_rate_effective_from",
+	"created_at":     "created_at",
+}
+
+func CreateTaxRate(db *gorm.DB, TaxRate *TaxRate) (err error) {
+	err = db.Create(TaxRate).Error
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (t *TaxRate) GetTaxRatesPaginate(db *gorm.DB, page, pageSize int, orderBy string) ([]TaxRate, int, error) {
+	var taxRates []TaxRate
+	var count int64
+
+	// Count total records
+	if err := db.Model(&TaxRate{}).Count(&count).Error; err != nil {
+		return nil, 0, err
+	}
+
+	// Calculate total pages
+	totalPages := (int(count) + pageSize - 1) / pageSize
+
+	// Paginate and sort
+	if err := db.Order(orderBy).Offset((page - 1) * pageSize).Limit(pageSize).Find(&taxRates).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return taxRates, totalPages, nil
+}
+
+// get TaxRate by id
+func GetTaxRateById(db *gorm.DB, TaxRate *TaxRate, id int) (err error) {
+	err = db.Where("id = ?", id).First(TaxRate).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// update TaxRate
+func UpdateTaxRate(db *gorm.DB, TaxRate *TaxRate, id int) (err error) {
+	err = db.Where("id = ?", id).Updates(TaxRate).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// delete TaxRate
+func DeleteTaxRate(db *gorm.DB, TaxRate *TaxRate, id int) (err error) {
+	db.Where("id = ?", id).Delete(TaxRate)
+	return nil
+}
+
+// rate in percent for the product at the given time, a product rate wins over its category rate
+func GetEffectiveTaxPercent(db *gorm.DB, product Product, at time.Time) (float64, error) {
+	category := product.ProductTaxCategory
+	if category == "" {
+		category = DefaultTaxCategory
+	}
+
+	rate := TaxRate{}
+
+	err := db.Where("(tax_rate_product_id = ? OR (tax_rate_product_id = 0 AND tax_rate_category = ?)) AND tax_rate_effective_from <= ? AND (tax_rate_effective_to IS NULL OR tax_rate_effective_to > ?)", product.ID, category, at, at).
+		Order("tax_rate_product_id desc, tax_rate_effective_from desc").First(&rate).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return rate.TaxRatePercent, nil
+}
+
+// split the line amount after discount into net, tax and gross
+func (l *OrderLine) applyTax(percent float64, pricesIncludeTax bool) {
+	amount := l.OrderLineTotalAmount.Sub(l.OrderLineDiscountAmount)
+
+	l.OrderLineTaxPercent = percent
+
+	if pricesIncludeTax {
+		l.OrderLineGrossAmount = amount
+		l.OrderLineNetAmount = amount.ExcludePercent(percent)
+		l.OrderLineTaxAmount = l.OrderLineGrossAmount.Sub(l.OrderLineNetAmount)
+		return
+	}
+
+	l.OrderLineNetAmount = amount
+	l.OrderLineTaxAmount = amount.Percent(percent)
+	l.OrderLineGrossAmount = l.OrderLineNetAmount.Add(l.OrderLineTaxAmount)
+}
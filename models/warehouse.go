@@ -0,0 +1,326 @@
+package models
+
+import (
+	"be-dbo-golang/utils/pagination"
+	"errors"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// how order lines pick the warehouses they are allocated from
+const (
+	AllocationNearest   = "nearest"
+	AllocationMostStock = "most_stock"
+	AllocationPriority  = "priority"
+)
+
+// strategy used to allocate order lines, set from the configuration at startup
+var WarehouseAllocationStrategy = AllocationPriority
+
+var (
+	ErrNoWarehouse           = errors.New("no active warehouse")
+	ErrWarehouseCodeTaken    = errors.New("warehouse code is already used")
+	ErrWarehouseHasStock     = errors.New("warehouse still has stock")
+	ErrTransferSameWarehouse = errors.New("stock can't be transferred to the same warehouse")
+)
+
+// Warehouse is a location stock is kept in and shipped from, a lower priority is drawn from first
+type Warehouse struct {
+	gorm.Model
+	WarehouseName     string  `gorm:"size:255;not null" json:"warehouse_name"`
+	WarehouseCode     string  `gorm:"size:50;not null;uniqueIndex" json:"warehouse_code"`
+	WarehouseAddress  Address `gorm:"embedded;embeddedPrefix:warehouse_" json:"warehouse_address"`
+	WarehousePriority int     `gorm:"not null;default:0" json:"warehouse_priority"`
+	WarehouseIsActive bool    `gorm:"not null;default:true" json:"warehouse_is_active"`
+}
+
+// WarehouseStock is the stock of a product, or of one of its variants, in a warehouse.
+// The stock of the product or variant is the sum over its warehouses.
+type WarehouseStock struct {
+	ID                        uint      `gorm:"primarykey" json:"id"`
+	WarehouseStockWarehouseId int       `gorm:"type:bigint unsigned;not null;uniqueIndex:idx_warehouse_stock_item" json:"warehouse_stock_warehouse_id"`
+	WarehouseStockProductId   int       `gorm:"type:bigint unsigned;not null;uniqueIndex:idx_warehouse_stock_item;index" json:"warehouse_stock_product_id"`
+	WarehouseStockVariantId   int       `gorm:"not null;default:0;uniqueIndex:idx_warehouse_stock_item" json:"warehouse_stock_variant_id"`
+	WarehouseStockQty         int       `gorm:"not null;default:0" json:"warehouse_stock_qty"`
+	WarehouseStockWarehouse   Warehouse `gorm:"foreignKey:WarehouseStockWarehouseId" json:"-"`
+}
+
+// WarehouseTransfer moves stock of a product or variant from one warehouse to another
+type WarehouseTransfer struct {
+	gorm.Model
+	WarehouseTransferFromId    int    `gorm:"type:bigint unsigned;not null;index" json:"warehouse_transfer_from_id"`
+	WarehouseTransferToId      int    `gorm:"type:bigint unsigned;not null;index" json:"warehouse_transfer_to_id"`
+	WarehouseTransferProductId int    `gorm:"type:bigint unsigned;not null;index" json:"warehouse_transfer_product_id"`
+	WarehouseTransferVariantId int    `gorm:"not null;default:0" json:"warehouse_transfer_variant_id"`
+	WarehouseTransferQty       int    `gorm:"not null" json:"warehouse_transfer_qty"`
+	WarehouseTransferActorId   int    `gorm:"not null;default:0" json:"warehouse_transfer_actor_id"`
+	WarehouseTransferActorRole string `gorm:"size:20" json:"warehouse_transfer_actor_role"`
+	WarehouseTransferNote      string `gorm:"size:255" json:"warehouse_transfer_note"`
+}
+
+// fields the warehouse list can be sorted by
+var WarehouseSorts = pagination.Sortable{
+	"id":       "id",
+	"name":     "warehouse_name",
+	"code":     "warehouse_code",
+	"priority": "warehouse_priority",
+}
+
+func checkWarehouseCode(tx *gorm.DB, warehouse *Warehouse) error {
+	var taken int64
+	if err := tx.Unscoped().Model(&Warehouse{}).Where("warehouse_code = ? AND id <> ?", warehouse.WarehouseCode, warehouse.ID).Count(&taken).Error; err != nil {
+		return err
+	}
+	if taken > 0 {
+		return ErrWarehouseCodeTaken
+	}
+	return nil
+}
+
+func CreateWarehouse(db *gorm.DB, warehouse *Warehouse) (err error) {
+	if err := checkWarehouseCode(db, warehouse); err != nil {
+		return err
+	}
+	return db.Create(warehouse).Error
+}
+
+func (w *Warehouse) GetWarehousesPaginate(db *gorm.DB, page, pageSize int, orderBy string) ([]Warehouse, int, error) {
+	var warehouses []Warehouse
+	var count int64
+
+	// Count total records
+	if err := db.Model(&Warehouse{}).Count(&count).Error; err != nil {
+		return nil, 0, err
+	}
+
+	// Calculate total pages
+	totalPages := (int(count) + pageSize - 1) / pageSize
+
+	// Paginate and sort
+	if err := db.Order(orderBy).Offset((page - 1) * pageSize).Limit(pageSize).Find(&warehouses).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return warehouses, totalPages, nil
+}
+
+// get Warehouse by id
+func GetWarehouseById(db *gorm.DB, Warehouse *Warehouse, id int) (err error) {
+	err = db.Where("id = ?", id).First(Warehouse).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// update Warehouse, the active flag included
+func UpdateWarehouse(db *gorm.DB, warehouse *Warehouse) (err error) {
+	if err := checkWarehouseCode(db, warehouse); err != nil {
+		return err
+	}
+	return db.Save(warehouse).Error
+}
+
+// delete Warehouse, only once its stock was moved out
+func DeleteWarehouse(db *gorm.DB, Warehouse *Warehouse, id int) (err error) {
+	var stocked int64
+	if err := db.Model(&WarehouseStock{}).Where("warehouse_stock_warehouse_id = ? AND warehouse_stock_qty <> 0", id).Count(&stocked).Error; err != nil {
+		return err
+	}
+	if stocked > 0 {
+		return ErrWarehouseHasStock
+	}
+
+	db.Where("id = ?", id).Delete(Warehouse)
+	return nil
+}
+
+// warehouse stock that has no warehouse given goes to, the active one with the lowest priority
+func defaultWarehouseId(tx *gorm.DB) (int, error) {
+	warehouse := Warehouse{}
+	err := tx.Where("warehouse_is_active = ?", true).Order("warehouse_priority asc, id asc").First(&warehouse).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, ErrNoWarehouse
+	}
+	if err != nil {
+		return 0, err
+	}
+	return int(warehouse.ID), nil
+}
+
+// put the existing stock in a first warehouse, so the stock of every product is split by warehouse
+func BackfillWarehouseStock(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&Warehouse{}).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			if err := tx.Create(&Warehouse{WarehouseName: "Main warehouse", WarehouseCode: "MAIN", WarehouseIsActive: true}).Error; err != nil {
+				return err
+			}
+		}
+
+		warehouseId, err := defaultWarehouseId(tx)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Exec(`INSERT INTO warehouse_stocks (warehouse_stock_warehouse_id, warehouse_stock_product_id, warehouse_stock_variant_id, warehouse_stock_qty)
+			SELECT ?, p.id, 0, p.product_stock FROM products p
+			WHERE p.deleted_at IS NULL AND p.product_stock <> 0 AND NOT EXISTS (SELECT 1 FROM warehouse_stocks s WHERE s.warehouse_stock_product_id = p.id AND s.warehouse_stock_variant_id = 0)`, warehouseId).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Exec(`INSERT INTO warehouse_stocks (warehouse_stock_warehouse_id, warehouse_stock_product_id, warehouse_stock_variant_id, warehouse_stock_qty)
+			SELECT ?, v.product_variant_product_id, v.id, v.product_variant_stock FROM product_variants v
+			WHERE v.deleted_at IS NULL AND v.product_variant_stock <> 0 AND NOT EXISTS (SELECT 1 FROM warehouse_stocks s WHERE s.warehouse_stock_variant_id = v.id)`, warehouseId).Error; err != nil {
+			return err
+		}
+
+		// movements from before warehouses existed happened in the first one
+		return tx.Model(&StockMovement{}).Where("stock_movement_warehouse_id = 0").
+			Updates(map[string]interface{}{"stock_movement_warehouse_id": warehouseId, "stock_movement_warehouse_balance": gorm.Expr("stock_movement_balance")}).Error
+	})
+}
+
+// how close the warehouse is to the address, the same postal code is closest and another country farthest
+func (w *Warehouse) closeness(to Address) int {
+	same := func(a, b string) bool {
+		return a != "" && strings.EqualFold(strings.TrimSpace(a), strings.TrimSpace(b))
+	}
+
+	if !same(w.WarehouseAddress.Country, to.Country) && to.Country != "" {
+		return 0
+	}
+	switch {
+	case same(w.WarehouseAddress.PostalCode, to.PostalCode):
+		return 4
+	case same(w.WarehouseAddress.City, to.City):
+		return 3
+	case same(w.WarehouseAddress.Province, to.Province):
+		return 2
+	}
+	return 1
+}
+
+// stock of the product or variant in the active warehouses, in the order the strategy draws from them
+func allocationOrder(tx *gorm.DB, productId, variantId int, to Address) ([]WarehouseStock, error) {
+	var stocks []WarehouseStock
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("WarehouseStockWarehouse").
+		Joins("JOIN warehouses ON warehouses.id = warehouse_stocks.warehouse_stock_warehouse_id AND warehouses.deleted_at IS NULL AND warehouses.warehouse_is_active = ?", true).
+		Where("warehouse_stock_product_id = ? AND warehouse_stock_variant_id = ? AND warehouse_stock_qty > 0", productId, variantId).
+		Find(&stocks).Error; err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(stocks, func(i, j int) bool {
+		a, b := stocks[i], stocks[j]
+
+		switch WarehouseAllocationStrategy {
+		case AllocationNearest:
+			if ca, cb := a.WarehouseStockWarehouse.closeness(to), b.WarehouseStockWarehouse.closeness(to); ca != cb {
+				return ca > cb
+			}
+		case AllocationMostStock:
+			if a.WarehouseStockQty != b.WarehouseStockQty {
+				return a.WarehouseStockQty > b.WarehouseStockQty
+			}
+		}
+
+		if a.WarehouseStockWarehouse.WarehousePriority != b.WarehouseStockWarehouse.WarehousePriority {
+			return a.WarehouseStockWarehouse.WarehousePriority < b.WarehouseStockWarehouse.WarehousePriority
+		}
+		return a.WarehouseStockWarehouseId < b.WarehouseStockWarehouseId
+	})
+
+	return stocks, nil
+}
+
+// take the quantity from the warehouses in the strategy order, a sale per warehouse drawn from.
+// The sales are applied to the stock but still have to be written to the ledger.
+func drawStock(tx *gorm.DB, stocks []WarehouseStock, sale StockMovement, qty int) ([]StockMovement, error) {
+	sales := []StockMovement{}
+
+	for _, stock := range stocks {
+		if qty <= 0 {
+			break
+		}
+
+		take := min(qty, stock.WarehouseStockQty)
+		qty -= take
+
+		m := sale
+		m.StockMovementWarehouseId = stock.WarehouseStockWarehouseId
+		m.StockMovementDelta = -take
+		if err := applyStockMovement(tx, &m); err != nil {
+			return nil, err
+		}
+		sales = append(sales, m)
+	}
+
+	return sales, nil
+}
+
+// move stock of the product or variant between two warehouses, the total stock stays the same
+func TransferStock(db *gorm.DB, transfer *WarehouseTransfer) (err error) {
+	if transfer.WarehouseTransferFromId == transfer.WarehouseTransferToId {
+		return ErrTransferSameWarehouse
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, id := range []int{transfer.WarehouseTransferFromId, transfer.WarehouseTransferToId} {
+			if err := tx.Where("id = ?", id).First(&Warehouse{}).Error; err != nil {
+				return err
+			}
+		}
+
+		out := StockMovement{
+			StockMovementProductId:     transfer.WarehouseTransferProductId,
+			StockMovementVariantId:     transfer.WarehouseTransferVariantId,
+			StockMovementWarehouseId:   transfer.WarehouseTransferFromId,
+			StockMovementDelta:         -transfer.WarehouseTransferQty,
+			StockMovementReason:        StockReasonTransfer,
+			StockMovementReferenceType: StockReferenceWarehouseTransfer,
+			StockMovementActorId:       transfer.WarehouseTransferActorId,
+			StockMovementActorRole:     transfer.WarehouseTransferActorRole,
+			StockMovementNote:          transfer.WarehouseTransferNote,
+		}
+
+		if _, err := out.currentStock(tx); err != nil {
+			return err
+		}
+
+		available, err := out.currentWarehouseStock(tx)
+		if err != nil {
+			return err
+		}
+		if available < transfer.WarehouseTransferQty {
+			return ErrStockNegative
+		}
+
+		if err := tx.Create(transfer).Error; err != nil {
+			return err
+		}
+
+		in := out
+		in.StockMovementWarehouseId = transfer.WarehouseTransferToId
+		in.StockMovementDelta = transfer.WarehouseTransferQty
+
+		for _, m := range []*StockMovement{&out, &in} {
+			m.StockMovementReferenceId = int(transfer.ID)
+			if err := moveStock(tx, m); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// stock of the product and its variants by warehouse
+func GetWarehouseStocks(db *gorm.DB, stocks *[]WarehouseStock, productId int) (err error) {
+	return db.Preload("WarehouseStockWarehouse").Where("warehouse_stock_product_id = ?", productId).Order("warehouse_stock_variant_id asc, warehouse_stock_warehouse_id asc").Find(stocks).Error
+}
@@ -11,15 +11,22 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+const (
+	RoleAdmin    = "admin"
+	RoleCustomer = "customer"
+	RoleSupplier = "supplier"
+)
+
 type JWTClaim struct {
 	Authorized bool
 	ID         int    `json:"id"`
 	Username   string `json:"username"`
 	Email      string `json:"email"`
+	Role       string `json:"role"`
 	jwt.StandardClaims
 }
 
-func GenerateToken(id int, email string, username string) (string, error) {
+func GenerateToken(id int, email string, username string, role string) (string, error) {
 
 	expirationTime, err := strconv.Atoi(os.Getenv("TOKEN_HOUR_LIFESPAN"))
 
@@ -32,6 +39,7 @@ func GenerateToken(id int, email string, username string) (string, error) {
 		ID:         id,
 		Email:      email,
 		Username:   username,
+		Role:       role,
 		StandardClaims: jwt.StandardClaims{
 			ExpiresAt: time.Now().Add(time.Hour * time.Duration(expirationTime)).Unix(),
 		},
@@ -45,6 +53,15 @@ func GenerateToken(id int, email string, username string) (string, error) {
 
 func TokenValidation(inputToken string) (int, string, error) {
 
+	claims, err := TokenClaims(inputToken)
+	if err != nil {
+		return 0, "", err
+	}
+	return claims.ID, claims.Email, nil
+}
+
+func TokenClaims(inputToken string) (*JWTClaim, error) {
+
 	token, err := jwt.ParseWithClaims(
 		inputToken,
 		&JWTClaim{},
@@ -54,18 +71,18 @@ func TokenValidation(inputToken string) (int, string, error) {
 	)
 	if err != nil {
 		err = errors.New("invalid access token")
-		return 0, "", err
+		return nil, err
 	}
 	claims, ok := token.Claims.(*JWTClaim)
 	if !ok {
 		err = errors.New("couldn't parse claims")
-		return 0, "", err
+		return nil, err
 	}
 	if claims.ExpiresAt < time.Now().Local().Unix() {
 		err = errors.New("token expired")
-		return 0, "", err
+		return nil, err
 	}
-	return claims.ID, claims.Email, nil
+	return claims, nil
 }
 
 func ExtractToken(c *gin.Context) string {
@@ -91,3 +108,15 @@ func ExtractTokenID(c *gin.Context) (int, string, error) {
 
 	return id, email, nil
 }
+
+func ExtractTokenClaims(c *gin.Context) (*JWTClaim, error) {
+
+	tokenString := ExtractToken(c)
+	claims, err := TokenClaims(tokenString)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,167 @@
+package export
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	CSV  = "csv"
+	XLSX = "xlsx"
+
+	CSVContentType  = "text/csv"
+	XLSXContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+)
+
+// export format asked by the format query parameter or the Accept header, empty for the JSON list
+func RequestedFormat(c *gin.Context) string {
+	switch strings.ToLower(c.Query("format")) {
+	case CSV:
+		return CSV
+	case XLSX:
+		return XLSX
+	}
+
+	accept := c.GetHeader("Accept")
+	switch {
+	case strings.Contains(accept, XLSXContentType):
+		return XLSX
+	case strings.Contains(accept, CSVContentType):
+		return CSV
+	}
+	return ""
+}
+
+// Writer writes one record per row
+type Writer interface {
+	Write(record []string) error
+	Close() error
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func NewCSVWriter(w io.Writer) Writer {
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+func (cw *csvWriter) Write(record []string) error {
+	return cw.w.Write(record)
+}
+
+func (cw *csvWriter) Close() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+// parts of a workbook with a single sheet, the sheet itself is streamed
+var xlsxParts = []struct{ name, body string }{
+	{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`},
+	{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+	{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Sheet1" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+	{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`},
+}
+
+type xlsxWriter struct {
+	zip   *zip.Writer
+	sheet io.Writer
+}
+
+// NewXLSXWriter writes a workbook with one sheet, every cell is stored as an inline string
+func NewXLSXWriter(w io.Writer) (Writer, error) {
+	z := zip.NewWriter(w)
+
+	for _, part := range xlsxParts {
+		f, err := z.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(f, part.body); err != nil {
+			return nil, err
+		}
+	}
+
+	sheet, err := z.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = io.WriteString(sheet, `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	if err != nil {
+		return nil, err
+	}
+
+	return &xlsxWriter{zip: z, sheet: sheet}, nil
+}
+
+func (xw *xlsxWriter) Write(record []string) error {
+	if _, err := io.WriteString(xw.sheet, "<row>"); err != nil {
+		return err
+	}
+
+	for _, value := range record {
+		if _, err := io.WriteString(xw.sheet, `<c t="inlineStr"><is><t xml:space="preserve">`); err != nil {
+			return err
+		}
+		if err := xml.EscapeText(xw.sheet, []byte(value)); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(xw.sheet, "</t></is></c>"); err != nil {
+			return err
+		}
+	}
+
+	_, err := io.WriteString(xw.sheet, "</row>")
+	return err
+}
+
+func (xw *xlsxWriter) Close() error {
+	if _, err := io.WriteString(xw.sheet, "</sheetData></worksheet>"); err != nil {
+		return err
+	}
+	return xw.zip.Close()
+}
+
+// Stream sends the rows as a file attachment, every row goes out as soon as it is produced
+func Stream(c *gin.Context, format, name string, header []string, rows func(write func(record []string) error) error) error {
+	var w Writer
+	var err error
+
+	switch format {
+	case XLSX:
+		c.Header("Content-Type", XLSXContentType)
+		c.Header("Content-Disposition", `attachment; filename="`+name+`.xlsx"`)
+		c.Status(http.StatusOK)
+		w, err = NewXLSXWriter(c.Writer)
+	default:
+		c.Header("Content-Type", CSVContentType+"; charset=utf-8")
+		c.Header("Content-Disposition", `attachment; filename="`+name+`.csv"`)
+		c.Status(http.StatusOK)
+		w = NewCSVWriter(c.Writer)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := w.Write(header); err != nil {
+		return err
+	}
+
+	if err := rows(w.Write); err != nil {
+		return err
+	}
+
+	return w.Close()
+}
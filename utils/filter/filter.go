@@ -0,0 +1,334 @@
+package filter
+
+import (
+	"be-dbo-golang/utils/money"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Kind is how the values of a field are read
+type Kind int
+
+const (
+	String Kind = iota
+	Int
+	Number
+	Bool
+	Time
+	// Money fields name the column prefix of an embedded money.Money, values are amounts in the
+	// default currency or followed by a currency code, e.g. "12.50 USD"
+	Money
+)
+
+// operators a field can allow
+var (
+	Equality   = []string{"eq", "ne", "in"}
+	Text       = []string{"eq", "ne", "in", "like"}
+	Comparable = []string{"eq", "ne", "gt", "gte", "lt", "lte", "in", "between"}
+	Amount     = []string{"eq", "ne", "gt", "gte", "lt", "lte", "between"}
+	Range      = []string{"gt", "gte", "lt", "lte", "between"}
+)
+
+// query parameters of the listings that aren't filters
+var reserved = map[string]bool{"page": true, "page_size": true, "sort_by": true, "sort_order": true, "sort": true, "format": true, "q": true}
+
+// most values an in filter takes
+const maxValues = 100
+
+// Field is a filterable field of a resource, the query name maps to the column
+type Field struct {
+	Column string
+	Kind   Kind
+	Ops    []string
+}
+
+// Spec is what a resource can be filtered on, q matches the search columns with LIKE
+type Spec struct {
+	Fields map[string]Field
+	Search []string
+}
+
+type condition struct {
+	query string
+	args  []interface{}
+}
+
+// Filter is a parsed set of conditions, all of them have to hold
+type Filter struct {
+	conditions []condition
+}
+
+// field[op]=value, a parameter without an operator is an eq
+var paramPattern = regexp.MustCompile(`^([a-z0-9_]+)(?:\[([a-z]+)\])?$`)
+
+// read the filters of the query, fields and operators outside the spec are an error
+func Parse(query url.Values, spec Spec) (Filter, error) {
+	var f Filter
+
+	// sorted so the same filters always make the same statement
+	keys := []string{}
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		values := query[key]
+		if reserved[key] {
+			continue
+		}
+
+		match := paramPattern.FindStringSubmatch(key)
+		if match == nil {
+			return f, fmt.Errorf("unknown filter %q", key)
+		}
+
+		name, op := match[1], match[2]
+		if op == "" {
+			op = "eq"
+		}
+
+		field, ok := spec.Fields[name]
+		if !ok {
+			return f, fmt.Errorf("unknown filter field %q", name)
+		}
+		if !allowed(field.Ops, op) {
+			return f, fmt.Errorf("%s can't be filtered with %s, allowed: %s", name, op, strings.Join(field.Ops, ", "))
+		}
+
+		for _, value := range values {
+			cond, err := field.condition(op, value)
+			if err != nil {
+				return f, fmt.Errorf("%s[%s]: %v", name, op, err)
+			}
+			f.conditions = append(f.conditions, cond)
+		}
+	}
+
+	if q := strings.TrimSpace(query.Get("q")); q != "" && len(spec.Search) > 0 {
+		pattern := "%" + escapeLike(q) + "%"
+
+		clauses := []string{}
+		args := []interface{}{}
+		for _, column := range spec.Search {
+			clauses = append(clauses, column+" LIKE ?")
+			args = append(args, pattern)
+		}
+		f.conditions = append(f.conditions, condition{query: "(" + strings.Join(clauses, " OR ") + ")", args: args})
+	}
+
+	return f, nil
+}
+
+// the query narrowed by the filter, it can be used for several statements
+func (f Filter) Apply(db *gorm.DB) *gorm.DB {
+	for _, cond := range f.conditions {
+		db = db.Where(cond.query, cond.args...)
+	}
+	return db.Session(&gorm.Session{})
+}
+
+func allowed(ops []string, op string) bool {
+	for _, allowedOp := range ops {
+		if allowedOp == op {
+			return true
+		}
+	}
+	return false
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+func escapeLike(value string) string {
+	return likeEscaper.Replace(value)
+}
+
+var comparisons = map[string]string{"eq": "=", "ne": "<>", "gt": ">", "gte": ">=", "lt": "<", "lte": "<="}
+
+func (field Field) condition(op, value string) (condition, error) {
+	switch field.Kind {
+	case Time:
+		return field.timeCondition(op, value)
+	case Money:
+		return field.moneyCondition(op, value)
+	}
+
+	switch op {
+	case "like":
+		return condition{query: field.Column + " LIKE ?", args: []interface{}{"%" + escapeLike(value) + "%"}}, nil
+	case "in":
+		values, err := field.parseList(value)
+		if err != nil {
+			return condition{}, err
+		}
+		if len(values) > maxValues {
+			return condition{}, fmt.Errorf("at most %d values", maxValues)
+		}
+		return condition{query: field.Column + " IN ?", args: []interface{}{values}}, nil
+	case "between":
+		values, err := field.parseList(value)
+		if err != nil {
+			return condition{}, err
+		}
+		if len(values) != 2 {
+			return condition{}, fmt.Errorf("between takes two values separated by a comma")
+		}
+		return condition{query: field.Column + " BETWEEN ? AND ?", args: values}, nil
+	}
+
+	parsed, err := field.parse(value)
+	if err != nil {
+		return condition{}, err
+	}
+	return condition{query: field.Column + " " + comparisons[op] + " ?", args: []interface{}{parsed}}, nil
+}
+
+func (field Field) parseList(value string) ([]interface{}, error) {
+	values := []interface{}{}
+	for _, item := range strings.Split(value, ",") {
+		parsed, err := field.parse(strings.TrimSpace(item))
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, parsed)
+	}
+	return values, nil
+}
+
+func (field Field) parse(value string) (interface{}, error) {
+	switch field.Kind {
+	case Int:
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a whole number", value)
+		}
+		return parsed, nil
+	case Number:
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", value)
+		}
+		return parsed, nil
+	case Bool:
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not true or false", value)
+		}
+		return parsed, nil
+	}
+	return value, nil
+}
+
+// a date covers the whole day, so it is the start of the day as a lower bound and the start
+// of the next day as an upper one
+func parseTime(value string, upper bool) (time.Time, bool, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, false, nil
+	}
+
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return t, false, fmt.Errorf("%q must be a date (2006-01-02) or an RFC 3339 timestamp", value)
+	}
+	if upper {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, true, nil
+}
+
+func (field Field) timeCondition(op, value string) (condition, error) {
+	if op == "between" {
+		bounds := strings.Split(value, ",")
+		if len(bounds) != 2 {
+			return condition{}, fmt.Errorf("between takes two values separated by a comma")
+		}
+
+		from, _, err := parseTime(strings.TrimSpace(bounds[0]), false)
+		if err != nil {
+			return condition{}, err
+		}
+		to, date, err := parseTime(strings.TrimSpace(bounds[1]), true)
+		if err != nil {
+			return condition{}, err
+		}
+
+		if date {
+			return condition{query: field.Column + " >= ? AND " + field.Column + " < ?", args: []interface{}{from, to}}, nil
+		}
+		return condition{query: field.Column + " BETWEEN ? AND ?", args: []interface{}{from, to}}, nil
+	}
+
+	if comparisons[op] == "" {
+		return condition{}, fmt.Errorf("times can't be filtered with %s", op)
+	}
+
+	// after a day and up to a day mean from the next day on
+	upper := op == "gt" || op == "lte"
+	t, date, err := parseTime(value, upper)
+	if err != nil {
+		return condition{}, err
+	}
+
+	comparison := comparisons[op]
+	if date && upper {
+		comparison = map[string]string{"gt": ">=", "lte": "<"}[op]
+	}
+	return condition{query: field.Column + " " + comparison + " ?", args: []interface{}{t}}, nil
+}
+
+// amount in the default currency, or followed by its currency code
+func parseMoney(value string) (money.Money, error) {
+	amount, currency, found := strings.Cut(strings.TrimSpace(value), " ")
+	if !found {
+		currency = money.DefaultCurrency()
+	}
+
+	m, err := money.Parse(amount, strings.TrimSpace(currency))
+	if err != nil {
+		return m, fmt.Errorf("%q: %v", value, err)
+	}
+	return m, nil
+}
+
+func (field Field) moneyCondition(op, value string) (condition, error) {
+	minor := field.Column + "minor"
+	currency := field.Column + "currency"
+
+	if op == "between" {
+		bounds := strings.Split(value, ",")
+		if len(bounds) != 2 {
+			return condition{}, fmt.Errorf("between takes two values separated by a comma")
+		}
+
+		from, err := parseMoney(bounds[0])
+		if err != nil {
+			return condition{}, err
+		}
+		to, err := parseMoney(bounds[1])
+		if err != nil {
+			return condition{}, err
+		}
+		if !from.SameCurrency(to) {
+			return condition{}, money.ErrCurrencyMismatch
+		}
+
+		return condition{query: minor + " BETWEEN ? AND ? AND " + currency + " = ?", args: []interface{}{from.Minor, to.Minor, from.Currency}}, nil
+	}
+
+	if comparisons[op] == "" {
+		return condition{}, fmt.Errorf("amounts can't be filtered with %s", op)
+	}
+
+	m, err := parseMoney(value)
+	if err != nil {
+		return condition{}, err
+	}
+	return condition{query: minor + " " + comparisons[op] + " ? AND " + currency + " = ?", args: []interface{}{m.Minor, m.Currency}}, nil
+}
@@ -0,0 +1,119 @@
+package filter
+
+import (
+	"be-dbo-golang/utils/money"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testSpec = Spec{
+	Fields: map[string]Field{
+		"name":       {Column: "name", Kind: String, Ops: Text},
+		"brand_id":   {Column: "brand_id", Kind: Int, Ops: Equality},
+		"rating":     {Column: "rating", Kind: Number, Ops: Comparable},
+		"active":     {Column: "active", Kind: Bool, Ops: []string{"eq"}},
+		"created_at": {Column: "created_at", Kind: Time, Ops: Range},
+		"price":      {Column: "price_", Kind: Money, Ops: Amount},
+	},
+	Search: []string{"name", "description"},
+}
+
+func day(value string) time.Time {
+	t, _ := time.ParseInLocation("2006-01-02", value, time.Local)
+	return t
+}
+
+func TestParse(t *testing.T) {
+	t.Setenv("DEFAULT_CURRENCY", "USD")
+
+	tests := []struct {
+		query string
+		want  []condition
+	}{
+		{"", nil},
+		{"page=2&page_size=10&sort=name&format=csv", nil},
+		{"name=mug", []condition{{"name = ?", []interface{}{"mug"}}}},
+		{"name[like]=50%25_off", []condition{{"name LIKE ?", []interface{}{`%50\%\_off%`}}}},
+		{"brand_id[in]=1,%202", []condition{{"brand_id IN ?", []interface{}{[]interface{}{int64(1), int64(2)}}}}},
+		{"rating[between]=1.5,4", []condition{{"rating BETWEEN ? AND ?", []interface{}{1.5, 4.0}}}},
+		{"rating[gte]=3&rating[lt]=5", []condition{{"rating >= ?", []interface{}{3.0}}, {"rating < ?", []interface{}{5.0}}}},
+		{"active=true", []condition{{"active = ?", []interface{}{true}}}},
+		{"created_at[gte]=2024-03-01", []condition{{"created_at >= ?", []interface{}{day("2024-03-01")}}}},
+		{"created_at[lte]=2024-03-01", []condition{{"created_at < ?", []interface{}{day("2024-03-02")}}}},
+		{"created_at[gt]=2024-03-01", []condition{{"created_at >= ?", []interface{}{day("2024-03-02")}}}},
+		{"created_at[between]=2024-03-01,2024-03-31", []condition{{"created_at >= ? AND created_at < ?", []interface{}{day("2024-03-01"), day("2024-04-01")}}}},
+		{"created_at[gt]=2024-03-01T10:00:00Z", []condition{{"created_at > ?", []interface{}{time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)}}}},
+		{"price[lte]=12.50", []condition{{"price_minor <= ? AND price_currency = ?", []interface{}{int64(1250), "USD"}}}},
+		{"price[gt]=10%20EUR", []condition{{"price_minor > ? AND price_currency = ?", []interface{}{int64(1000), "EUR"}}}},
+		{"price[between]=1,2", []condition{{"price_minor BETWEEN ? AND ? AND price_currency = ?", []interface{}{int64(100), int64(200), "USD"}}}},
+		{"q=red%20mug", []condition{{"(name LIKE ? OR description LIKE ?)", []interface{}{"%red mug%", "%red mug%"}}}},
+		// the conditions follow the sorted parameter names
+		{"name=mug&brand_id=3", []condition{{"brand_id = ?", []interface{}{int64(3)}}, {"name = ?", []interface{}{"mug"}}}},
+	}
+
+	for _, tt := range tests {
+		query, err := url.ParseQuery(tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		f, err := Parse(query, testSpec)
+		if err != nil {
+			t.Errorf("Parse(%q) error = %v", tt.query, err)
+			continue
+		}
+		if !reflect.DeepEqual(f.conditions, tt.want) {
+			t.Errorf("Parse(%q) = %v, want %v", tt.query, f.conditions, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	t.Setenv("DEFAULT_CURRENCY", "USD")
+
+	tooMany := make([]string, maxValues+1)
+	for i := range tooMany {
+		tooMany[i] = "1"
+	}
+
+	tests := []struct {
+		query string
+		err   string
+	}{
+		{"colour=red", `unknown filter field "colour"`},
+		{"Name=mug", `unknown filter "Name"`},
+		{"name[regex]=m", "name can't be filtered with regex, allowed: eq, ne, in, like"},
+		{"brand_id[like]=1", "brand_id can't be filtered with like"},
+		{"created_at=2024-03-01", "created_at can't be filtered with eq"},
+		{"brand_id=one", `brand_id[eq]: "one" is not a whole number`},
+		{"rating=high", `rating[eq]: "high" is not a number`},
+		{"active=maybe", `active[eq]: "maybe" is not true or false`},
+		{"rating[between]=1", "between takes two values"},
+		{"created_at[gte]=yesterday", "must be a date (2006-01-02) or an RFC 3339 timestamp"},
+		{"brand_id[in]=" + strings.Join(tooMany, ","), "at most 100 values"},
+		{"price[in]=1", "price can't be filtered with in"},
+		{"price=abc", "price[eq]: "},
+		{"price[between]=1%20USD,2%20EUR", "price[between]: " + money.ErrCurrencyMismatch.Error()},
+	}
+
+	for _, tt := range tests {
+		query, err := url.ParseQuery(tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = Parse(query, testSpec)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("Parse(%q) error = %v, want %q", tt.query, err, tt.err)
+		}
+	}
+
+	// an in filter takes up to the cap
+	query := url.Values{"brand_id[in]": {strings.Join(tooMany[1:], ",")}}
+	if _, err := Parse(query, testSpec); err != nil {
+		t.Errorf("in with %d values: %v", maxValues, err)
+	}
+}
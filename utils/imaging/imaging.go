@@ -0,0 +1,111 @@
+package imaging
+
+import (
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// formats images are decoded from, gif is re-encoded as png
+var ContentTypes = map[string]string{
+	"image/jpeg": "jpeg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+}
+
+// largest side of the thumbnails to generate
+func ThumbnailSizes() []int {
+	sizes := []int{}
+	for _, value := range strings.Split(os.Getenv("PRODUCT_IMAGE_THUMBNAIL_SIZES"), ",") {
+		size, err := strconv.Atoi(strings.TrimSpace(value))
+		if err == nil && size > 0 {
+			sizes = append(sizes, size)
+		}
+	}
+
+	if len(sizes) == 0 {
+		sizes = []int{150, 600} // Default 150 and 600 pixels
+	}
+	return sizes
+}
+
+// Fit scales the image down to fit in a square of the size, keeping its aspect ratio.
+// Every pixel of the result is the average of the source pixels it covers.
+func Fit(src image.Image, size int) image.Image {
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w <= size && h <= size {
+		return src
+	}
+
+	dw, dh := size, h*size/w
+	if h > w {
+		dw, dh = w*size/h, size
+	}
+	if dw < 1 {
+		dw = 1
+	}
+	if dh < 1 {
+		dh = 1
+	}
+
+	in := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(in, in.Bounds(), src, bounds.Min, draw.Src)
+	out := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < dh; y++ {
+		y0, y1 := y*h/dh, (y+1)*h/dh
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+
+		for x := 0; x < dw; x++ {
+			x0, x1 := x*w/dw, (x+1)*w/dw
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			var sum [4]uint64
+			var n uint64
+			for sy := y0; sy < y1; sy++ {
+				offset := in.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					for i := 0; i < 4; i++ {
+						sum[i] += uint64(in.Pix[offset+i])
+					}
+					offset += 4
+					n++
+				}
+			}
+
+			offset := out.PixOffset(x, y)
+			for i := 0; i < 4; i++ {
+				out.Pix[offset+i] = uint8(sum[i] / n)
+			}
+		}
+	}
+
+	return out
+}
+
+// format a decoded image is written back in
+func OutputFormat(format string) string {
+	if format == "jpeg" {
+		return "jpeg"
+	}
+	return "png"
+}
+
+// write the image as jpeg or png
+func Encode(w io.Writer, img image.Image, format string) error {
+	if OutputFormat(format) == "jpeg" {
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: 85})
+	}
+	return png.Encode(w, img)
+}
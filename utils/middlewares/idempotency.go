@@ -0,0 +1,162 @@
+package middlewares
+
+import (
+	"be-dbo-golang/models"
+	"be-dbo-golang/utils/auth"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const IdempotencyHeader = "Idempotency-Key"
+
+// capture the response so it can be replayed for repeated requests
+type idempotencyWriter struct {
+	gin.ResponseWriter
+	body *bytes.Buffer
+}
+
+func (w idempotencyWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w idempotencyWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+func idempotencyLifespan() time.Duration {
+	lifespan, err := strconv.Atoi(os.Getenv("IDEMPOTENCY_KEY_HOUR_LIFESPAN"))
+	if err != nil || lifespan <= 0 {
+		lifespan = 24 // Default 24 hours
+	}
+	return time.Hour * time.Duration(lifespan)
+}
+
+// largest body buffered to hash it, in megabytes, handlers can still set a smaller limit of their own
+func idempotencyMaxBodySize() int64 {
+	size, err := strconv.Atoi(os.Getenv("IDEMPOTENCY_BODY_MAX_MB"))
+	if err != nil || size <= 0 {
+		size = 10 // Default 10 MB
+	}
+	return int64(size) << 20
+}
+
+func IdempotencyMiddleware(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyHeader)
+		if key == "" || c.Request.Method == http.MethodGet {
+			c.Next()
+			return
+		}
+
+		if len(key) > 255 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "idempotency key is too long"})
+			c.Abort()
+			return
+		}
+
+		payload, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, idempotencyMaxBodySize()))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("request body can't be larger than %d MB", tooLarge.Limit>>20)})
+				c.Abort()
+				return
+			}
+
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(payload))
+
+		hash := sha256.Sum256(payload)
+
+		// keys are scoped to the caller and the endpoint
+		id, email, _ := auth.ExtractTokenID(c)
+		scope := fmt.Sprintf("%s %s %d:%s", c.Request.Method, c.Request.URL.Path, id, email)
+
+		record := models.IdempotencyKey{
+			IdempotencyKey:       key,
+			IdempotencyScope:     scope,
+			IdempotencyHash:      hex.EncodeToString(hash[:]),
+			IdempotencyExpiresAt: time.Now().Add(idempotencyLifespan()),
+		}
+
+		if err := models.CreateIdempotencyKey(db, &record); err != nil {
+			existing := models.IdempotencyKey{}
+
+			if err := models.GetIdempotencyKey(db, &existing, key, scope); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				c.Abort()
+				return
+			}
+
+			if existing.IdempotencyExpiresAt.Before(time.Now()) {
+				// expired key, release it and process the request as a new one
+				if err := models.DeleteIdempotencyKey(db, &existing); err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+					c.Abort()
+					return
+				}
+
+				if err := models.CreateIdempotencyKey(db, &record); err != nil {
+					c.JSON(http.StatusConflict, gin.H{"error": "request with this idempotency key is still being processed"})
+					c.Abort()
+					return
+				}
+			} else {
+				if existing.IdempotencyHash != record.IdempotencyHash {
+					c.JSON(http.StatusConflict, gin.H{"error": "idempotency key was already used with a different payload"})
+					c.Abort()
+					return
+				}
+
+				if existing.IdempotencyStatusCode == 0 {
+					c.JSON(http.StatusConflict, gin.H{"error": "request with this idempotency key is still being processed"})
+					c.Abort()
+					return
+				}
+
+				c.Header("Idempotent-Replayed", "true")
+				c.Data(existing.IdempotencyStatusCode, "application/json; charset=utf-8", existing.IdempotencyBody)
+				c.Abort()
+				return
+			}
+		}
+
+		writer := idempotencyWriter{ResponseWriter: c.Writer, body: &bytes.Buffer{}}
+		c.Writer = writer
+
+		// a panicking handler releases the key before the panic goes on to the recovery middleware,
+		// otherwise every retry would be told the request is still being processed
+		defer func() {
+			if r := recover(); r != nil {
+				models.DeleteIdempotencyKey(db, &record)
+				panic(r)
+			}
+		}()
+
+		c.Next()
+
+		// server errors are not stored so the client can retry with the same key
+		if c.Writer.Status() >= http.StatusInternalServerError {
+			models.DeleteIdempotencyKey(db, &record)
+			return
+		}
+
+		models.CompleteIdempotencyKey(db, &record, c.Writer.Status(), writer.body.Bytes())
+	}
+}
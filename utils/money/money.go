@@ -0,0 +1,270 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Money is an exact amount in the minor unit of its ISO 4217 currency (cents for USD).
+// Every operation that can produce a fraction of a minor unit rounds half away from zero.
+type Money struct {
+	Minor    int64  `gorm:"not null;default:0" json:"-"`
+	Currency string `gorm:"size:3;not null;default:''" json:"-"`
+}
+
+var (
+	ErrInvalidAmount    = errors.New("invalid money amount")
+	ErrInvalidCurrency  = errors.New("invalid currency code")
+	ErrCurrencyMismatch = errors.New("amounts have different currencies")
+	ErrAmountOutOfRange = errors.New("money amount out of range")
+)
+
+// currencies that don't use two decimals
+var exponents = map[string]int{
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0, "KRW": 0,
+	"PYG": 0, "RWF": 0, "UGX": 0, "UYI": 0, "VND": 0, "VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+}
+
+// currency used for amounts sent without one
+func DefaultCurrency() string {
+	currency := strings.ToUpper(os.Getenv("DEFAULT_CURRENCY"))
+	if currency == "" {
+		currency = "IDR" // Default IDR
+	}
+	return currency
+}
+
+// number of decimals of the currency minor unit
+func Exponent(currency string) int {
+	if exponent, ok := exponents[currency]; ok {
+		return exponent
+	}
+	return 2
+}
+
+func validCurrency(currency string) bool {
+	if len(currency) != 3 {
+		return false
+	}
+	for _, r := range currency {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+func New(minor int64, currency string) Money {
+	return Money{Minor: minor, Currency: currency}
+}
+
+func Zero(currency string) Money {
+	return Money{Currency: currency}
+}
+
+// round a rational to an integer, halves away from zero
+func roundBig(r *big.Rat) *big.Int {
+	num := new(big.Int).Set(r.Num())
+	den := r.Denom()
+
+	negative := num.Sign() < 0
+	num.Abs(num)
+
+	quo, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	if rem.Mul(rem, big.NewInt(2)).Cmp(den) >= 0 {
+		quo.Add(quo, big.NewInt(1))
+	}
+
+	if negative {
+		quo.Neg(quo)
+	}
+	return quo
+}
+
+func roundRat(r *big.Rat) int64 {
+	return roundBig(r).Int64()
+}
+
+func scale(currency string) *big.Rat {
+	return new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(Exponent(currency))), nil))
+}
+
+// parse a decimal string such as "12.50" in the currency
+func Parse(amount, currency string) (Money, error) {
+	currency = strings.ToUpper(currency)
+	if !validCurrency(currency) {
+		return Money{}, ErrInvalidCurrency
+	}
+
+	value, ok := new(big.Rat).SetString(strings.TrimSpace(amount))
+	if !ok || strings.ContainsAny(amount, "/eE") {
+		return Money{}, ErrInvalidAmount
+	}
+
+	minor := roundBig(value.Mul(value, scale(currency)))
+	if !minor.IsInt64() {
+		return Money{}, ErrAmountOutOfRange
+	}
+
+	return Money{Minor: minor.Int64(), Currency: currency}, nil
+}
+
+// decimal string of the amount, with the currency number of decimals
+func (m Money) Amount() string {
+	exponent := Exponent(m.Currency)
+	value := new(big.Rat).SetFrac(big.NewInt(m.Minor), new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exponent)), nil))
+	return value.FloatString(exponent)
+}
+
+func (m Money) String() string {
+	return m.Amount() + " " + m.Currency
+}
+
+func (m Money) IsZero() bool {
+	return m.Minor == 0
+}
+
+func (m Money) IsNegative() bool {
+	return m.Minor < 0
+}
+
+func (m Money) SameCurrency(other Money) bool {
+	return m.Currency == other.Currency
+}
+
+func (m Money) mustMatch(other Money) {
+	if !m.SameCurrency(other) {
+		panic(fmt.Sprintf("money: %s and %s have different currencies", m, other))
+	}
+}
+
+// amounts must share the currency, mixing currencies is a programming error
+func (m Money) Add(other Money) Money {
+	m.mustMatch(other)
+	return Money{Minor: m.Minor + other.Minor, Currency: m.Currency}
+}
+
+func (m Money) Sub(other Money) Money {
+	m.mustMatch(other)
+	return Money{Minor: m.Minor - other.Minor, Currency: m.Currency}
+}
+
+func (m Money) Cmp(other Money) int {
+	m.mustMatch(other)
+	switch {
+	case m.Minor < other.Minor:
+		return -1
+	case m.Minor > other.Minor:
+		return 1
+	}
+	return 0
+}
+
+func (m Money) Min(other Money) Money {
+	if m.Cmp(other) <= 0 {
+		return m
+	}
+	return other
+}
+
+func (m Money) Mul(qty int64) Money {
+	return Money{Minor: m.Minor * qty, Currency: m.Currency}
+}
+
+// amount * num / den, rounded to the minor unit
+func (m Money) MulFrac(num, den int64) Money {
+	value := new(big.Rat).SetFrac(big.NewInt(m.Minor), big.NewInt(1))
+	value.Mul(value, big.NewRat(num, den))
+	return Money{Minor: roundRat(value), Currency: m.Currency}
+}
+
+// the percent is read as the decimal it was written as, 7.1 is exactly 71/10
+func percentRat(percent float64) *big.Rat {
+	value, _ := new(big.Rat).SetString(strconv.FormatFloat(percent, 'f', -1, 64))
+	return value.Quo(value, big.NewRat(100, 1))
+}
+
+// percent of the amount, rounded to the minor unit
+func (m Money) Percent(percent float64) Money {
+	value := new(big.Rat).SetFrac(big.NewInt(m.Minor), big.NewInt(1))
+	value.Mul(value, percentRat(percent))
+	return Money{Minor: roundRat(value), Currency: m.Currency}
+}
+
+// net part of a gross amount that includes the percent of tax
+func (m Money) ExcludePercent(percent float64) Money {
+	value := new(big.Rat).SetFrac(big.NewInt(m.Minor), big.NewInt(1))
+	value.Quo(value, new(big.Rat).Add(big.NewRat(1, 1), percentRat(percent)))
+	return Money{Minor: roundRat(value), Currency: m.Currency}
+}
+
+// split the amount by weights, the parts always add up to the amount
+func (m Money) Allocate(weights []int64) []Money {
+	parts := make([]Money, len(weights))
+
+	var total int64
+	for _, weight := range weights {
+		total += weight
+	}
+
+	remaining := m.Minor
+	for i, weight := range weights {
+		if i == len(weights)-1 || total == 0 {
+			parts[i] = Money{Minor: remaining, Currency: m.Currency}
+			remaining = 0
+			continue
+		}
+		share := m.MulFrac(weight, total)
+		parts[i] = share
+		remaining -= share.Minor
+	}
+
+	return parts
+}
+
+type moneyJSON struct {
+	Amount   json.RawMessage `json:"amount"`
+	Currency string          `json:"currency"`
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Amount   string `json:"amount"`
+		Currency string `json:"currency"`
+	}{m.Amount(), m.Currency})
+}
+
+// accepts {"amount": "12.50", "currency": "USD"}, or a bare number or string in the default currency
+func (m *Money) UnmarshalJSON(data []byte) error {
+	raw := strings.TrimSpace(string(data))
+	currency := DefaultCurrency()
+
+	if strings.HasPrefix(raw, "{") {
+		var value moneyJSON
+		if err := json.Unmarshal(data, &value); err != nil {
+			return err
+		}
+		if value.Currency != "" {
+			currency = value.Currency
+		}
+		raw = strings.TrimSpace(string(value.Amount))
+	}
+
+	if raw == "null" || raw == "" {
+		return nil
+	}
+
+	parsed, err := Parse(strings.Trim(raw, `"`), currency)
+	if err != nil {
+		return err
+	}
+
+	*m = parsed
+	return nil
+}
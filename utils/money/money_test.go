@@ -0,0 +1,185 @@
+package money
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		amount   string
+		currency string
+		want     Money
+		err      error
+	}{
+		{"12.50", "USD", New(1250, "USD"), nil},
+		{"12.5", "usd", New(1250, "USD"), nil},
+		{" 7 ", "USD", New(700, "USD"), nil},
+		{"0.005", "USD", New(1, "USD"), nil},
+		{"0.0049", "USD", New(0, "USD"), nil},
+		{"-0.005", "USD", New(-1, "USD"), nil},
+		{"-1.004", "USD", New(-100, "USD"), nil},
+		{"100.5", "JPY", New(101, "JPY"), nil},
+		{"1.2345", "KWD", New(1235, "KWD"), nil},
+		{"92233720368547758.07", "USD", New(9223372036854775807, "USD"), nil},
+		{"-92233720368547758.08", "USD", New(-9223372036854775808, "USD"), nil},
+		{"92233720368547758.08", "USD", Money{}, ErrAmountOutOfRange},
+		{"-92233720368547758.09", "USD", Money{}, ErrAmountOutOfRange},
+		{"1e30", "USD", Money{}, ErrInvalidAmount},
+		{"1/2", "USD", Money{}, ErrInvalidAmount},
+		{"abc", "USD", Money{}, ErrInvalidAmount},
+		{"", "USD", Money{}, ErrInvalidAmount},
+		{"1", "US", Money{}, ErrInvalidCurrency},
+		{"1", "U5D", Money{}, ErrInvalidCurrency},
+	}
+
+	for _, tt := range tests {
+		got, err := Parse(tt.amount, tt.currency)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("Parse(%q, %q) error = %v, want %v", tt.amount, tt.currency, err, tt.err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Parse(%q, %q) = %v, want %v", tt.amount, tt.currency, got, tt.want)
+		}
+	}
+}
+
+func TestAmount(t *testing.T) {
+	tests := []struct {
+		money Money
+		want  string
+	}{
+		{New(1250, "USD"), "12.50"},
+		{New(-5, "USD"), "-0.05"},
+		{New(101, "JPY"), "101"},
+		{New(1235, "KWD"), "1.235"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.money.Amount(); got != tt.want {
+			t.Errorf("%#v.Amount() = %q, want %q", tt.money, got, tt.want)
+		}
+	}
+}
+
+func TestRounding(t *testing.T) {
+	tests := []struct {
+		name string
+		got  Money
+		want Money
+	}{
+		{"percent", New(1000, "USD").Percent(7.1), New(71, "USD")},
+		{"percent half up", New(50, "USD").Percent(1), New(1, "USD")},
+		{"percent half down", New(-50, "USD").Percent(1), New(-1, "USD")},
+		{"percent below half", New(49, "USD").Percent(1), New(0, "USD")},
+		{"exclude percent", New(1100, "USD").ExcludePercent(10), New(1000, "USD")},
+		{"exclude percent rounded", New(1000, "USD").ExcludePercent(11), New(901, "USD")},
+		{"mul frac", New(100, "USD").MulFrac(1, 3), New(33, "USD")},
+		{"mul frac half", New(5, "USD").MulFrac(1, 2), New(3, "USD")},
+		{"mul frac negative half", New(-5, "USD").MulFrac(1, 2), New(-3, "USD")},
+	}
+
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		money   Money
+		weights []int64
+		want    []int64
+	}{
+		{New(100, "USD"), []int64{1, 1, 1}, []int64{33, 33, 34}},
+		{New(100, "USD"), []int64{1, 2}, []int64{33, 67}},
+		{New(1, "USD"), []int64{1, 1, 1}, []int64{0, 0, 1}},
+		{New(-100, "USD"), []int64{1, 1, 1}, []int64{-33, -33, -34}},
+		{New(1000, "USD"), []int64{250, 750}, []int64{250, 750}},
+		{New(100, "USD"), []int64{0, 0}, []int64{100, 0}},
+		{New(100, "USD"), []int64{5}, []int64{100}},
+	}
+
+	for _, tt := range tests {
+		parts := tt.money.Allocate(tt.weights)
+		if len(parts) != len(tt.want) {
+			t.Errorf("%v.Allocate(%v) gave %d parts, want %d", tt.money, tt.weights, len(parts), len(tt.want))
+			continue
+		}
+
+		var sum int64
+		for i, part := range parts {
+			sum += part.Minor
+			if part.Minor != tt.want[i] || part.Currency != tt.money.Currency {
+				t.Errorf("%v.Allocate(%v)[%d] = %v, want %d %s", tt.money, tt.weights, i, part, tt.want[i], tt.money.Currency)
+			}
+		}
+		if sum != tt.money.Minor {
+			t.Errorf("%v.Allocate(%v) parts add up to %d", tt.money, tt.weights, sum)
+		}
+	}
+}
+
+func TestCurrencyMismatch(t *testing.T) {
+	usd, eur := New(100, "USD"), New(100, "EUR")
+
+	tests := []struct {
+		name string
+		op   func()
+	}{
+		{"add", func() { usd.Add(eur) }},
+		{"sub", func() { usd.Sub(eur) }},
+		{"cmp", func() { usd.Cmp(eur) }},
+		{"min", func() { usd.Min(eur) }},
+	}
+
+	for _, tt := range tests {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s of USD and EUR didn't panic", tt.name)
+				}
+			}()
+			tt.op()
+		}()
+	}
+
+	if usd.SameCurrency(eur) {
+		t.Error("USD and EUR are the same currency")
+	}
+	if got := usd.Add(New(50, "USD")); got != New(150, "USD") {
+		t.Errorf("USD add = %v", got)
+	}
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	t.Setenv("DEFAULT_CURRENCY", "USD")
+
+	tests := []struct {
+		data string
+		want Money
+		err  bool
+	}{
+		{`{"amount": "12.50", "currency": "EUR"}`, New(1250, "EUR"), false},
+		{`{"amount": 3.2}`, New(320, "USD"), false},
+		{`"4.005"`, New(401, "USD"), false},
+		{`10`, New(1000, "USD"), false},
+		{`null`, Money{}, false},
+		{`"92233720368547758.08"`, Money{}, true},
+		{`{"amount": "1", "currency": "EURO"}`, Money{}, true},
+	}
+
+	for _, tt := range tests {
+		var got Money
+		err := got.UnmarshalJSON([]byte(tt.data))
+		if (err != nil) != tt.err {
+			t.Errorf("UnmarshalJSON(%s) error = %v", tt.data, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("UnmarshalJSON(%s) = %#v, want %#v", tt.data, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrNoRecipient = errors.New("no recipient to notify")
+
+// Message is something staff or other systems should know about, e.g. a product running low
+type Message struct {
+	Event   string      `json:"event"`
+	Subject string      `json:"subject"`
+	Body    string      `json:"body"`
+	Data    interface{} `json:"data"`
+}
+
+// Notifier delivers messages, a failed delivery is retried later by the caller
+type Notifier interface {
+	Notify(m Message) error
+}
+
+// Log writes the messages to the application log
+type Log struct{}
+
+func (Log) Notify(m Message) error {
+	log.Printf("%s: %s: %s", m.Event, m.Subject, m.Body)
+	return nil
+}
+
+// Email is a stub that only logs the email it would send, until a mail service is set up
+type Email struct {
+	To []string
+}
+
+func (e Email) Notify(m Message) error {
+	if len(e.To) == 0 {
+		return ErrNoRecipient
+	}
+
+	log.Printf("email to %s: %s\n%s", strings.Join(e.To, ", "), m.Subject, m.Body)
+	return nil
+}
+
+// Webhook posts the messages as json to the url
+type Webhook struct {
+	URL    string
+	Client *http.Client
+}
+
+func NewWebhook(url string) *Webhook {
+	return &Webhook{URL: url, Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (w *Webhook) Notify(m Message) error {
+	if w.URL == "" {
+		return ErrNoRecipient
+	}
+
+	body, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	resp, err := w.Client.Post(w.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s: %s", w.URL, resp.Status)
+	}
+	return nil
+}
+
+// Multi delivers the messages to every notifier by name, the errors of those that failed are joined
+type Multi map[string]Notifier
+
+func (n Multi) Notify(m Message) error {
+	_, err := n.NotifyPending(m, nil)
+	return err
+}
+
+// NotifyPending delivers the message only to the notifiers not named in delivered, so a retry doesn't send it
+// twice to those that already have it. It returns the names of all the notifiers that have it now.
+func (n Multi) NotifyPending(m Message, delivered []string) ([]string, error) {
+	names := make([]string, 0, len(n))
+	for name := range n {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, name := range names {
+		if slices.Contains(delivered, name) {
+			continue
+		}
+		if err := n[name].Notify(m); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		delivered = append(delivered, name)
+	}
+	return delivered, errors.Join(errs...)
+}
+
+// comma separated values of the variable, empty ones dropped
+func envList(name string) []string {
+	values := []string{}
+	for _, value := range strings.Split(os.Getenv(name), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+var (
+	defaultNotifier Multi
+	defaultOnce     sync.Once
+)
+
+// notifiers named in NOTIFIERS, e.g. "log,email,webhook"
+func Default() Multi {
+	defaultOnce.Do(func() {
+		names := envList("NOTIFIERS")
+		if len(names) == 0 {
+			names = []string{"log"} // Default log
+		}
+
+		notifiers := Multi{}
+		for _, name := range names {
+			switch name {
+			case "log":
+				notifiers[name] = Log{}
+			case "email":
+				notifiers[name] = Email{To: envList("NOTIFY_EMAIL_TO")}
+			case "webhook":
+				notifiers[name] = NewWebhook(os.Getenv("NOTIFY_WEBHOOK_URL"))
+			default:
+				log.Printf("unknown notifier %q", name)
+			}
+		}
+		defaultNotifier = notifiers
+	})
+	return defaultNotifier
+}
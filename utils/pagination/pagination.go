@@ -1,7 +1,11 @@
 package pagination
 
 import (
+	"errors"
+	"fmt"
+	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
@@ -13,11 +17,93 @@ type Pagination struct {
 	TotalPages int    `json:"total_pages"`
 }
 
-func Paginate(c *gin.Context) (int, int, string, string) {
+// Sortable maps the sort names a listing accepts to their columns
+type Sortable map[string]string
+
+// most columns a listing can be sorted by at once
+const maxSortFields = 5
+
+// page and page size of the request
+func Page(c *gin.Context) (int, int) {
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))           //Default 1
 	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10")) //Default 10
-	sortField := c.DefaultQuery("sort_by", "id")                   // Default sorting by ID
-	sortOrder := c.DefaultQuery("sort_order", "asc")               // Default sort order
 
-	return page, pageSize, sortField, sortOrder
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 10
+	}
+	return page, pageSize
+}
+
+// order by clause from sort=-price,name, a leading dash sorts descending. The older sort_by and
+// sort_order parameters still work. Rows with the same values stay in id order, so pages don't overlap.
+func Sort(c *gin.Context, sortable Sortable) (string, error) {
+	var fields []string
+	if sort := c.Query("sort"); sort != "" {
+		fields = strings.Split(sort, ",")
+	} else {
+		sortField := c.DefaultQuery("sort_by", "id") // Default sorting by ID
+		switch strings.ToLower(c.DefaultQuery("sort_order", "asc")) {
+		case "asc":
+			fields = []string{sortField}
+		case "desc":
+			fields = []string{"-" + sortField}
+		default:
+			return "", errors.New("sort_order must be asc or desc")
+		}
+	}
+
+	if len(fields) > maxSortFields {
+		return "", fmt.Errorf("at most %d sort fields", maxSortFields)
+	}
+
+	clauses := []string{}
+	used := map[string]bool{}
+	for _, field := range fields {
+		field = strings.TrimSpace(field)
+		direction := "asc"
+		if strings.HasPrefix(field, "-") {
+			field = field[1:]
+			direction = "desc"
+		}
+
+		column, ok := sortable[field]
+		if !ok {
+			return "", fmt.Errorf("unknown sort field %q, allowed: %s", field, strings.Join(sortable.names(), ", "))
+		}
+		if used[column] {
+			return "", fmt.Errorf("sort field %q is given twice", field)
+		}
+		used[column] = true
+
+		clauses = append(clauses, column+" "+direction)
+	}
+
+	if !used["id"] {
+		clauses = append(clauses, "id asc")
+	}
+	return strings.Join(clauses, ", "), nil
+}
+
+func (sortable Sortable) names() []string {
+	names := []string{}
+	for name := range sortable {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// page, page size and order by clause of a listing
+func Paginate(c *gin.Context, sortable Sortable) (int, int, string, error) {
+	page, pageSize := Page(c)
+
+	orderBy, err := Sort(c, sortable)
+	if err != nil {
+		return 0, 0, "", err
+	}
+
+	return page, pageSize, orderBy, nil
 }
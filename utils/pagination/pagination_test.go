@@ -0,0 +1,111 @@
+package pagination
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+var testSortable = Sortable{
+	"id":         "id",
+	"name":       "product_name",
+	"price":      "product_price_minor",
+	"stock":      "product_stock",
+	"created_at": "created_at",
+	"updated_at": "updated_at",
+}
+
+func testContext(query string) *gin.Context {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/list?"+query, nil)
+	return c
+}
+
+func TestPage(t *testing.T) {
+	tests := []struct {
+		query    string
+		page     int
+		pageSize int
+	}{
+		{"", 1, 10},
+		{"page=3&page_size=25", 3, 25},
+		{"page=0&page_size=0", 1, 10},
+		{"page=-2&page_size=-5", 1, 10},
+		{"page=abc&page_size=xyz", 1, 10},
+	}
+
+	for _, tt := range tests {
+		page, pageSize := Page(testContext(tt.query))
+		if page != tt.page || pageSize != tt.pageSize {
+			t.Errorf("Page(%q) = %d, %d, want %d, %d", tt.query, page, pageSize, tt.page, tt.pageSize)
+		}
+	}
+}
+
+func TestSort(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"", "id asc"},
+		{"sort=", "id asc"},
+		{"sort=name", "product_name asc, id asc"},
+		{"sort=-price,name", "product_price_minor desc, product_name asc, id asc"},
+		{"sort=%20-price%20,%20name", "product_price_minor desc, product_name asc, id asc"},
+		{"sort=-id", "id desc"},
+		{"sort=name,-id", "product_name asc, id desc"},
+		{"sort=name,price,stock,created_at,updated_at", "product_name asc, product_price_minor asc, product_stock asc, created_at asc, updated_at asc, id asc"},
+		// the older parameters
+		{"sort_by=price", "product_price_minor asc, id asc"},
+		{"sort_by=price&sort_order=DESC", "product_price_minor desc, id asc"},
+		{"sort_order=desc", "id desc"},
+		{"sort=name&sort_by=price&sort_order=sideways", "product_name asc, id asc"},
+	}
+
+	for _, tt := range tests {
+		got, err := Sort(testContext(tt.query), testSortable)
+		if err != nil {
+			t.Errorf("Sort(%q) error = %v", tt.query, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Sort(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestSortErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		err   string
+	}{
+		{"sort=name,price,stock,created_at,updated_at,id", "at most 5 sort fields"},
+		{"sort=colour", `unknown sort field "colour", allowed: created_at, id, name, price, stock, updated_at`},
+		{"sort=product_name", `unknown sort field "product_name"`},
+		{"sort=name,-name", `sort field "name" is given twice`},
+		{"sort=name,", `unknown sort field ""`},
+		{"sort_by=colour", `unknown sort field "colour"`},
+		{"sort_order=sideways", "sort_order must be asc or desc"},
+	}
+
+	for _, tt := range tests {
+		_, err := Sort(testContext(tt.query), testSortable)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("Sort(%q) error = %v, want %q", tt.query, err, tt.err)
+		}
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	page, pageSize, orderBy, err := Paginate(testContext("page=2&page_size=5&sort=-stock"), testSortable)
+	if err != nil || page != 2 || pageSize != 5 || orderBy != "product_stock desc, id asc" {
+		t.Errorf("Paginate = %d, %d, %q, %v", page, pageSize, orderBy, err)
+	}
+
+	if _, _, _, err := Paginate(testContext("sort=colour"), testSortable); err == nil {
+		t.Error("Paginate with an unknown sort field didn't fail")
+	}
+}
@@ -0,0 +1,317 @@
+package search
+
+import (
+	"html"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// words shown around the first match of a long field
+const snippetWords = 30
+
+type token struct {
+	term       string
+	start, end int
+}
+
+type field struct {
+	text   string
+	tokens []token
+}
+
+// Memory is an in-process index. Query terms match exactly, as a prefix of a word, or with
+// one typo (two for long words), exact matches rank first. Every process holds its own copy,
+// so it has to be filled at startup.
+type Memory struct {
+	mu       sync.RWMutex
+	weights  map[string]float64
+	docs     map[int]map[string]field
+	postings map[string]map[int]map[string]int
+}
+
+// index with a relevance weight per field, fields without one weigh 1
+func NewMemory(weights map[string]float64) *Memory {
+	return &Memory{
+		weights:  weights,
+		docs:     map[int]map[string]field{},
+		postings: map[string]map[int]map[string]int{},
+	}
+}
+
+// lowercase words of the text with their position in it
+func tokenize(text string) []token {
+	var tokens []token
+	start := -1
+
+	for i, r := range text + " " {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			tokens = append(tokens, token{term: strings.ToLower(text[start:i]), start: start, end: i})
+			start = -1
+		}
+	}
+
+	return tokens
+}
+
+func (m *Memory) weight(name string) float64 {
+	if weight, ok := m.weights[name]; ok {
+		return weight
+	}
+	return 1
+}
+
+func (m *Memory) Upsert(doc Document) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.remove(doc.ID)
+
+	fields := map[string]field{}
+	for name, text := range doc.Fields {
+		f := field{text: text, tokens: tokenize(text)}
+		fields[name] = f
+
+		for _, t := range f.tokens {
+			if m.postings[t.term] == nil {
+				m.postings[t.term] = map[int]map[string]int{}
+			}
+			if m.postings[t.term][doc.ID] == nil {
+				m.postings[t.term][doc.ID] = map[string]int{}
+			}
+			m.postings[t.term][doc.ID][name]++
+		}
+	}
+	m.docs[doc.ID] = fields
+
+	return nil
+}
+
+func (m *Memory) Delete(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.remove(id)
+	return nil
+}
+
+func (m *Memory) remove(id int) {
+	for _, f := range m.docs[id] {
+		for _, t := range f.tokens {
+			delete(m.postings[t.term], id)
+			if len(m.postings[t.term]) == 0 {
+				delete(m.postings, t.term)
+			}
+		}
+	}
+	delete(m.docs, id)
+}
+
+// typos allowed in a word of the length
+func maxTypos(length int) int {
+	switch {
+	case length < 4:
+		return 0
+	case length < 8:
+		return 1
+	}
+	return 2
+}
+
+// indexed terms the query term matches, with how close the match is from 0 to 1
+func (m *Memory) expand(term string) map[string]float64 {
+	matches := map[string]float64{}
+	length := len([]rune(term))
+	typos := maxTypos(length)
+
+	for candidate := range m.postings {
+		switch {
+		case candidate == term:
+			matches[candidate] = 1
+		case length >= 2 && strings.HasPrefix(candidate, term):
+			matches[candidate] = 0.8
+		case typos > 0:
+			candidateLength := len([]rune(candidate))
+			if candidateLength < length-typos || candidateLength > length+typos {
+				continue
+			}
+			if distance := editDistance(term, candidate); distance <= typos {
+				matches[candidate] = 0.7 - 0.2*float64(distance-1)
+			}
+		}
+	}
+
+	return matches
+}
+
+// edits between the words, a swap of two neighbour letters is one edit
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	rows := make([][]int, len(ra)+1)
+	for i := range rows {
+		rows[i] = make([]int, len(rb)+1)
+		rows[i][0] = i
+	}
+	for j := range rows[0] {
+		rows[0][j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+
+			d := min(rows[i-1][j]+1, rows[i][j-1]+1, rows[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				d = min(d, rows[i-2][j-2]+1)
+			}
+			rows[i][j] = d
+		}
+	}
+
+	return rows[len(ra)][len(rb)]
+}
+
+// documents matching every term of the query, best first
+func (m *Memory) Search(query string, limit, offset int) ([]Hit, int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	terms := map[string]bool{}
+	for _, t := range tokenize(query) {
+		terms[t.term] = true
+	}
+	if len(terms) == 0 {
+		return []Hit{}, 0, nil
+	}
+
+	total := float64(len(m.docs))
+	scores := map[int]float64{}
+	matchedTerms := map[int]int{}
+	highlighted := map[int]map[string]bool{}
+
+	for term := range terms {
+		best := map[int]float64{}
+
+		for candidate, closeness := range m.expand(term) {
+			docs := m.postings[candidate]
+			df := float64(len(docs))
+			idf := math.Log(1 + (total-df+0.5)/(df+0.5))
+
+			for id, counts := range docs {
+				score := 0.0
+				for name, count := range counts {
+					score += m.weight(name) * (1 + math.Log(float64(count)))
+				}
+				score *= closeness * idf
+
+				if score > best[id] {
+					best[id] = score
+				}
+				if highlighted[id] == nil {
+					highlighted[id] = map[string]bool{}
+				}
+				highlighted[id][candidate] = true
+			}
+		}
+
+		for id, score := range best {
+			scores[id] += score
+			matchedTerms[id]++
+		}
+	}
+
+	ids := []int{}
+	for id, count := range matchedTerms {
+		if count == len(terms) {
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		if scores[ids[i]] != scores[ids[j]] {
+			return scores[ids[i]] > scores[ids[j]]
+		}
+		return ids[i] < ids[j]
+	})
+
+	count := len(ids)
+	if offset >= len(ids) {
+		return []Hit{}, count, nil
+	}
+	ids = ids[offset:]
+	if limit > 0 && limit < len(ids) {
+		ids = ids[:limit]
+	}
+
+	hits := []Hit{}
+	for _, id := range ids {
+		hits = append(hits, Hit{
+			ID:         id,
+			Score:      math.Round(scores[id]*1000) / 1000,
+			Highlights: m.highlights(id, highlighted[id]),
+		})
+	}
+
+	return hits, count, nil
+}
+
+// fields with a match, the matched words wrapped in <em> and long fields cut around the first match
+func (m *Memory) highlights(id int, matched map[string]bool) map[string]string {
+	result := map[string]string{}
+
+	for name, f := range m.docs[id] {
+		first := -1
+		for i, t := range f.tokens {
+			if matched[t.term] {
+				first = i
+				break
+			}
+		}
+		if first < 0 {
+			continue
+		}
+
+		from, to := 0, len(f.tokens)
+		if len(f.tokens) > snippetWords {
+			from = max(0, first-snippetWords/3)
+			to = min(len(f.tokens), from+snippetWords)
+		}
+
+		var b strings.Builder
+		if from > 0 {
+			b.WriteString("… ")
+		}
+
+		pos := f.tokens[from].start
+		for _, t := range f.tokens[from:to] {
+			b.WriteString(html.EscapeString(f.text[pos:t.start]))
+			word := html.EscapeString(f.text[t.start:t.end])
+			if matched[t.term] {
+				word = "<em>" + word + "</em>"
+			}
+			b.WriteString(word)
+			pos = t.end
+		}
+
+		if to < len(f.tokens) {
+			b.WriteString(" …")
+		} else {
+			b.WriteString(html.EscapeString(f.text[pos:]))
+		}
+
+		result[name] = b.String()
+	}
+
+	return result
+}
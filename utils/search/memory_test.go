@@ -0,0 +1,197 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text string
+		want []token
+	}{
+		{"", nil},
+		{"Red Mug", []token{{"red", 0, 3}, {"mug", 4, 7}}},
+		{"  USB-C, 2m ", []token{{"usb", 2, 5}, {"c", 6, 7}, {"2m", 9, 11}}},
+		{"Café", []token{{"café", 0, 5}}},
+	}
+
+	for _, tt := range tests {
+		if got := tokenize(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("tokenize(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"mug", "mug", 0},
+		{"laptop", "labtop", 1},
+		{"laptop", "laptpo", 1},
+		{"laptop", "lapto", 1},
+		{"laptop", "alptpo", 2},
+		{"keyboard", "kyebaord", 2},
+		{"", "abc", 3},
+	}
+
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestMaxTypos(t *testing.T) {
+	tests := []struct {
+		length int
+		want   int
+	}{
+		{1, 0},
+		{3, 0},
+		{4, 1},
+		{7, 1},
+		{8, 2},
+		{20, 2},
+	}
+
+	for _, tt := range tests {
+		if got := maxTypos(tt.length); got != tt.want {
+			t.Errorf("maxTypos(%d) = %d, want %d", tt.length, got, tt.want)
+		}
+	}
+}
+
+func testIndex() *Memory {
+	m := NewMemory(map[string]float64{"name": 3, "brand": 2, "description": 1})
+
+	docs := []Document{
+		{ID: 1, Fields: map[string]string{"name": "Laptop Stand", "brand": "Acme", "description": "Aluminium stand for a laptop"}},
+		{ID: 2, Fields: map[string]string{"name": "Laptops Sleeve", "brand": "Acme", "description": "Padded sleeve"}},
+		{ID: 3, Fields: map[string]string{"name": "Desk Lamp", "brand": "Lumen", "description": "Lamp for a laptop desk"}},
+		{ID: 4, Fields: map[string]string{"name": "Keyboard", "brand": "Typo & Co", "description": "Mechanical <b>keyboard</b>"}},
+		{ID: 5, Fields: map[string]string{"name": "Cat Toy", "brand": "Pets", "description": "A toy"}},
+	}
+	for _, doc := range docs {
+		m.Upsert(doc)
+	}
+	return m
+}
+
+func hitIds(hits []Hit) []int {
+	ids := []int{}
+	for _, hit := range hits {
+		ids = append(ids, hit.ID)
+	}
+	return ids
+}
+
+func TestSearch(t *testing.T) {
+	m := testIndex()
+
+	tests := []struct {
+		name  string
+		query string
+		want  []int
+	}{
+		{"exact", "keyboard", []int{4}},
+		{"case and punctuation", "KEYBOARD!", []int{4}},
+		{"prefix", "keyb", []int{4}},
+		{"one typo", "keybaord", []int{4}},
+		{"two typos in a long word", "kyebaord", []int{4}},
+		{"no typo in a short word", "cut", []int{}},
+		{"single letter isn't a prefix", "k", []int{}},
+		{"every term must match", "acme sleeve", []int{2}},
+		{"no match", "phone", []int{}},
+		{"empty query", " , ", []int{}},
+		{"name ranks over description", "lamp", []int{3}},
+		{"exact name, then prefix in name, then description", "laptop", []int{1, 2, 3}},
+		{"brand", "lumen", []int{3}},
+	}
+
+	for _, tt := range tests {
+		hits, count, err := m.Search(tt.query, 0, 0)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := hitIds(hits); !reflect.DeepEqual(got, tt.want) || count != len(tt.want) {
+			t.Errorf("%s: Search(%q) = %v (%d), want %v", tt.name, tt.query, got, count, tt.want)
+		}
+	}
+}
+
+func TestSearchPage(t *testing.T) {
+	m := testIndex()
+
+	tests := []struct {
+		limit, offset int
+		want          []int
+	}{
+		{0, 0, []int{1, 2, 3}},
+		{2, 0, []int{1, 2}},
+		{2, 2, []int{3}},
+		{2, 3, []int{}},
+	}
+
+	for _, tt := range tests {
+		hits, count, _ := m.Search("laptop", tt.limit, tt.offset)
+		if got := hitIds(hits); !reflect.DeepEqual(got, tt.want) || count != 3 {
+			t.Errorf("Search(laptop, %d, %d) = %v (%d), want %v (3)", tt.limit, tt.offset, got, count, tt.want)
+		}
+	}
+}
+
+func TestHighlights(t *testing.T) {
+	m := testIndex()
+
+	tests := []struct {
+		query string
+		id    int
+		want  map[string]string
+	}{
+		{"keyboard", 4, map[string]string{
+			"name":        "<em>Keyboard</em>",
+			"description": "Mechanical &lt;b&gt;<em>keyboard</em>&lt;/b&gt;",
+		}},
+		{"typo", 4, map[string]string{"brand": "<em>Typo</em> &amp; Co"}},
+		{"lapt", 2, map[string]string{"name": "<em>Laptops</em> Sleeve"}},
+	}
+
+	for _, tt := range tests {
+		hits, _, _ := m.Search(tt.query, 0, 0)
+
+		found := false
+		for _, hit := range hits {
+			if hit.ID != tt.id {
+				continue
+			}
+			found = true
+			if !reflect.DeepEqual(hit.Highlights, tt.want) {
+				t.Errorf("Search(%q) highlights of %d = %v, want %v", tt.query, tt.id, hit.Highlights, tt.want)
+			}
+		}
+		if !found {
+			t.Errorf("Search(%q) didn't find %d", tt.query, tt.id)
+		}
+	}
+}
+
+func TestUpsertAndDelete(t *testing.T) {
+	m := testIndex()
+
+	m.Upsert(Document{ID: 4, Fields: map[string]string{"name": "Mouse"}})
+	if hits, _, _ := m.Search("keyboard", 0, 0); len(hits) != 0 {
+		t.Errorf("replaced document still matches its old text: %v", hitIds(hits))
+	}
+	if hits, _, _ := m.Search("mouse", 0, 0); !reflect.DeepEqual(hitIds(hits), []int{4}) {
+		t.Errorf("replaced document doesn't match its new text: %v", hitIds(hits))
+	}
+
+	m.Delete(4)
+	if hits, _, _ := m.Search("mouse", 0, 0); len(hits) != 0 {
+		t.Errorf("deleted document still matches: %v", hitIds(hits))
+	}
+}
@@ -0,0 +1,21 @@
+package search
+
+// Document is what gets indexed for a record, the text of each field by field name
+type Document struct {
+	ID     int
+	Fields map[string]string
+}
+
+// Hit is a matching document with its relevance and the matched fields, terms wrapped in <em>
+type Hit struct {
+	ID         int               `json:"id"`
+	Score      float64           `json:"score"`
+	Highlights map[string]string `json:"highlights"`
+}
+
+// Index keeps documents searchable, Search returns a page of hits and the total number of hits
+type Index interface {
+	Upsert(doc Document) error
+	Delete(id int) error
+	Search(query string, limit, offset int) ([]Hit, int, error)
+}
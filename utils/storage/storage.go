@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var ErrInvalidKey = errors.New("invalid storage key")
+
+// Storage keeps uploaded files under keys like "products/12/3f9a.jpg"
+type Storage interface {
+	Put(key string, r io.Reader) error
+	Delete(key string) error
+	URL(key string) string
+}
+
+// Local stores the files below a directory that is served at the base url
+type Local struct {
+	Root    string
+	BaseURL string
+}
+
+func NewLocal(root, baseURL string) *Local {
+	return &Local{Root: root, BaseURL: strings.TrimRight(baseURL, "/")}
+}
+
+// path of the key inside the root, keys can't leave it
+func (l *Local) path(key string) (string, error) {
+	clean := filepath.Clean("/" + key)
+	if clean == "/" {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(l.Root, clean), nil
+}
+
+func (l *Local) Put(key string, r io.Reader) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	return f.Close()
+}
+
+// a missing file is already deleted
+func (l *Local) Delete(key string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (l *Local) URL(key string) string {
+	return l.BaseURL + "/" + strings.TrimLeft(key, "/")
+}
+
+// directory of the local storage
+func LocalRoot() string {
+	root := os.Getenv("STORAGE_LOCAL_ROOT")
+	if root == "" {
+		root = "uploads" // Default uploads
+	}
+	return root
+}
+
+// url the local storage is served at
+func LocalBaseURL() string {
+	baseURL := os.Getenv("STORAGE_BASE_URL")
+	if baseURL == "" {
+		baseURL = "/uploads" // Default /uploads
+	}
+	return baseURL
+}
+
+var (
+	defaultStorage Storage
+	defaultOnce    sync.Once
+)
+
+// storage the uploads go to, the local filesystem for now
+func Default() Storage {
+	defaultOnce.Do(func() {
+		defaultStorage = NewLocal(LocalRoot(), LocalBaseURL())
+	})
+	return defaultStorage
+}